@@ -1,18 +1,65 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"pizza-tracker-go/internal/models"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AdminOrderData struct {
-	Orders   []models.Order
-	Statuses []string
-	Username string
+	Orders      []OrderRow
+	Statuses    []string
+	Username    string
+	Role        models.Role // 模板依角色決定要顯示哪些操作
+	Filter      OrderFilter // 目前的查詢條件，填回表單
+	SortOptions []SortOption
+	Total       int64
+	Page        int
+	TotalPages  int
+	PrevURL     string // 上一頁 / 下一頁的網址，空字串代表沒有
+	NextURL     string
+	Live        bool // 第一頁且沒有篩選時，新訂單才即時插入表格，否則只顯示新訂單數量
+	Error       string
+}
+
+// OrderFilter => /admin 的查詢參數 (原始字串)，q / status / from / to / sort / page
+type OrderFilter struct {
+	Search string `form:"q"`
+	Status string `form:"status"`
+	From   string `form:"from"`
+	To     string `form:"to"`
+	Sort   string `form:"sort"` // 前面加 - 代表由大到小，例如 -createdAt
+	Page   int    `form:"page"`
+}
+
+type SortOption struct {
+	Value string
+	Label string
+}
+
+// admin.tmpl 的排序選項，第一個是預設值
+var orderSortOptions = []SortOption{
+	{"-createdAt", "最新下單"},
+	{"createdAt", "最早下單"},
+	{"-updatedAt", "最近更新"},
+	{"-total", "金額高到低"},
+	{"total", "金額低到高"},
+	{"customerName", "遊戲暱稱"},
+}
+
+// admin.tmpl 表格的一列 => 訂單本身加上登入者的角色，讓 orderRow 模板不管是整頁或單列渲染都能判斷權限
+type OrderRow struct {
+	models.Order
+	Role models.Role
 }
 
 // 處理登入邏輯 => session不存在時，導轉去login頁面，此時要把錯誤訊息顯示再登入頁面
@@ -22,7 +69,7 @@ type LoginData struct {
 
 // c *gin.Context => 代表一次 HTTP 請求與回應的上下文。透過它可以讀取請求、回傳資料。
 func (h *Handler) HandleLoginGet(c *gin.Context) {
-	c.HTML(http.StatusOK, "login.tmpl", LoginData{}) // LoginData{} → 傳入模板的資料
+	h.renderHTML(c, http.StatusOK, "login.tmpl", LoginData{}) // LoginData{} → 傳入模板的資料
 }
 
 func (h *Handler) HandleLoginPost(c *gin.Context) {
@@ -33,22 +80,47 @@ func (h *Handler) HandleLoginPost(c *gin.Context) {
 
 	// 先判斷規則方面的錯誤
 	if err := c.ShouldBind(&form); err != nil {
-		c.HTML(http.StatusOK, "login.tmpl", LoginData{Error: "Invalid input: " + err.Error()})
+		h.renderHTML(c, http.StatusOK, "login.tmpl", LoginData{Error: "Invalid input: " + err.Error()})
 		return
 	}
 
-	user, err := h.users.AuthenticateUser(form.Account, form.Password)
+	// 失敗次數限制與登入紀錄都在 Login 裡處理，見 models/login.go
+	user, err := h.users.Login(form.Account, form.Password, c.ClientIP())
 
 	//規則正確，但登入資訊錯誤
 	if err != nil {
-		c.HTML(http.StatusOK, "login.tmpl", LoginData{
-			Error: err.Error(), // 使用實際的錯誤訊息
-		})
+		var locked *models.LoginLockedError
+		switch {
+		case errors.As(err, &locked):
+			// 無條件進位到分鐘，避免顯示「0 分鐘後再試」
+			wait := time.Until(locked.Until)
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			h.renderHTML(c, http.StatusTooManyRequests, "login.tmpl", LoginData{
+				Error: fmt.Sprintf("登入失敗次數過多，請在 %d 分鐘後再試", int(wait.Minutes())+1),
+			})
+		case errors.Is(err, models.ErrInvalidCredentials), errors.Is(err, models.ErrUserDisabled):
+			// 帳號不存在與密碼錯誤是同一個訊息，不讓人試探有哪些帳號
+			h.renderHTML(c, http.StatusUnauthorized, "login.tmpl", LoginData{Error: err.Error()})
+		default:
+			log.Println("登入失敗:", err)
+			h.renderHTML(c, http.StatusInternalServerError, "login.tmpl", LoginData{Error: "系統錯誤，請稍後再試"})
+		}
+		return
+	}
+	// 已啟用兩步驟驗證 => 先不寫入 userID，輸入驗證碼 (/login/2fa) 之後才算登入
+	if user.TOTPEnabled {
+		ClearAllSession(c)
+		setPendingTwoFactor(c, user.ID)
+		c.Redirect(http.StatusSeeOther, "/login/2fa")
 		return
 	}
+
 	// 需要改成字串，因為等下操作 DB 的 GetUserByID 是拿 string去搜尋
-	SetSession(c, "userID", fmt.Sprintf("%v", user.ID))
-	SetSession(c, "username", user.Username)
+	if err := h.startSession(c, user); err != nil {
+		log.Println("建立登入階段失敗:", err)
+		h.renderHTML(c, http.StatusInternalServerError, "login.tmpl", LoginData{Error: "系統錯誤，請稍後再試"})
+		return
+	}
 
 	// 登入成功，存session跟導轉路徑
 	// SetSession(c, "userID", user.ID)
@@ -56,6 +128,11 @@ func (h *Handler) HandleLoginPost(c *gin.Context) {
 }
 
 func (h *Handler) HandleLogoutPost(c *gin.Context) {
+	if sid := currentSessionID(c); sid != "" {
+		if err := h.users.EndSession(sid); err != nil {
+			log.Println("刪除登入階段紀錄失敗:", err)
+		}
+	}
 
 	if err := ClearAllSession(c); err != nil {
 		c.String(http.StatusInternalServerError, err.Error())
@@ -67,20 +144,92 @@ func (h *Handler) HandleLogoutPost(c *gin.Context) {
 // 顯示所有訂單、先前存在session的username、所有訂單狀態
 // orders => 所有訂單，每個訂單的實際進度條狀態，也就是當前狀態處在哪個階段
 // Status => 需要把所有狀態傳進去是因為要做下拉選單，所以要知道總共有哪些狀態可以供選擇
+// 訂單列表依查詢參數分頁，每頁 models.DefaultOrderPageSize 筆
 func (h *Handler) ServeAdminDashboard(c *gin.Context) {
-	orders, err := h.orders.GetAllOrders()
+	username := GetSession(c, "username")
+	role := currentRole(c)
+	data := AdminOrderData{
+		Statuses:    models.OrderStatues,
+		Username:    username,
+		Role:        role,
+		SortOptions: orderSortOptions,
+	}
+	// 綁定失敗 (例如 page 不是數字) 時當作第一頁
+	_ = c.ShouldBindQuery(&data.Filter)
+
+	q, err := orderSearchFromFilter(data.Filter)
+	if err != nil {
+		data.Error = err.Error()
+		h.renderHTML(c, http.StatusBadRequest, "admin.tmpl", data)
+		return
+	}
+	result, err := h.orders.SearchOrders(q)
 	if err != nil {
 		log.Printf("獲取訂單資訊失敗!!!: %v", err)
 		c.String(http.StatusInternalServerError, "獲取訂單資訊失敗!!!")
+		return
 	}
-	username := GetSession(c, "username")
+
+	data.Orders = make([]OrderRow, len(result.Orders))
+	for i, order := range result.Orders {
+		data.Orders[i] = OrderRow{Order: order, Role: role}
+	}
+	data.Total = result.Total
+	data.Page = result.Page
+	data.TotalPages = result.TotalPages()
+	if data.Page > 1 {
+		data.PrevURL = data.Filter.pageURL(data.Page - 1)
+	}
+	if data.Page < data.TotalPages {
+		data.NextURL = data.Filter.pageURL(data.Page + 1)
+	}
+	f := data.Filter
+	data.Live = result.Page == 1 && f.Search == "" && f.Status == "" && f.From == "" && f.To == "" &&
+		(f.Sort == "" || f.Sort == orderSortOptions[0].Value)
 
 	log.Printf("===>當前登入帳號: %s", username)
-	c.HTML(http.StatusOK, "admin.tmpl", AdminOrderData{
-		Orders:   orders,
-		Statuses: models.OrderStatues,
-		Username: username,
-	})
+	h.renderHTML(c, http.StatusOK, "admin.tmpl", data)
+}
+
+// 查詢參數轉成 models.OrderSearch，格式錯誤時回傳的 error 可以直接顯示給使用者
+func orderSearchFromFilter(f OrderFilter) (models.OrderSearch, error) {
+	q := models.OrderSearch{
+		Search: strings.TrimSpace(f.Search),
+		Status: f.Status,
+		Page:   f.Page,
+		SortBy: "createdAt",
+		Desc:   true,
+	}
+	if q.Status != "" && !models.IsValidStatus(q.Status) {
+		return q, errors.New("無效的訂單狀態: " + q.Status)
+	}
+	if sort := f.Sort; sort != "" {
+		q.Desc = sort[0] == '-'
+		q.SortBy = strings.TrimPrefix(sort, "-")
+		if !slices.ContainsFunc(orderSortOptions, func(o SortOption) bool { return o.Value == sort }) {
+			return q, fmt.Errorf("%w: %s", models.ErrInvalidSort, sort)
+		}
+	}
+	var err error
+	if q.From, err = parseDateParam(f.From, false); err != nil {
+		return q, errors.New("起始日期格式錯誤: " + f.From)
+	}
+	if q.To, err = parseDateParam(f.To, true); err != nil {
+		return q, errors.New("結束日期格式錯誤: " + f.To)
+	}
+	return q, nil
+}
+
+// 保留目前的查詢條件，換到第 page 頁
+func (f OrderFilter) pageURL(page int) string {
+	values := url.Values{}
+	for key, value := range map[string]string{"q": f.Search, "status": f.Status, "from": f.From, "to": f.To, "sort": f.Sort} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	values.Set("page", strconv.Itoa(page))
+	return "/admin?" + values.Encode()
 }
 
 // 更新特定訂單
@@ -88,25 +237,70 @@ func (h *Handler) handleOrderPut(c *gin.Context) {
 	orderID := c.Param("id")
 	newStatus := c.PostForm("status")
 
-	// 更新狀態失敗
-	if err := h.orders.UpdateOrderStatus(orderID, newStatus); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	change := models.StatusChange{
+		To:     newStatus,
+		Actor:  models.ActorStaff,
+		Role:   currentRole(c),
+		UserID: sessionUserID(c), // 記錄是哪個 admin 改的
+		Note:   c.PostForm("note"),
+	}
+
+	// 更新狀態失敗 => 依錯誤種類回傳 404 / 409 / 422，其他才是 500
+	event, err := h.orders.UpdateOrderStatus(orderID, change)
+	if err != nil {
+		c.String(orderErrorCode(err), err.Error())
 		return
 	}
-	topic := "order:" + orderID
-	h.notificationManager.Publish(topic, "訂單狀態已更新成 : "+newStatus)
+	h.publishOrderEvent(c, orderStatusChangedEvent(event))
 
 	// 更新狀態成功
 	c.Redirect(http.StatusSeeOther, "/admin")
 
 }
 
-// 刪除特定訂單
+// 把 models 回傳的訂單錯誤轉成 HTTP 狀態碼
+// 404 => 訂單不存在
+// 422 => 狀態值本身不合法 (不在 OrderStatues 裡)
+// 409 => 狀態合法，但從目前狀態不能轉換過去；或是垃圾桶的訂單不能還原
+func orderErrorCode(err error) int {
+	var transitionErr *models.StatusTransitionError
+	switch {
+	case errors.Is(err, models.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrInvalidStatus):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &transitionErr):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrOrderNotDeleted), errors.Is(err, models.ErrOrderRestoreExpired):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// 刪除特定訂單 => 移到垃圾桶，保留期間內可以在 /admin/trash 還原
 func (h *Handler) handleOrderDelete(c *gin.Context) {
+	var form orderDeleteForm
+	if err := c.ShouldBind(&form); err != nil {
+		c.String(http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
 	orderID := c.Param("id")
-	if err := h.orders.DeleteOrder(orderID); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
+	if err := h.deleteOrder(c, orderID, form.Reason); err != nil {
+		c.String(orderErrorCode(err), err.Error())
 		return
 	}
+	h.publishOrderEvent(c, orderDeletedEvent(orderID))
 	c.Redirect(http.StatusSeeOther, "/admin")
 }
+
+// 單一訂單在後台表格中的一列 (HTML 片段)
+// admin.tmpl 收到 order.created / order.status_changed 事件後，用這個片段插入或取代該列，不需要重新整理整頁
+func (h *Handler) serveOrderRow(c *gin.Context) {
+	order, err := h.orders.FindOrder(c.Param("id"))
+	if err != nil {
+		c.String(orderErrorCode(err), err.Error())
+		return
+	}
+	h.renderHTML(c, http.StatusOK, "orderRow", OrderRow{Order: *order, Role: currentRole(c)})
+}
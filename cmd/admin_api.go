@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"pizza-tracker-go/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// React AdminDashboard.jsx 使用的 JSON API，功能與 admin.tmpl 相同
+
+// PATCH /api/admin/orders/:id 的 body
+type orderStatusPatch struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note" binding:"max=200"`
+}
+
+// http://localhost:8080/api/admin/dashboard
+// 登入者、所有狀態、各狀態可轉換的下一個狀態，以及最新一頁的訂單
+func (h *Handler) GetAdminDashboardJSON(c *gin.Context) {
+	page, err := h.orders.ListOrders(models.OrderQuery{Desc: true})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "獲取訂單資訊失敗")
+		return
+	}
+
+	user := currentUser(c)
+	role := user.Role
+	c.JSON(http.StatusOK, gin.H{
+		"username":    user.Username,
+		"role":        role,
+		"permissions": role.Permissions(),
+		"statuses":    models.OrderStatues,
+		"transitions": models.TransitionMap(models.ActorStaff, role),
+		"orders":      page.Orders,
+		"nextCursor":  page.NextCursor,
+	})
+}
+
+// GET /api/admin/orders?q=&status=&from=&to=&phone=&sort=-createdAt&cursor=&limit=
+// q => 關鍵字，比對訂單編號、姓名、電話、地址與品項備註
+// from / to 接受 RFC3339 或 2006-01-02，to 若只有日期則包含當天
+// sort 前面加 - 代表由新到舊
+func (h *Handler) listOrdersJSON(c *gin.Context) {
+	q := models.OrderQuery{
+		Status: c.Query("status"),
+		Phone:  c.Query("phone"),
+		Search: c.Query("q"),
+		Cursor: c.Query("cursor"),
+		SortBy: "createdAt",
+		Desc:   true,
+	}
+
+	if q.Status != "" && !models.IsValidStatus(q.Status) {
+		respondError(c, http.StatusBadRequest, "無效的訂單狀態: "+q.Status)
+		return
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		q.Desc = sort[0] == '-'
+		if q.Desc {
+			sort = sort[1:]
+		}
+		q.SortBy = sort
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			respondError(c, http.StatusBadRequest, "limit 必須是正整數")
+			return
+		}
+		q.Limit = n
+	}
+
+	var err error
+	if q.From, err = parseDateParam(c.Query("from"), false); err != nil {
+		respondError(c, http.StatusBadRequest, "from 格式錯誤: "+err.Error())
+		return
+	}
+	if q.To, err = parseDateParam(c.Query("to"), true); err != nil {
+		respondError(c, http.StatusBadRequest, "to 格式錯誤: "+err.Error())
+		return
+	}
+
+	page, err := h.orders.ListOrders(q)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) || errors.Is(err, models.ErrInvalidSort) {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "獲取訂單資訊失敗")
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GET /api/admin/orders/:id
+func (h *Handler) getOrderJSON(c *gin.Context) {
+	order, err := h.orders.FindOrder(c.Param("id"))
+	if err != nil {
+		respondError(c, orderErrorCode(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// PATCH /api/admin/orders/:id => 只允許更新狀態，規則與 handleOrderPut 相同
+func (h *Handler) patchOrderJSON(c *gin.Context) {
+	orderID := c.Param("id")
+
+	var body orderStatusPatch
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	change := models.StatusChange{
+		To:     body.Status,
+		Actor:  models.ActorStaff,
+		Role:   currentRole(c),
+		UserID: sessionUserID(c),
+		Note:   body.Note,
+	}
+	event, err := h.orders.UpdateOrderStatus(orderID, change)
+	if err != nil {
+		respondError(c, orderErrorCode(err), err.Error())
+		return
+	}
+	h.publishOrderEvent(c, orderStatusChangedEvent(event))
+
+	order, err := h.orders.FindOrder(orderID)
+	if err != nil {
+		respondError(c, orderErrorCode(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+// DELETE /api/admin/orders/:id，body: {"reason": "..."} (可省略) => 移到垃圾桶
+func (h *Handler) deleteOrderJSON(c *gin.Context) {
+	var body orderDeleteForm
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+	orderID := c.Param("id")
+	if err := h.deleteOrder(c, orderID, body.Reason); err != nil {
+		respondError(c, orderErrorCode(err), err.Error())
+		return
+	}
+	h.publishOrderEvent(c, orderDeletedEvent(orderID))
+	c.Status(http.StatusNoContent)
+}
+
+// 解析日期參數，空字串回傳 nil
+// endOfDay => 只給日期 (2006-01-02) 時，往後加一天，讓查詢條件 created_at < to 包含當天
+func parseDateParam(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+/*
+所有 /api 的錯誤都使用同一種格式，前端 / 手機 App 只需要處理一種結構:
+
+	{
+	  "error": {
+	    "code": "validation_failed",
+	    "message": "輸入資料驗證失敗",
+	    "fields": [ { "field": "sizes[0]", "rule": "valid_pizza_size", "message": "不是有效的尺寸" } ]
+	  }
+	}
+*/
+type apiErrorBody struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []fieldError `json:"fields,omitempty"`
+}
+
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// HTTP 狀態碼對應的錯誤代碼，前端可以用 code 判斷，不需要比對中文訊息
+var apiErrorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "unprocessable_entity",
+	http.StatusTooManyRequests:     "too_many_requests",
+	http.StatusInternalServerError: "internal_error",
+}
+
+// JSON API 統一的錯誤回應格式
+func respondError(c *gin.Context, status int, message string) {
+	code, ok := apiErrorCodes[status]
+	if !ok {
+		code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": apiErrorBody{Code: code, Message: message}})
+}
+
+// ShouldBind / ShouldBindJSON 的錯誤
+// validator.ValidationErrors => 422，逐一列出欄位錯誤；其他 (JSON 格式錯誤等) => 400
+func respondBindError(c *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		respondError(c, http.StatusBadRequest, "請求格式錯誤: "+err.Error())
+		return
+	}
+
+	fields := make([]fieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		fields = append(fields, fieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": apiErrorBody{
+		Code:    "validation_failed",
+		Message: "輸入資料驗證失敗",
+		Fields:  fields,
+	}})
+}
+
+// fe.Namespace() 會是 OrderReuqest.sizes[0]，去掉最外層的結構體名稱
+// 欄位名稱來自 RegisterCustomValidators 註冊的 json tag
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return ns
+}
+
+// 驗證規則 => 給使用者看的訊息
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "此欄位為必填"
+	case "min":
+		switch fe.Kind() {
+		case reflect.Slice:
+			return fmt.Sprintf("至少需要 %s 筆", fe.Param())
+		case reflect.Int, reflect.Int64:
+			return fmt.Sprintf("不能小於 %s", fe.Param())
+		}
+		return fmt.Sprintf("長度至少為 %s", fe.Param())
+	case "max":
+		switch fe.Kind() {
+		case reflect.Slice:
+			return fmt.Sprintf("最多 %s 筆", fe.Param())
+		case reflect.Int, reflect.Int64:
+			return fmt.Sprintf("不能大於 %s", fe.Param())
+		}
+		return fmt.Sprintf("長度不能超過 %s", fe.Param())
+	case "valid_pizza_size":
+		return "不是有效的尺寸"
+	case "valid_pizza_type":
+		return "不是有效的種類"
+	case "nefield":
+		return "不能與目前的密碼相同"
+	default:
+		return fmt.Sprintf("未通過 %s 驗證", fe.Tag())
+	}
+}
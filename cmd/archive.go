@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"pizza-tracker-go/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 封存訂單查詢 /admin/archive: 已結案的舊訂單由背景工作搬到封存資料表 (jobs.go)，只能查詢不能修改
+// 參數: q (訂單編號 / 姓名 / 電話)、from、to (建立日期)、cursor、limit
+
+type ArchiveData struct {
+	Orders   []models.ArchivedOrder
+	Search   string
+	From     string
+	To       string
+	NextURL  string // 下一頁的網址，空字串代表沒有下一頁
+	Username string
+	Error    string
+}
+
+func (h *Handler) ServeArchive(c *gin.Context) {
+	data := ArchiveData{
+		Search:   c.Query("q"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+		Username: currentUser(c).Username,
+	}
+	q, err := archiveQueryFromRequest(c)
+	if err != nil {
+		data.Error = err.Error()
+		h.renderHTML(c, http.StatusBadRequest, "archive.tmpl", data)
+		return
+	}
+	page, err := h.orders.SearchArchivedOrders(q)
+	if err != nil {
+		data.Error = "查詢封存訂單失敗"
+		h.renderHTML(c, archiveErrorCode(err), "archive.tmpl", data)
+		return
+	}
+	data.Orders = page.Orders
+	if page.NextCursor != "" {
+		next := url.Values{"cursor": {page.NextCursor}}
+		for _, key := range []string{"q", "from", "to", "limit"} {
+			if value := c.Query(key); value != "" {
+				next.Set(key, value)
+			}
+		}
+		data.NextURL = "/admin/archive?" + next.Encode()
+	}
+	h.renderHTML(c, http.StatusOK, "archive.tmpl", data)
+}
+
+// 查詢參數轉成 ArchiveQuery，格式錯誤時回傳的 error 可以直接顯示給使用者
+func archiveQueryFromRequest(c *gin.Context) (models.ArchiveQuery, error) {
+	q := models.ArchiveQuery{
+		Search: c.Query("q"),
+		Cursor: c.Query("cursor"),
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return q, errors.New("limit 必須是正整數")
+		}
+		q.Limit = n
+	}
+	var err error
+	if q.From, err = parseDateParam(c.Query("from"), false); err != nil {
+		return q, errors.New("from 格式錯誤: " + err.Error())
+	}
+	if q.To, err = parseDateParam(c.Query("to"), true); err != nil {
+		return q, errors.New("to 格式錯誤: " + err.Error())
+	}
+	return q, nil
+}
+
+// GET /api/admin/archive
+func (h *Handler) listArchivedOrdersJSON(c *gin.Context) {
+	q, err := archiveQueryFromRequest(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := h.orders.SearchArchivedOrders(q)
+	if err != nil {
+		respondError(c, archiveErrorCode(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GET /api/admin/archive/:id
+func (h *Handler) getArchivedOrderJSON(c *gin.Context) {
+	order, err := h.orders.GetArchivedOrder(c.Param("id"))
+	if err != nil {
+		respondError(c, archiveErrorCode(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+func archiveErrorCode(err error) int {
+	switch {
+	case errors.Is(err, models.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrInvalidCursor):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
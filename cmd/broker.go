@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+/*
+Broker => 訂閱 / 發布通知的介面，handler 只依賴這個介面，不關心訊息實際怎麼傳遞
+  - NotificationManager: 單一程序內的 map + channel，開發或單機部署使用
+  - RedisBroker: 透過 Redis 的 PUBLISH / SUBSCRIBE 在多台機器之間轉送，
+    A 機器上的 admin 更新狀態，連在 B 機器上的 SSE client 也能收到
+*/
+type Broker interface {
+	// ev.ID 由 Broker 依 topic 遞增產生，呼叫端只需要填 Type 與 Data
+	Publish(ctx context.Context, topic string, ev Event) error
+	// opts.LastEventID > 0 時回傳緩衝區中該 ID 之後的事件 (斷線期間漏掉的)，之後的新事件才會送進 client
+	// client 的緩衝區滿了會被踢掉並 close(client)，由瀏覽器帶著 Last-Event-ID 重連補送，而不是默默丟掉訊息
+	// 超過 SubscriberLimits 時回傳 ErrTooManySubscribers
+	Subscribe(ctx context.Context, topic string, client chan Event, opts SubscribeOptions) ([]Event, error)
+	// 取消訂閱後會 close(client)；已經被踢掉的 client 再取消訂閱不會出錯
+	Unsubscribe(ctx context.Context, topic string, client chan Event) error
+	// 目前的訂閱狀況，給後台監控使用
+	Stats() BrokerStats
+}
+
+var ErrTooManySubscribers = errors.New("訂閱數已達上限")
+
+type SubscribeOptions struct {
+	LastEventID uint64 // 瀏覽器重連時帶的 Last-Event-ID，0 代表第一次連線
+	ClientIP    string // 用來計算同一個 IP 的訂閱數，空字串不限制
+}
+
+// 訂閱數上限，0 代表不限制
+// 使用 RedisBroker 時是每台機器各自計算
+type SubscriberLimits struct {
+	PerTopic int // 同一個 topic (例如同一筆訂單) 最多幾個連線
+	PerIP    int // 同一個 IP 最多幾個連線 (所有 topic 合計)
+}
+
+type BrokerStats struct {
+	Subscribers  int            `json:"subscribers"`  // 目前的連線總數
+	Topics       map[string]int `json:"topics"`       // 每個 topic 的連線數
+	ClientIPs    int            `json:"clientIps"`    // 有連線的 IP 數
+	ReplayTopics int            `json:"replayTopics"` // 保留補送緩衝區的 topic 數
+	Evicted      uint64         `json:"evicted"`      // 因為來不及接收被踢掉的次數
+	Rejected     uint64         `json:"rejected"`     // 因為超過上限被拒絕的次數
+}
+
+const (
+	BrokerMemory = "memory"
+	BrokerRedis  = "redis"
+)
+
+// 依 Config.NotifyBackend 建立對應的 Broker
+func newBroker(cfg Config) (Broker, error) {
+	switch cfg.NotifyBackend {
+	case "", BrokerMemory:
+		return NewNotificationManager(cfg.subscriberLimits()), nil
+	case BrokerRedis:
+		return NewRedisBroker(cfg.RedisAddr, cfg.RedisPassword, cfg.subscriberLimits())
+	default:
+		return nil, fmt.Errorf("未知的通知後端: %s", cfg.NotifyBackend)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	redisDialTimeout    = 5 * time.Second
+	redisPublishTimeout = 5 * time.Second
+	redisMaxBackoff     = 30 * time.Second
+)
+
+/*
+RedisBroker => 透過 Redis pub/sub 在多台機器之間轉送通知
+
+	PUBLISH 用一條連線，SUBSCRIBE 用另一條連線 (Redis 規定訂閱中的連線不能下其他指令)
+	本機的 SSE client 仍然交給 NotificationManager 管理，Redis 只負責把訊息送到每一台機器:
+
+	admin (機器A) --PUBLISH--> Redis --message--> 機器A、機器B 的 receiveLoop --> local.Publish --> SSE client
+
+只有本機有人訂閱的 topic 才會向 Redis SUBSCRIBE，最後一個 client 離開時 UNSUBSCRIBE
+
+事件 ID 與補送用的緩衝區都放在 Redis，client 重連到哪一台機器都能補收漏掉的事件:
+
+	sse:seq:<topic>    => INCR 產生的事件 ID，所有機器共用同一組序號
+	sse:replay:<topic> => 最近 replayBufferSize 筆事件 (JSON)，replayTTL 後過期
+	PUBLISH 的內容也是同樣的 JSON: {"id":1,"type":"order.created","data":"..."}
+
+配號、寫入緩衝區與 PUBLISH 由 redisPublishScript 一次執行，多台機器同時發布也不會讓 ID 順序錯亂
+(streamSSE / WebSocket 會丟掉 ID 不大於上一筆的事件，順序錯了事件就會消失)
+*/
+type RedisBroker struct {
+	addr     string
+	password string
+	local    *NotificationManager
+
+	pubMu   sync.Mutex
+	pubConn *respConn // 一般指令 (PUBLISH / INCR / LRANGE ...) 共用這條連線
+
+	subMu   sync.Mutex
+	subConn *respConn
+	topics  map[string]int                  // 本機每個 topic 的訂閱數
+	ready   map[string]*redisSubscription   // 每個 topic 目前這次 SUBSCRIBE 的確認狀態
+	acks    map[string][]*redisSubscription // 已送出、還沒收到確認的 SUBSCRIBE，Redis 依送出的順序回覆
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// 啟動時先建立訂閱用的連線，連不上就直接回傳錯誤，讓程式啟動失敗而不是默默收不到通知
+// limits 交給本機的 NotificationManager 計算，每台機器各自限制
+func NewRedisBroker(addr, password string, limits SubscriberLimits) (*RedisBroker, error) {
+	conn, err := dialRESP(addr, password, redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	b := &RedisBroker{
+		addr:     addr,
+		password: password,
+		local:    NewNotificationManager(limits),
+		subConn:  conn,
+		topics:   make(map[string]int),
+		ready:    make(map[string]*redisSubscription),
+		acks:     make(map[string][]*redisSubscription),
+		done:     make(chan struct{}),
+	}
+	go b.receiveLoop(conn)
+	return b, nil
+}
+
+func replayKey(topic string) string { return "sse:replay:" + topic }
+func seqKey(topic string) string    { return "sse:seq:" + topic }
+
+/*
+redisPublishScript => 在 Redis 裡一次完成發布，執行期間不會穿插其他機器的指令:
+
+	KEYS[1] = sse:seq:<topic>、KEYS[2] = sse:replay:<topic>
+	ARGV[1] = topic、ARGV[2] = 不含 id 的事件 JSON、ARGV[3] = replayBufferSize、ARGV[4] = 過期秒數
+	回傳配到的事件 ID
+*/
+const redisPublishScript = `local id = redis.call('INCR', KEYS[1])
+local payload = '{"id":' .. id .. ',' .. string.sub(ARGV[2], 2)
+redis.call('RPUSH', KEYS[2], payload)
+redis.call('LTRIM', KEYS[2], -tonumber(ARGV[3]), -1)
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+redis.call('PUBLISH', ARGV[1], payload)
+return id`
+
+// 一次 SUBSCRIBE 的確認狀態，receiveLoop 收到 Redis 的 subscribe 回覆後 close(ready)
+type redisSubscription struct {
+	ready chan struct{}
+	once  sync.Once
+}
+
+func newRedisSubscription() *redisSubscription {
+	return &redisSubscription{ready: make(chan struct{})}
+}
+
+func (s *redisSubscription) confirm() { s.once.Do(func() { close(s.ready) }) }
+
+// 等 Redis 確認 SUBSCRIBE 之後才讀取緩衝區，之後發布的事件一定會即時收到；
+// 兩者重疊的事件由 streamSSE / WebSocket 依 ID 略過
+func (b *RedisBroker) Subscribe(ctx context.Context, topic string, client chan Event, opts SubscribeOptions) ([]Event, error) {
+	// 本機的緩衝區只有這台機器有人訂閱時才會收到事件，補送一律以 Redis 為準
+	lastEventID := opts.LastEventID
+	opts.LastEventID = 0
+	if _, err := b.local.Subscribe(ctx, topic, client, opts); err != nil {
+		return nil, err
+	}
+
+	b.subMu.Lock()
+	b.topics[topic]++
+	if b.topics[topic] == 1 {
+		sub := newRedisSubscription()
+		b.ready[topic] = sub
+		b.acks[topic] = append(b.acks[topic], sub)
+		// 寫入失敗代表連線斷了，receiveLoop 重新連線後會把 topics 全部重新訂閱
+		if err := b.subConn.writeCommand("SUBSCRIBE", topic); err != nil {
+			slog.Warn("Redis SUBSCRIBE 失敗，等待重新連線", "topic", topic, "error", err)
+		}
+	}
+	sub := b.ready[topic]
+	b.subMu.Unlock()
+
+	// 等不到確認 (Redis 斷線、請求結束) 時仍然回傳，訂閱已經登記，重新連線後會重新訂閱；
+	// 呼叫端照常 Unsubscribe 即可
+	select {
+	case <-sub.ready:
+	case <-ctx.Done():
+	case <-b.done:
+	case <-time.After(redisDialTimeout):
+		slog.Warn("等待 Redis SUBSCRIBE 確認逾時", "topic", topic)
+	}
+
+	if lastEventID == 0 {
+		return nil, nil
+	}
+	reply, err := b.command(ctx, "LRANGE", replayKey(topic), "0", "-1")
+	if err != nil {
+		// 補送失敗不影響之後的即時通知
+		slog.Warn("讀取 Redis 事件緩衝區失敗", "topic", topic, "error", err)
+		return nil, nil
+	}
+	items, _ := reply.([]any)
+	events := make([]Event, 0, len(items))
+	for _, item := range items {
+		raw, _ := item.(string)
+		var ev Event
+		if err := json.Unmarshal([]byte(raw), &ev); err != nil {
+			continue
+		}
+		events = append(events, ev)
+	}
+	return eventsAfter(events, lastEventID), nil
+}
+
+func (b *RedisBroker) Unsubscribe(ctx context.Context, topic string, client chan Event) error {
+	if err := b.local.Unsubscribe(ctx, topic, client); err != nil {
+		return err
+	}
+
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+	b.topics[topic]--
+	if b.topics[topic] <= 0 {
+		delete(b.topics, topic)
+		delete(b.ready, topic)
+		if err := b.subConn.writeCommand("UNSUBSCRIBE", topic); err != nil {
+			slog.Warn("Redis UNSUBSCRIBE 失敗", "topic", topic, "error", err)
+		}
+	}
+	return nil
+}
+
+// 訊息不直接送給本機 client，而是交給 Redis，由 receiveLoop 收到後再轉送，確保每台機器的行為一致
+// ID 由 redisPublishScript 在 Redis 裡配發，這裡送出的 JSON 不含 id
+func (b *RedisBroker) Publish(ctx context.Context, topic string, ev Event) error {
+	body, err := json.Marshal(struct {
+		Type string `json:"type,omitempty"`
+		Data string `json:"data"`
+	}{ev.Type, ev.Data})
+	if err != nil {
+		return err
+	}
+	reply, err := b.command(ctx, "EVAL", redisPublishScript, "2", seqKey(topic), replayKey(topic),
+		topic, string(body), strconv.Itoa(replayBufferSize), strconv.Itoa(int(replayTTL.Seconds())))
+	if err != nil {
+		return err
+	}
+	if _, ok := reply.(int64); !ok {
+		return fmt.Errorf("redis: EVAL 回覆格式錯誤 %v", reply)
+	}
+	return nil
+}
+
+// 在一般指令連線上執行一個指令並讀取回覆
+// 連線可能因為閒置被 Redis 或中間的網路設備關閉，失敗時重新連線再試一次
+func (b *RedisBroker) command(ctx context.Context, args ...string) (any, error) {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var reply any
+		if reply, err = b.commandOnce(ctx, args); err == nil {
+			return reply, nil
+		}
+		if _, isReply := err.(respError); isReply {
+			return nil, err // Redis 回覆的錯誤，重試也不會成功
+		}
+		if b.pubConn != nil {
+			b.pubConn.Close()
+			b.pubConn = nil
+		}
+	}
+	return nil, err
+}
+
+func (b *RedisBroker) commandOnce(ctx context.Context, args []string) (any, error) {
+	if b.pubConn == nil {
+		conn, err := dialRESP(b.addr, b.password, redisDialTimeout)
+		if err != nil {
+			return nil, err
+		}
+		b.pubConn = conn
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisPublishTimeout)
+	}
+	b.pubConn.conn.SetDeadline(deadline)
+	defer b.pubConn.conn.SetDeadline(time.Time{})
+
+	if err := b.pubConn.writeCommand(args...); err != nil {
+		return nil, err
+	}
+	return b.pubConn.readReply()
+}
+
+// 持續讀取訂閱連線上的訊息，斷線時以指數退避重新連線並重新訂閱
+func (b *RedisBroker) receiveLoop(conn *respConn) {
+	for {
+		reply, err := conn.readReply()
+		if err != nil {
+			conn.Close()
+			if conn = b.reconnect(err); conn == nil {
+				return // 已經 Close
+			}
+			continue
+		}
+
+		// 推播格式: ["message", topic, payload]；SUBSCRIBE 的確認: ["subscribe", topic, 數量]
+		items, ok := reply.([]any)
+		if !ok || len(items) != 3 {
+			continue
+		}
+		topic, _ := items[1].(string)
+		if items[0] == "subscribe" {
+			b.confirmSubscribe(topic)
+			continue
+		}
+		if items[0] != "message" {
+			continue
+		}
+		payload, _ := items[2].(string)
+
+		var ev Event
+		if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+			slog.Warn("無法解析 Redis 通知", "topic", topic, "error", err)
+			continue
+		}
+		b.local.deliver(topic, ev)
+	}
+}
+
+// 確認最早送出、還沒確認的那一次 SUBSCRIBE
+func (b *RedisBroker) confirmSubscribe(topic string) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+	pending := b.acks[topic]
+	if len(pending) == 0 {
+		return
+	}
+	pending[0].confirm()
+	if len(pending) == 1 {
+		delete(b.acks, topic)
+	} else {
+		b.acks[topic] = pending[1:]
+	}
+}
+
+func (b *RedisBroker) reconnect(cause error) *respConn {
+	backoff := 500 * time.Millisecond
+	for {
+		select {
+		case <-b.done:
+			return nil
+		default:
+		}
+		slog.Warn("Redis 訂閱連線中斷，準備重新連線", "error", cause, "retryIn", backoff)
+
+		select {
+		case <-b.done:
+			return nil
+		case <-time.After(backoff):
+		}
+
+		conn, err := dialRESP(b.addr, b.password, redisDialTimeout)
+		if err != nil {
+			cause = err
+			backoff = min(backoff*2, redisMaxBackoff)
+			continue
+		}
+
+		b.subMu.Lock()
+		b.subConn = conn
+		// 舊連線上還沒確認的 SUBSCRIBE 不會再有回覆，改等這次重新訂閱的確認
+		b.acks = make(map[string][]*redisSubscription, len(b.topics))
+		topics := make([]string, 0, len(b.topics))
+		for topic := range b.topics {
+			topics = append(topics, topic)
+			b.acks[topic] = []*redisSubscription{b.ready[topic]}
+		}
+		if len(topics) > 0 {
+			err = conn.writeCommand(append([]string{"SUBSCRIBE"}, topics...)...)
+		}
+		b.subMu.Unlock()
+
+		if err != nil {
+			conn.Close()
+			cause = err
+			continue
+		}
+		slog.Info("Redis 訂閱連線已恢復", "topics", len(topics))
+		return conn
+	}
+}
+
+// 訂閱數都記在本機的 NotificationManager
+func (b *RedisBroker) Stats() BrokerStats {
+	return b.local.Stats()
+}
+
+// 關閉所有連線，receiveLoop 會隨之結束
+func (b *RedisBroker) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.done)
+		b.subMu.Lock()
+		b.subConn.Close()
+		b.subMu.Unlock()
+		b.pubMu.Lock()
+		if b.pubConn != nil {
+			b.pubConn.Close()
+		}
+		b.pubMu.Unlock()
+	})
+	return nil
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+fakeRedis => 測試用的 RESP server，只實作 RedisBroker 會用到的指令:
+AUTH / EVAL (只認得 redisPublishScript) / LRANGE / SUBSCRIBE / UNSUBSCRIBE
+跑在同一個程序裡，不需要安裝 Redis；dropConnections 模擬 Redis 重新啟動或網路中斷
+*/
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	clients  map[*fakeRedisClient]bool
+	counters map[string]int64
+	lists    map[string][]string
+	subs     map[string]map[*fakeRedisClient]bool
+
+	// 不是 nil 時，收到 SUBSCRIBE 會先送一個值到 subscribeHeld，再等 releaseSubscribe 才處理
+	subscribeHeld    chan struct{}
+	releaseSubscribe chan struct{}
+}
+
+type fakeRedisClient struct {
+	conn net.Conn
+	wmu  sync.Mutex // PUBLISH 會從其他連線的 goroutine 寫入訂閱中的連線
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		ln:       ln,
+		password: password,
+		clients:  map[*fakeRedisClient]bool{},
+		counters: map[string]int64{},
+		lists:    map[string][]string{},
+		subs:     map[string]map[*fakeRedisClient]bool{},
+	}
+	go f.acceptLoop()
+	t.Cleanup(func() {
+		ln.Close()
+		f.dropConnections()
+	})
+	return f
+}
+
+func (f *fakeRedis) addr() string { return f.ln.Addr().String() }
+
+func (f *fakeRedis) acceptLoop() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		client := &fakeRedisClient{conn: conn}
+		f.mu.Lock()
+		f.clients[client] = true
+		f.mu.Unlock()
+		go f.serve(client)
+	}
+}
+
+// 關閉所有連線，已經訂閱的 topic 一併清掉 (跟 Redis 重新啟動一樣)
+func (f *fakeRedis) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for client := range f.clients {
+		client.conn.Close()
+	}
+	f.clients = map[*fakeRedisClient]bool{}
+	f.subs = map[string]map[*fakeRedisClient]bool{}
+}
+
+func (f *fakeRedis) subscribers(topic string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs[topic])
+}
+
+func (f *fakeRedis) serve(client *fakeRedisClient) {
+	defer f.disconnect(client)
+	// 指令的格式跟 array 回覆相同，直接用 respConn 解析
+	rc := &respConn{conn: client.conn, r: bufio.NewReader(client.conn)}
+	authed := f.password == ""
+	for {
+		reply, err := rc.readReply()
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		if len(args) == 0 {
+			client.write("-ERR empty command\r\n")
+			continue
+		}
+
+		name := strings.ToUpper(args[0])
+		if name == "AUTH" {
+			if len(args) == 2 && args[1] == f.password {
+				authed = true
+				client.write("+OK\r\n")
+			} else {
+				client.write("-WRONGPASS invalid password\r\n")
+			}
+			continue
+		}
+		if !authed {
+			client.write("-NOAUTH Authentication required\r\n")
+			continue
+		}
+		if name == "SUBSCRIBE" && f.releaseSubscribe != nil {
+			f.subscribeHeld <- struct{}{}
+			<-f.releaseSubscribe
+		}
+		f.handle(client, name, args[1:])
+	}
+}
+
+func (f *fakeRedis) disconnect(client *fakeRedisClient) {
+	client.conn.Close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.clients, client)
+	for _, clients := range f.subs {
+		delete(clients, client)
+	}
+}
+
+func (f *fakeRedis) handle(client *fakeRedisClient, name string, args []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch name {
+	case "EVAL":
+		if len(args) != 8 || args[0] != redisPublishScript || args[1] != "2" {
+			client.write("-ERR unknown script\r\n")
+			return
+		}
+		// 跟 Redis 執行 script 一樣，整段在 f.mu 裡完成，不會穿插其他連線的指令；
+		// 測試時間很短，EXPIRE 不會真的過期，直接省略
+		seq, replay, topic, body, size := args[2], args[3], args[4], args[5], args[6]
+		f.counters[seq]++
+		id := f.counters[seq]
+		payload := `{"id":` + strconv.FormatInt(id, 10) + `,` + body[1:]
+		f.lists[replay] = listRange(append(f.lists[replay], payload), "-"+size, "-1")
+		for sub := range f.subs[topic] {
+			sub.write(respArray("message", topic, payload))
+		}
+		client.write(respInt(id))
+	case "LRANGE":
+		client.write(respArray(listRange(f.lists[args[0]], args[1], args[2])...))
+	case "SUBSCRIBE":
+		for _, topic := range args {
+			if f.subs[topic] == nil {
+				f.subs[topic] = map[*fakeRedisClient]bool{}
+			}
+			f.subs[topic][client] = true
+			client.write("*3\r\n" + respBulk("subscribe") + respBulk(topic) + respInt(1))
+		}
+	case "UNSUBSCRIBE":
+		for _, topic := range args {
+			delete(f.subs[topic], client)
+			client.write("*3\r\n" + respBulk("unsubscribe") + respBulk(topic) + respInt(0))
+		}
+	default:
+		client.write("-ERR unknown command '" + name + "'\r\n")
+	}
+}
+
+func (c *fakeRedisClient) write(s string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.Write([]byte(s))
+}
+
+func respInt(n int64) string { return ":" + strconv.FormatInt(n, 10) + "\r\n" }
+
+func respBulk(s string) string { return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n" }
+
+func respArray(items ...string) string {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(items)) + "\r\n")
+	for _, item := range items {
+		b.WriteString(respBulk(item))
+	}
+	return b.String()
+}
+
+// LRANGE / LTRIM 的索引規則: 包含 stop，負數從尾端算起
+func listRange(list []string, start, stop string) []string {
+	from, _ := strconv.Atoi(start)
+	to, _ := strconv.Atoi(stop)
+	if from < 0 {
+		from = max(len(list)+from, 0)
+	}
+	if to < 0 {
+		to = len(list) + to
+	}
+	to = min(to, len(list)-1)
+	if from > to {
+		return nil
+	}
+	return append([]string(nil), list[from:to+1]...)
+}
+
+func newTestRedisBroker(t *testing.T, addr, password string) *RedisBroker {
+	t.Helper()
+	b, err := NewRedisBroker(addr, password, SubscriberLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+// UNSUBSCRIBE 與斷線後的重新訂閱是非同步的，等 fake server 真的收到再檢查
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待逾時: %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receiveEvent(t *testing.T, client chan Event) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-client:
+		if !ok {
+			t.Fatal("client 已經被關閉")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("等不到通知")
+	}
+	return Event{}
+}
+
+func TestRedisBrokerPublishAcrossInstances(t *testing.T) {
+	fake := newFakeRedis(t, "secret")
+	publisher := newTestRedisBroker(t, fake.addr(), "secret")
+	subscriber := newTestRedisBroker(t, fake.addr(), "secret")
+	ctx := context.Background()
+
+	client := make(chan Event, 10)
+	if _, err := subscriber.Subscribe(ctx, "order:abc", client, SubscribeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// Subscribe 回傳時 Redis 已經確認訂閱，不需要等待
+	if n := fake.subscribers("order:abc"); n != 1 {
+		t.Fatalf("Subscribe 回傳時 Redis 上的訂閱數 = %d", n)
+	}
+
+	if err := publisher.Publish(ctx, "order:abc", Event{Type: EventOrderStatusChanged, Data: "製作中"}); err != nil {
+		t.Fatal(err)
+	}
+	ev := receiveEvent(t, client)
+	if ev.ID != 1 || ev.Type != EventOrderStatusChanged || ev.Data != "製作中" {
+		t.Fatalf("收到的事件 = %+v", ev)
+	}
+
+	// 最後一個 client 離開時向 Redis UNSUBSCRIBE，並 close(client)
+	if err := subscriber.Unsubscribe(ctx, "order:abc", client); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "UNSUBSCRIBE order:abc", func() bool { return fake.subscribers("order:abc") == 0 })
+	if _, ok := <-client; ok {
+		t.Fatal("取消訂閱後 client 應該被關閉")
+	}
+}
+
+func TestRedisBrokerWrongPassword(t *testing.T) {
+	fake := newFakeRedis(t, "secret")
+	if _, err := NewRedisBroker(fake.addr(), "wrong", SubscriberLimits{}); err == nil {
+		t.Fatal("密碼錯誤時應該無法建立 RedisBroker")
+	}
+}
+
+func TestRedisBrokerReconnectResubscribes(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	publisher := newTestRedisBroker(t, fake.addr(), "")
+	subscriber := newTestRedisBroker(t, fake.addr(), "")
+	ctx := context.Background()
+
+	first, second := make(chan Event, 10), make(chan Event, 10)
+	for topic, client := range map[string]chan Event{"order:1": first, "admin:new_orders": second} {
+		if _, err := subscriber.Subscribe(ctx, topic, client, SubscribeOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := publisher.Publish(ctx, "order:1", Event{Data: "before"}); err != nil {
+		t.Fatal(err)
+	}
+	receiveEvent(t, first)
+
+	// 兩台機器的連線都被切斷: 訂閱端要自己重新連線並重新訂閱，發布端下一個指令重新連線
+	fake.dropConnections()
+	waitFor(t, "重新訂閱", func() bool { return fake.subscribers("order:1") == 1 && fake.subscribers("admin:new_orders") == 1 })
+
+	if err := publisher.Publish(ctx, "order:1", Event{Data: "after"}); err != nil {
+		t.Fatalf("重新連線後發布失敗: %v", err)
+	}
+	if err := publisher.Publish(ctx, "admin:new_orders", Event{Data: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := receiveEvent(t, first); ev.ID != 2 || ev.Data != "after" {
+		t.Fatalf("order:1 收到的事件 = %+v", ev)
+	}
+	if ev := receiveEvent(t, second); ev.ID != 1 || ev.Data != "new" {
+		t.Fatalf("admin:new_orders 收到的事件 = %+v", ev)
+	}
+}
+
+func TestRedisBrokerReplayFromRedis(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	publisher := newTestRedisBroker(t, fake.addr(), "")
+	subscriber := newTestRedisBroker(t, fake.addr(), "")
+	ctx := context.Background()
+
+	// 訂閱端還沒有人訂閱時發布，事件只存在 Redis 的緩衝區
+	for i := 1; i <= replayBufferSize+5; i++ {
+		if err := publisher.Publish(ctx, "order:replay", Event{Data: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 第一次連線 (沒有 Last-Event-ID) 不補送
+	fresh := make(chan Event, 10)
+	backlog, err := subscriber.Subscribe(ctx, "order:replay", fresh, SubscribeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backlog) != 0 {
+		t.Fatalf("沒有 Last-Event-ID 時不應該補送，收到 %d 筆", len(backlog))
+	}
+
+	// 重連時只補送 Last-Event-ID 之後、還在緩衝區裡 (最近 replayBufferSize 筆) 的事件
+	lastEventID := uint64(replayBufferSize + 2)
+	reconnect := make(chan Event, 10)
+	backlog, err = subscriber.Subscribe(ctx, "order:replay", reconnect, SubscribeOptions{LastEventID: lastEventID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backlog) != 3 {
+		t.Fatalf("補送 %d 筆，預期 3 筆", len(backlog))
+	}
+	for i, ev := range backlog {
+		if want := lastEventID + uint64(i) + 1; ev.ID != want || ev.Data != strconv.FormatUint(want, 10) {
+			t.Fatalf("第 %d 筆補送的事件 = %+v，預期 ID %d", i, ev, want)
+		}
+	}
+
+	fake.mu.Lock()
+	buffered := len(fake.lists[replayKey("order:replay")])
+	fake.mu.Unlock()
+	if buffered != replayBufferSize {
+		t.Fatalf("Redis 緩衝區有 %d 筆，應該只保留 %d 筆", buffered, replayBufferSize)
+	}
+}
+
+// 兩台機器同時發布同一個 topic: 訂閱端收到的 ID 與緩衝區的順序都必須遞增
+func TestRedisBrokerConcurrentPublishersKeepOrder(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	subscriber := newTestRedisBroker(t, fake.addr(), "")
+	ctx := context.Background()
+
+	const perPublisher = 50
+	client := make(chan Event, 2*perPublisher)
+	if _, err := subscriber.Subscribe(ctx, "order:race", client, SubscribeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*perPublisher)
+	for range 2 {
+		publisher := newTestRedisBroker(t, fake.addr(), "")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perPublisher {
+				errs <- publisher.Publish(ctx, "order:race", Event{Data: strconv.Itoa(i)})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for want := uint64(1); want <= 2*perPublisher; want++ {
+		if ev := receiveEvent(t, client); ev.ID != want {
+			t.Fatalf("收到的第 %d 筆事件 ID = %d", want, ev.ID)
+		}
+	}
+	backlog, err := subscriber.Subscribe(ctx, "order:race", make(chan Event, 1), SubscribeOptions{LastEventID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backlog) != replayBufferSize {
+		t.Fatalf("補送 %d 筆，預期 %d 筆", len(backlog), replayBufferSize)
+	}
+	for i := 1; i < len(backlog); i++ {
+		if backlog[i].ID != backlog[i-1].ID+1 {
+			t.Fatalf("緩衝區的順序錯誤: %d 之後是 %d", backlog[i-1].ID, backlog[i].ID)
+		}
+	}
+}
+
+// Redis 確認 SUBSCRIBE 之前 Subscribe 不會回傳，也還不會讀取緩衝區，
+// 這段期間發布的事件會出現在補送的事件裡，不會遺漏
+func TestRedisBrokerSubscribeWaitsForConfirmation(t *testing.T) {
+	fake := newFakeRedis(t, "")
+	publisher := newTestRedisBroker(t, fake.addr(), "")
+	subscriber := newTestRedisBroker(t, fake.addr(), "")
+	ctx := context.Background()
+
+	if err := publisher.Publish(ctx, "order:gap", Event{Data: "seen"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.subscribeHeld = make(chan struct{})
+	fake.releaseSubscribe = make(chan struct{})
+	type result struct {
+		backlog []Event
+		err     error
+	}
+	done := make(chan result, 1)
+	client := make(chan Event, 10)
+	go func() {
+		backlog, err := subscriber.Subscribe(ctx, "order:gap", client, SubscribeOptions{LastEventID: 1})
+		done <- result{backlog, err}
+	}()
+
+	<-fake.subscribeHeld
+	if err := publisher.Publish(ctx, "order:gap", Event{Data: "in between"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+		t.Fatal("Redis 確認 SUBSCRIBE 之前 Subscribe 不應該回傳")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(fake.releaseSubscribe)
+
+	res := <-done
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if len(res.backlog) != 1 || res.backlog[0].ID != 2 || res.backlog[0].Data != "in between" {
+		t.Fatalf("補送的事件 = %+v", res.backlog)
+	}
+	if err := publisher.Publish(ctx, "order:gap", Event{Data: "live"}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := receiveEvent(t, client); ev.ID != 3 {
+		t.Fatalf("即時收到的事件 = %+v", ev)
+	}
+}
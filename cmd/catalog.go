@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"pizza-tracker-go/internal/models"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 後台菜單管理 /admin/catalog，商品 (products) 與尺寸 (sizes) 共用同一組 handler
+// :kind => products / sizes
+
+type CatalogData struct {
+	Sections []CatalogSection
+	Prices   PriceGrid
+	Username string
+	Error    string
+}
+
+// 價格表 => 每一列是一個商品，每一欄是一個尺寸
+type PriceGrid struct {
+	Sizes []models.ProductSize
+	Rows  []PriceRow
+}
+
+type PriceRow struct {
+	Product models.Product
+	Cells   []PriceCell
+}
+
+// Key => 表單欄位名稱 price[商品ID:尺寸ID]；Value => 目前價格 (未設定為空字串)
+type PriceCell struct {
+	Key   string
+	Value string
+}
+
+// 商品與尺寸在頁面上的呈現方式相同，轉成同一種結構讓 catalog.tmpl 共用一段模板
+type CatalogSection struct {
+	Title string
+	Kind  string // products / sizes，組成表單的 action 路徑
+	Items []CatalogItem
+}
+
+type CatalogItem struct {
+	ID uint
+	models.CatalogEntry
+}
+
+// 新增 / 編輯品項的表單
+// active 是 checkbox，沒勾選時不會送出，綁定結果為 false
+type catalogForm struct {
+	Name        string `form:"name" binding:"required,max=100"`
+	Description string `form:"description" binding:"max=500"`
+	SortOrder   int    `form:"sort_order"`
+	Active      bool   `form:"active"`
+}
+
+func (f catalogForm) entry() models.CatalogEntry {
+	return models.CatalogEntry{
+		Name:        f.Name,
+		Description: f.Description,
+		SortOrder:   f.SortOrder,
+		Active:      f.Active,
+	}
+}
+
+func (h *Handler) ServeCatalog(c *gin.Context) {
+	h.renderCatalog(c, http.StatusOK, "")
+}
+
+// 顯示菜單管理頁，errMsg 不為空時顯示在頁面上方
+func (h *Handler) renderCatalog(c *gin.Context, status int, errMsg string) {
+	products, err := h.catalog.ListProducts()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取菜單失敗")
+		return
+	}
+	sizes, err := h.catalog.ListSizes()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取菜單失敗")
+		return
+	}
+	productItems := make([]CatalogItem, len(products))
+	for i, p := range products {
+		productItems[i] = CatalogItem{ID: p.ID, CatalogEntry: p.CatalogEntry}
+	}
+	sizeItems := make([]CatalogItem, len(sizes))
+	for i, s := range sizes {
+		sizeItems[i] = CatalogItem{ID: s.ID, CatalogEntry: s.CatalogEntry}
+	}
+
+	prices, err := h.catalog.ListPrices()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取菜單失敗")
+		return
+	}
+
+	h.renderHTML(c, status, "catalog.tmpl", CatalogData{
+		Prices: buildPriceGrid(products, sizes, prices),
+		Sections: []CatalogSection{
+			{Title: "種類", Kind: "products", Items: productItems},
+			{Title: "數量 / 尺寸", Kind: "sizes", Items: sizeItems},
+		},
+		Username: GetSession(c, "username"),
+		Error:    errMsg,
+	})
+}
+
+func (h *Handler) handleCatalogCreate(c *gin.Context) {
+	var form catalogForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderCatalog(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	var err error
+	switch c.Param("kind") {
+	case "products":
+		_, err = h.catalog.CreateProduct(form.entry())
+	case "sizes":
+		_, err = h.catalog.CreateSize(form.entry())
+	default:
+		c.String(http.StatusNotFound, "未知的品項類別")
+		return
+	}
+	if err != nil {
+		h.renderCatalog(c, catalogErrorCode(err), err.Error())
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/catalog")
+}
+
+func (h *Handler) handleCatalogUpdate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "無效的品項ID")
+		return
+	}
+	var form catalogForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderCatalog(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		return
+	}
+
+	switch c.Param("kind") {
+	case "products":
+		err = h.catalog.UpdateProduct(uint(id), form.entry())
+	case "sizes":
+		err = h.catalog.UpdateSize(uint(id), form.entry())
+	default:
+		c.String(http.StatusNotFound, "未知的品項類別")
+		return
+	}
+	if err != nil {
+		h.renderCatalog(c, catalogErrorCode(err), err.Error())
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/catalog")
+}
+
+func (h *Handler) handleCatalogDelete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "無效的品項ID")
+		return
+	}
+
+	switch c.Param("kind") {
+	case "products":
+		err = h.catalog.DeleteProduct(uint(id))
+	case "sizes":
+		err = h.catalog.DeleteSize(uint(id))
+	default:
+		c.String(http.StatusNotFound, "未知的品項類別")
+		return
+	}
+	if err != nil {
+		h.renderCatalog(c, catalogErrorCode(err), err.Error())
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/catalog")
+}
+
+// 404 => 品項不存在；409 => 名稱重複
+func catalogErrorCode(err error) int {
+	switch {
+	case errors.Is(err, models.ErrCatalogNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrCatalogDuplicate):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func buildPriceGrid(products []models.Product, sizes []models.ProductSize, prices []models.ProductPrice) PriceGrid {
+	current := make(map[string]int64, len(prices))
+	for _, p := range prices {
+		current[fmt.Sprintf("%d:%d", p.ProductID, p.ProductSizeID)] = p.Price
+	}
+
+	grid := PriceGrid{Sizes: sizes, Rows: make([]PriceRow, len(products))}
+	for i, product := range products {
+		row := PriceRow{Product: product, Cells: make([]PriceCell, len(sizes))}
+		for j, size := range sizes {
+			key := fmt.Sprintf("%d:%d", product.ID, size.ID)
+			row.Cells[j] = PriceCell{Key: key}
+			if price, ok := current[key]; ok {
+				row.Cells[j].Value = strings.ReplaceAll(formatMoney(price), ",", "")
+			}
+		}
+		grid.Rows[i] = row
+	}
+	return grid
+}
+
+// POST /admin/catalog/prices => 一次儲存整張價格表
+// 欄位 price[商品ID:尺寸ID]，留空代表此組合不販售
+// 先檢查每一格，全部正確才在同一個 transaction 裡寫入，有一格錯誤時整張表都不會儲存
+func (h *Handler) handlePricesUpdate(c *gin.Context) {
+	form := c.PostFormMap("price")
+	updates := make([]models.PriceUpdate, 0, len(form))
+	for _, key := range slices.Sorted(maps.Keys(form)) {
+		productPart, sizePart, ok := strings.Cut(key, ":")
+		productID, err1 := strconv.ParseUint(productPart, 10, 64)
+		sizeID, err2 := strconv.ParseUint(sizePart, 10, 64)
+		if !ok || err1 != nil || err2 != nil {
+			h.renderCatalog(c, http.StatusBadRequest, "無效的價格欄位: "+key)
+			return
+		}
+
+		var price *int64
+		if value := strings.TrimSpace(form[key]); value != "" {
+			amount, err := parseMoney(value)
+			if err != nil {
+				h.renderCatalog(c, http.StatusBadRequest, "價格格式錯誤: "+value)
+				return
+			}
+			price = &amount
+		}
+		updates = append(updates, models.PriceUpdate{ProductID: uint(productID), ProductSizeID: uint(sizeID), Price: price})
+	}
+
+	if err := h.catalog.SetPrices(updates); err != nil {
+		if errors.Is(err, models.ErrInvalidPrice) {
+			h.renderCatalog(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("儲存價格表失敗", "error", err)
+		h.renderCatalog(c, http.StatusInternalServerError, "儲存價格表失敗")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/catalog")
+}
+
+// 把後台輸入的金額 (例如 12.5 / 1,234.50) 轉成最小貨幣單位，最多兩位小數
+func parseMoney(value string) (int64, error) {
+	value = strings.ReplaceAll(value, ",", "")
+	major, minor, hasMinor := strings.Cut(value, ".")
+	if hasMinor && (len(minor) == 0 || len(minor) > 2) {
+		return 0, errors.New("最多兩位小數")
+	}
+	for len(minor) < 2 {
+		minor += "0"
+	}
+	amount, err := strconv.ParseInt(major+minor, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return amount, nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"pizza-tracker-go/internal/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+/*
+維運用的子指令，與 HTTP server 是同一個執行檔:
+
+	pizza-tracker [serve]                                     啟動 HTTP server (預設)
+	pizza-tracker migrate [up|down|status] [--to 版本] [--dry-run]   套用 / 還原資料表 migration
+	pizza-tracker user create <帳號> [--role viewer] [--password 密碼]
+	pizza-tracker user passwd <帳號> [--password 密碼]
+	pizza-tracker user disable <帳號>
+	pizza-tracker order list [--status 狀態] [--phone 電話] [--limit 20]
+	pizza-tracker order show <訂單ID>
+	pizza-tracker order set-status <訂單ID> <狀態> [--note 備註]
+	pizza-tracker seed [--orders 10]                          寫入示範價格與訂單
+	pizza-tracker export [--format csv|json] [--out 檔案] [--status] [--from] [--to]
+
+每個子指令都可以用 --db 指定資料庫，優先於環境變數 DATABASE_URL
+沒有帶 --password 時從標準輸入讀取一行，避免密碼留在 shell history，也方便 echo "..." | pizza-tracker user passwd admin
+
+結束代碼: 0 成功、1 執行失敗、2 指令或參數錯誤
+*/
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// usageError => 指令或參數錯誤，結束代碼為 2，其他錯誤為 1
+type usageError struct {
+	msg string
+}
+
+func (e *usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+type command struct {
+	name    string
+	summary string
+	run     func(cfg Config, args []string) error
+}
+
+// 依顯示順序排列，printUsage 照這個順序輸出
+var commands = []command{
+	{"serve", "啟動 HTTP server (沒有指定子指令時的預設行為)", runServe},
+	{"migrate", "套用 / 還原資料表 migration (up / down / status)，並寫入預設菜單", runMigrate},
+	{"user", "管理後台帳號: create / passwd / disable", runUser},
+	{"order", "查詢與更新訂單: list / show / set-status", runOrder},
+	{"seed", "寫入示範用的價格與訂單", runSeed},
+	{"export", "匯出訂單為 CSV 或 JSON", runExport},
+}
+
+// runCommand 解析子指令並執行，回傳值為程式的結束代碼
+// 第一個參數是 - 開頭時 (例如 --db x.db) 視為 serve 的參數
+func runCommand(cfg Config, args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+			break
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "未知的指令: %s\n\n", name)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	err := cmd.run(cfg, args)
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp): // -h / --help，flag 已經印出說明
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return exitUsage
+	default:
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return exitError
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "用法: pizza-tracker <指令> [參數]")
+	fmt.Fprintln(w)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "每個指令都可以加上 --db 指定資料庫 (覆寫 DATABASE_URL)，加上 -h 查看指令的參數")
+}
+
+// 建立子指令的 FlagSet，統一加上 --db
+// 解析錯誤由 runCommand 轉成結束代碼，所以使用 ContinueOnError
+func newFlagSet(name string, cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.StringVar(&cfg.DatabaseURL, "db", cfg.DatabaseURL, "資料庫連線字串 (sqlite:// / postgres:// / mysql://) 或 SQLite 檔案路徑，覆寫 DATABASE_URL")
+	return fs
+}
+
+// 標準的 flag 套件遇到第一個位置參數就停止解析
+// 這裡讓 user create bob --role kitchen 這種參數放在後面的寫法也能用
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, &usageError{msg: err.Error()}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// 檢查位置參數的數量，names 用在錯誤訊息
+func expectArgs(args []string, names ...string) error {
+	if len(args) != len(names) {
+		return usagef("需要 %d 個參數: %s，實際收到 %d 個", len(names), strings.Join(names, " "), len(args))
+	}
+	return nil
+}
+
+// 子指令自己會印出錯誤訊息，關掉 GORM 的 SQL log，不然 record not found 之類的錯誤會先印出一大段彩色的 SQL
+func (cfg Config) cliDBConfig() models.DBConfig {
+	dbConfig := cfg.dbConfig()
+	dbConfig.Logger = logger.Default.LogMode(logger.Silent)
+	return dbConfig
+}
+
+func openDB(cfg Config) (*models.DBModel, error) {
+	dbModel, err := models.InitDB(cfg.cliDBConfig())
+	if err != nil {
+		return nil, fmt.Errorf("資料庫初始化失敗: %w", err)
+	}
+	return dbModel, nil
+}
+
+func runServe(cfg Config, args []string) error {
+	fs := newFlagSet("serve", &cfg)
+	fs.StringVar(&cfg.Port, "port", cfg.Port, "HTTP 監聽的 port，覆寫 PORT")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(positional); err != nil {
+		return err
+	}
+	return serve(cfg)
+}
+
+// InitDB 啟動時本身就會套用 migration 並寫入預設菜單，這個指令讓部署流程可以在啟動 server 前先單獨執行
+// 也可以先用 --dry-run 看會執行哪些 SQL，或是用 down 還原到指定版本
+func runMigrate(cfg Config, args []string) error {
+	fs := newFlagSet("migrate", &cfg)
+	to := fs.Int("to", -1, "目標版本，up 預設為最新版；down 必須指定 (0 代表全部還原)")
+	dryRun := fs.Bool("dry-run", false, "只印出會執行的 SQL，不修改資料庫")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	action := "up"
+	if len(positional) > 0 {
+		action, positional = positional[0], positional[1:]
+	}
+	if err := expectArgs(positional); err != nil {
+		return err
+	}
+
+	// 不用 openDB，InitDB 會直接套用所有 migration
+	db, err := models.OpenDB(cfg.cliDBConfig())
+	if err != nil {
+		return err
+	}
+	migrator, err := models.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	if action == "up" && migrator.IsLegacy() {
+		fmt.Println("-- 改用 migration 前建立的資料庫: 套用 0001 前會先用 AutoMigrate 補齊缺少的欄位與索引")
+	}
+
+	var migrations []models.Migration
+	switch action {
+	case "status":
+		return printMigrationStatus(migrator)
+	case "up":
+		target := max(*to, 0)
+		migrations, err = migrator.Up(target, *dryRun)
+	case "down":
+		if *to < 0 {
+			return usagef("down 需要用 --to 指定要還原到的版本 (0 代表全部還原)")
+		}
+		migrations, err = migrator.Down(*to, *dryRun)
+	default:
+		return usagef("未知的子指令: %s (up / down / status)", action)
+	}
+	printMigrations(action, migrations, *dryRun)
+	if errors.Is(err, models.ErrInvalidMigrationTarget) {
+		return usagef("%v", err)
+	}
+	if err != nil || *dryRun {
+		return err
+	}
+
+	current, err := migrator.Current()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("資料庫目前版本: %d (最新版本 %d): %s\n", current, migrator.Latest(), models.RedactDatabaseURL(cfg.DatabaseURL))
+	// 更新到最新版後才寫入預設資料，還原到舊版本時資料表可能不完整
+	if action == "up" && current == migrator.Latest() {
+		if _, err := models.NewDBModel(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dry-run 時印出每個 migration 的 SQL，否則只印出版本與名稱
+func printMigrations(action string, migrations []models.Migration, dryRun bool) {
+	for _, m := range migrations {
+		if !dryRun {
+			fmt.Printf("%s %04d_%s\n", action, m.Version, m.Name)
+			continue
+		}
+		sql := m.Up
+		if action == "down" {
+			sql = m.Down
+		}
+		fmt.Printf("-- %04d_%s (%s)\n", m.Version, m.Name, action)
+		for _, statement := range models.SplitStatements(sql) {
+			fmt.Println(statement)
+		}
+		fmt.Println()
+	}
+	if dryRun && len(migrations) == 0 {
+		fmt.Println("沒有需要執行的 migration")
+	}
+}
+
+func printMigrationStatus(migrator *models.Migrator) error {
+	applied, err := migrator.Applied()
+	if err != nil {
+		return err
+	}
+	appliedAt := map[int]time.Time{}
+	current := 0
+	for _, m := range applied {
+		appliedAt[m.Version] = m.AppliedAt
+		current = m.Version
+	}
+	fmt.Printf("資料庫目前版本: %d，執行檔最新版本: %d\n", current, migrator.Latest())
+	for _, m := range migrator.Migrations {
+		status := "未套用"
+		if t, ok := appliedAt[m.Version]; ok {
+			status = "已套用 " + t.Format(time.DateTime)
+		}
+		fmt.Printf("  %04d_%-30s %s\n", m.Version, m.Name, status)
+	}
+	if current > migrator.Latest() {
+		return &models.SchemaTooNewError{Current: current, Latest: migrator.Latest()}
+	}
+	return nil
+}
+
+func runUser(cfg Config, args []string) error {
+	if len(args) == 0 {
+		return usagef("缺少子指令: create / passwd / disable")
+	}
+	action, args := args[0], args[1:]
+
+	fs := newFlagSet("user "+action, &cfg)
+	var role, password string
+	switch action {
+	case "create":
+		fs.StringVar(&role, "role", string(models.RoleViewer), "角色: "+joinRoles())
+		fs.StringVar(&password, "password", "", "密碼，沒有指定時從標準輸入讀取")
+	case "passwd":
+		fs.StringVar(&password, "password", "", "新密碼，沒有指定時從標準輸入讀取")
+	case "disable":
+	default:
+		return usagef("未知的子指令: user %s", action)
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(positional, "<帳號>"); err != nil {
+		return err
+	}
+	username := positional[0]
+
+	if action != "disable" {
+		if password, err = readPassword(password); err != nil {
+			return err
+		}
+	}
+
+	dbModel, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	users := &dbModel.User
+
+	switch action {
+	case "create":
+		if n := len(username); n < 3 || n > 50 {
+			return usagef("帳號長度必須介於 3 到 50 個字元")
+		}
+		if !models.IsValidRole(models.Role(role)) {
+			return usagef("%v: %s (可用: %s)", models.ErrInvalidRole, role, joinRoles())
+		}
+		user, err := users.CreateUser(username, password, models.Role(role))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已建立帳號 %s (id=%d, role=%s)\n", user.Username, user.ID, user.Role)
+	case "passwd":
+		user, err := users.GetUserByUsername(username)
+		if err != nil {
+			return err
+		}
+		if err := users.ResetPassword(user.ID, password); err != nil {
+			return err
+		}
+		fmt.Printf("已重設 %s 的密碼\n", user.Username)
+	case "disable":
+		user, err := users.GetUserByUsername(username)
+		if err != nil {
+			return err
+		}
+		if err := users.SetDisabled(user.ID, true); err != nil {
+			return err
+		}
+		fmt.Printf("已停用帳號 %s\n", user.Username)
+	}
+	return nil
+}
+
+// 密碼沒有從參數傳入時，從標準輸入讀取一行
+// 規則與後台表單相同: 8 ~ 72 個字元 (bcrypt 只會使用前 72 bytes)
+func readPassword(password string) (string, error) {
+	if password == "" {
+		fmt.Fprint(os.Stderr, "密碼: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("讀取密碼失敗: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if n := len(password); n < 8 || n > 72 {
+		return "", usagef("密碼長度必須介於 8 到 72 個字元")
+	}
+	return password, nil
+}
+
+func joinRoles() string {
+	names := make([]string, len(models.Roles))
+	for i, role := range models.Roles {
+		names[i] = string(role)
+	}
+	return strings.Join(names, ", ")
+}
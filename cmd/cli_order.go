@@ -0,0 +1,445 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"pizza-tracker-go/internal/models"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// 訂單相關的子指令: order list / show / set-status、seed、export，說明見 cli.go
+
+const cliTimeFormat = "2006-01-02 15:04"
+
+func runOrder(cfg Config, args []string) error {
+	if len(args) == 0 {
+		return usagef("缺少子指令: list / show / set-status")
+	}
+	action, args := args[0], args[1:]
+	switch action {
+	case "list":
+		return runOrderList(cfg, args)
+	case "show":
+		return runOrderShow(cfg, args)
+	case "set-status":
+		return runOrderSetStatus(cfg, args)
+	default:
+		return usagef("未知的子指令: order %s", action)
+	}
+}
+
+func runOrderList(cfg Config, args []string) error {
+	fs := newFlagSet("order list", &cfg)
+	status := fs.String("status", "", "只列出此狀態的訂單")
+	phone := fs.String("phone", "", "電話部分比對")
+	limit := fs.Int("limit", models.DefaultOrderPageSize, fmt.Sprintf("最多列出幾筆 (上限 %d)", models.MaxOrderPageSize))
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(positional); err != nil {
+		return err
+	}
+	if *status != "" && !models.IsValidStatus(*status) {
+		return usagef("%v: %s", models.ErrInvalidStatus, *status)
+	}
+	if *limit <= 0 {
+		return usagef("--limit 必須是正整數")
+	}
+
+	dbModel, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	page, err := dbModel.Order.ListOrders(models.OrderQuery{
+		Status: *status,
+		Phone:  *phone,
+		Desc:   true,
+		Limit:  *limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\t建立時間\t狀態\t顧客\t電話\t總額")
+	for _, order := range page.Orders {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n",
+			order.ID, order.CreatedAt.Format(cliTimeFormat), order.Status, order.CustomerName, order.Phone, order.Total)
+	}
+	return w.Flush()
+}
+
+func runOrderShow(cfg Config, args []string) error {
+	fs := newFlagSet("order show", &cfg)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(positional, "<訂單ID>"); err != nil {
+		return err
+	}
+
+	dbModel, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	order, err := dbModel.Order.FindOrder(positional[0])
+	if err != nil {
+		return err
+	}
+	events, err := dbModel.Order.GetStatusEvents(order.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("訂單 %s\n", order.ID)
+	fmt.Printf("狀態: %s\n", order.Status)
+	fmt.Printf("顧客: %s / %s / %s\n", order.CustomerName, order.Phone, order.Address)
+	fmt.Printf("建立: %s  更新: %s\n", order.CreatedAt.Format(cliTimeFormat), order.UpdatedAt.Format(cliTimeFormat))
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "品項\t尺寸\t數量\t單價\t小計\t備註")
+	for _, item := range order.Items {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n",
+			item.Pizza, item.Size, item.Quantity, item.UnitPrice, item.LineTotal, item.Instructions)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("小計 %d  稅金 %d  總額 %d\n", order.Subtotal, order.Tax, order.Total)
+	fmt.Println()
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "時間\t狀態\t備註")
+	for _, event := range events {
+		from := event.FromStatus
+		if from == "" {
+			from = "(建立)"
+		}
+		fmt.Fprintf(w, "%s\t%s → %s\t%s\n", event.CreatedAt.Format(cliTimeFormat), from, event.ToStatus, event.Note)
+	}
+	return w.Flush()
+}
+
+// 以 ActorSystem 身分變更狀態，規則與系統排程相同 (例如不能把交付失敗的訂單改回來，那需要後台人員處理)
+// 另一個行程的 SSE 連線不會收到這次的變更，顧客重新整理頁面後才會看到
+func runOrderSetStatus(cfg Config, args []string) error {
+	fs := newFlagSet("order set-status", &cfg)
+	note := fs.String("note", "", "狀態歷程的備註")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(positional, "<訂單ID>", "<狀態>"); err != nil {
+		return err
+	}
+	if !models.IsValidStatus(positional[1]) {
+		return usagef("%v: %s (可用: %s)", models.ErrInvalidStatus, positional[1], strings.Join(models.OrderStatues, ", "))
+	}
+
+	dbModel, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	event, err := dbModel.Order.UpdateOrderStatus(positional[0], models.StatusChange{
+		To:    positional[1],
+		Actor: models.ActorSystem,
+		Note:  *note,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("訂單 %s: %s → %s\n", event.OrderID, event.FromStatus, event.ToStatus)
+	return nil
+}
+
+// 示範訂單用的顧客資料
+var (
+	seedCustomers = []string{"王小明", "陳大文", "林美華", "Alex", "Mia"}
+	seedNotes     = []string{"", "", "不要洋蔥", "多加起司", "切八片"}
+)
+
+// seed => 補上尚未設定的價格，再建立幾筆不同狀態的示範訂單
+// 菜單本身在 InitDB 時已經由 SeedDefaults 寫入；已經設定過的價格不會被覆蓋
+func runSeed(cfg Config, args []string) error {
+	fs := newFlagSet("seed", &cfg)
+	count := fs.Int("orders", 10, "要建立幾筆示範訂單")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(positional); err != nil {
+		return err
+	}
+	if *count < 0 {
+		return usagef("--orders 不能是負數")
+	}
+
+	dbModel, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	priced, err := seedPrices(&dbModel.Catalog)
+	if err != nil {
+		return fmt.Errorf("寫入示範價格失敗: %w", err)
+	}
+
+	products, err := dbModel.Catalog.ActiveProducts()
+	if err != nil {
+		return err
+	}
+	sizes, err := dbModel.Catalog.ActiveSizes()
+	if err != nil {
+		return err
+	}
+	if *count > 0 && (len(products) == 0 || len(sizes) == 0) {
+		return errors.New("沒有上架中的品項，無法建立示範訂單")
+	}
+
+	for i := range *count {
+		order := models.Order{
+			Status:       models.StatusPlaced,
+			CustomerName: seedCustomers[i%len(seedCustomers)],
+			Phone:        fmt.Sprintf("09%08d", rand.IntN(100000000)),
+			Address:      fmt.Sprintf("伺服器 %d", rand.IntN(20)+1),
+		}
+		for range rand.IntN(3) + 1 {
+			order.Items = append(order.Items, models.OrderItem{
+				Pizza:        products[rand.IntN(len(products))].Name,
+				Size:         sizes[rand.IntN(len(sizes))].Name,
+				Instructions: seedNotes[rand.IntN(len(seedNotes))],
+				Quantity:     rand.IntN(3) + 1,
+			})
+		}
+		if err := dbModel.Catalog.PriceOrder(&order, cfg.TaxRateBps); err != nil {
+			return err
+		}
+		if err := dbModel.Order.CreateOrder(&order); err != nil {
+			return err
+		}
+
+		// 依序往前推進 0 ~ 3 步，讓示範資料涵蓋各種狀態
+		for _, status := range []string{models.StatusPreparing, models.StatusReady, models.StatusDelivered}[:rand.IntN(4)] {
+			change := models.StatusChange{To: status, Actor: models.ActorSystem, Note: "示範資料"}
+			if _, err := dbModel.Order.UpdateOrderStatus(order.ID, change); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf("已補上 %d 筆價格、建立 %d 筆示範訂單\n", priced, *count)
+	return nil
+}
+
+// 替還沒有價格的商品 × 尺寸設定示範價格，尺寸越大越貴，回傳新增的筆數
+func seedPrices(catalog *models.CatalogModel) (int, error) {
+	products, err := catalog.ListProducts()
+	if err != nil {
+		return 0, err
+	}
+	sizes, err := catalog.ListSizes()
+	if err != nil {
+		return 0, err
+	}
+	prices, err := catalog.ListPrices()
+	if err != nil {
+		return 0, err
+	}
+	type key struct{ product, size uint }
+	existing := make(map[key]bool, len(prices))
+	for _, p := range prices {
+		existing[key{p.ProductID, p.ProductSizeID}] = true
+	}
+
+	created := 0
+	for i, product := range products {
+		for j, size := range sizes {
+			if existing[key{product.ID, size.ID}] {
+				continue
+			}
+			price := int64(19900 + 10000*j + 2000*i)
+			if err := catalog.SetPrice(product.ID, size.ID, &price); err != nil {
+				return created, err
+			}
+			created++
+		}
+	}
+	return created, nil
+}
+
+// CSV 的欄位，items 以「品項 尺寸 x數量」並用 ; 分隔
+var exportColumns = []string{"id", "created_at", "status", "customer_name", "phone", "address", "items", "subtotal", "tax", "total"}
+
+// export => 依條件匯出所有訂單，由舊到新，逐頁讀取避免一次載入全部
+func runExport(cfg Config, args []string) (retErr error) {
+	fs := newFlagSet("export", &cfg)
+	format := fs.String("format", "csv", "輸出格式: csv / json")
+	out := fs.String("out", "", "輸出檔案，沒有指定時寫到標準輸出")
+	status := fs.String("status", "", "只匯出此狀態的訂單")
+	from := fs.String("from", "", "建立時間起 (RFC3339 或 2006-01-02)")
+	to := fs.String("to", "", "建立時間迄 (RFC3339 或 2006-01-02，只有日期時包含當天)")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := expectArgs(positional); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return usagef("不支援的格式: %s", *format)
+	}
+	if *status != "" && !models.IsValidStatus(*status) {
+		return usagef("%v: %s", models.ErrInvalidStatus, *status)
+	}
+	q := models.OrderQuery{Status: *status, Limit: models.MaxOrderPageSize}
+	if q.From, err = parseDateParam(*from, false); err != nil {
+		return usagef("--from 格式錯誤: %v", err)
+	}
+	if q.To, err = parseDateParam(*to, true); err != nil {
+		return usagef("--to 格式錯誤: %v", err)
+	}
+
+	dbModel, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		// 寫入成功時以 Close 的錯誤為準，避免磁碟滿了卻回報成功
+		defer func() {
+			if cerr := f.Close(); retErr == nil {
+				retErr = cerr
+			}
+		}()
+		w = f
+	}
+
+	var exporter orderExporter
+	if *format == "json" {
+		exporter = newJSONExporter(w)
+	} else {
+		exporter = newCSVExporter(w)
+	}
+
+	total := 0
+	for {
+		page, err := dbModel.Order.ListOrders(q)
+		if err != nil {
+			return err
+		}
+		for i := range page.Orders {
+			if err := exporter.write(&page.Orders[i]); err != nil {
+				return err
+			}
+		}
+		total += len(page.Orders)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if err := exporter.close(); err != nil {
+		return err
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "已匯出 %d 筆訂單到 %s\n", total, *out)
+	}
+	return nil
+}
+
+type orderExporter interface {
+	write(order *models.Order) error
+	close() error
+}
+
+type csvExporter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVExporter(w io.Writer) *csvExporter {
+	return &csvExporter{w: csv.NewWriter(w)}
+}
+
+func (e *csvExporter) write(order *models.Order) error {
+	if !e.header {
+		e.header = true
+		if err := e.w.Write(exportColumns); err != nil {
+			return err
+		}
+	}
+	items := make([]string, len(order.Items))
+	for i, item := range order.Items {
+		items[i] = fmt.Sprintf("%s %s x%d", item.Pizza, item.Size, item.Quantity)
+	}
+	return e.w.Write([]string{
+		order.ID,
+		order.CreatedAt.Format(time.RFC3339),
+		order.Status,
+		order.CustomerName,
+		order.Phone,
+		order.Address,
+		strings.Join(items, "; "),
+		strconv.FormatInt(order.Subtotal, 10),
+		strconv.FormatInt(order.Tax, 10),
+		strconv.FormatInt(order.Total, 10),
+	})
+}
+
+// 沒有任何訂單時也輸出標題列
+func (e *csvExporter) close() error {
+	if !e.header {
+		if err := e.w.Write(exportColumns); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// JSON 輸出為一個陣列，逐筆寫入，格式與 GET /api/admin/orders/:id 相同
+type jsonExporter struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONExporter(w io.Writer) *jsonExporter {
+	return &jsonExporter{w: w}
+}
+
+func (e *jsonExporter) write(order *models.Order) error {
+	b, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if e.count == 0 {
+		sep = "[\n"
+	}
+	e.count++
+	_, err = fmt.Fprintf(e.w, "%s%s", sep, b)
+	return err
+}
+
+func (e *jsonExporter) close() error {
+	if e.count == 0 {
+		_, err := io.WriteString(e.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
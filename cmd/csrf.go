@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+/*
+CSRF 防護 (signed double-submit cookie):
+1. token 存在獨立的 cookie (csrfCookieName)，第一次渲染模板 (或呼叫 GET /api/csrf) 時產生；
+   格式是 <隨機值>.<HMAC-SHA256(隨機值)>，以 SESSION_SECRET_KEY 簽章，server 不需要保存任何狀態，
+   匿名瀏覽首頁 / 訂單頁面不會建立 session (gormstore 的 sessions 資料表不會每個訪客多一筆)
+2. 模板用 {{template "csrf"}} 在表單放入隱藏欄位 csrf_token，JS 可以讀 <meta name="csrf-token">
+3. CSRFMiddleware 檢查所有 POST / PUT / PATCH / DELETE，送來的 token 必須與 cookie 相同且簽章正確
+   (其他網站讀不到這個 cookie，也算不出簽章):
+  - 一般表單 => csrf_token 欄位或 X-CSRF-Token header
+  - /api => 只接受 X-CSRF-Token header；沒有帶 session cookie 的呼叫 (例如手機 App) 不會被瀏覽器夾帶身分，不需要檢查
+  - Authorization: Bearer 的呼叫由 APIAuthMiddleware 只用 token 驗證，跨站請求無法自行加上這個 header，也不需要檢查
+*/
+
+const (
+	csrfCookieName = "pizza-tracker-csrf"
+	csrfFormField  = "csrf_token"
+	csrfHeader     = "X-CSRF-Token"
+)
+
+func (h *Handler) signCSRFToken(nonce string) string {
+	mac := hmac.New(sha256.New, h.csrfSecret)
+	mac.Write([]byte(nonce))
+	return nonce + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *Handler) validCSRFToken(token string) bool {
+	nonce, _, ok := strings.Cut(token, ".")
+	return ok && nonce != "" && hmac.Equal([]byte(token), []byte(h.signCSRFToken(nonce)))
+}
+
+// 取得 cookie 裡的 token，沒有或簽章不對時產生一個新的並寫入 cookie
+func (h *Handler) ensureCSRFToken(c *gin.Context) (string, error) {
+	if token, err := c.Cookie(csrfCookieName); err == nil && h.validCSRFToken(token) {
+		return token, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := h.signCSRFToken(base64.RawURLEncoding.EncodeToString(b))
+	// 與 session cookie 相同只給 server 讀取，頁面從 <meta> 或 /api/csrf 取得 token
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+func (h *Handler) CSRFMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		isAPI := strings.HasPrefix(c.Request.URL.Path, "/api/")
+		if isAPI {
+			if _, err := c.Cookie(sessionCookieName); err != nil || c.GetHeader("Authorization") != "" {
+				c.Next()
+				return
+			}
+		}
+
+		sent := c.GetHeader(csrfHeader)
+		if sent == "" && !isAPI {
+			sent = c.PostForm(csrfFormField)
+		}
+		// cookie 裡沒有合法的 token 代表從來沒有拿到過表單，一律拒絕
+		expected, err := c.Cookie(csrfCookieName)
+		if err != nil || !h.validCSRFToken(expected) || subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) != 1 {
+			if isAPI {
+				respondError(c, http.StatusForbidden, "CSRF token 無效，請重新取得 /api/csrf")
+				return
+			}
+			c.String(http.StatusForbidden, "CSRF token 無效，請重新整理頁面後再試")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// GET /api/csrf => React 等前端在送出 POST / PATCH / DELETE 之前取得 token，放在 X-CSRF-Token header
+func (h *Handler) getCSRFTokenJSON(c *gin.Context) {
+	token, err := h.ensureCSRFToken(c)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "產生 CSRF token 失敗")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+// renderHTML 取代 c.HTML，讓模板可以呼叫 {{csrfToken}}
+// FuncMap 在 Parse 時就綁定了，所以每個請求從 h.templates clone 一份再換成這個瀏覽器的 token
+// html/template 規定執行過的模板不能再 Clone，所以 h.templates 本身永遠不會被執行
+func (h *Handler) renderHTML(c *gin.Context, code int, name string, data any) {
+	token, err := h.ensureCSRFToken(c)
+	if err != nil {
+		log.Println("產生 CSRF token 失敗:", err)
+		c.String(http.StatusInternalServerError, "系統錯誤，請稍後再試")
+		return
+	}
+	tmpl, err := h.templates.Clone()
+	if err != nil {
+		log.Println("複製模板失敗:", err)
+		c.String(http.StatusInternalServerError, "系統錯誤，請稍後再試")
+		return
+	}
+	tmpl.Funcs(template.FuncMap{"csrfToken": func() string { return token }})
+	c.Render(code, render.HTML{Template: tmpl, Name: name, Data: data})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+var csrfFieldPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func TestAuthAndCSRFRoutes(t *testing.T) {
+	server := newTestServer(t)
+	browser := server.newClient(t)
+
+	expectRedirect(t, browser.get("/admin"), "/login")
+	expectRedirect(t, browser.get("/admin/catalog"), "/login")
+	expectStatus(t, browser.get("/api/admin/orders"), http.StatusUnauthorized)
+
+	// 沒有帶 CSRF token 的 POST 一律拒絕
+	resp, err := browser.http.PostForm(server.URL+"/login", url.Values{"account": {"admin"}, "password": {"secret123"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	expectStatus(t, resp, http.StatusForbidden)
+}
+
+// 匿名瀏覽首頁與訂單頁面只拿到 CSRF cookie，不會建立 session
+func TestAnonymousPagesDoNotCreateSessions(t *testing.T) {
+	server := newTestServer(t)
+	order := createTestOrder(t, server, "Gina")
+	browser := server.newClient(t)
+
+	resp := browser.get("/")
+	expectStatus(t, resp, http.StatusOK)
+	var issued bool
+	for _, cookie := range resp.Cookies() {
+		switch cookie.Name {
+		case sessionCookieName:
+			t.Fatal("匿名瀏覽首頁不應該建立 session")
+		case csrfCookieName:
+			issued = true
+		}
+	}
+	if !issued {
+		t.Fatal("首頁應該發出 CSRF cookie")
+	}
+	match := csrfFieldPattern.FindStringSubmatch(readBody(t, resp))
+	if match == nil {
+		t.Fatal("首頁的表單沒有 csrf_token 欄位")
+	}
+	token := match[1]
+
+	// 已經有 CSRF cookie 的瀏覽器不會再收到任何 cookie
+	resp = browser.get("/customer/" + order.ID)
+	expectStatus(t, resp, http.StatusOK)
+	if cookies := resp.Cookies(); len(cookies) != 0 {
+		t.Fatalf("訂單頁面不應該設定 cookie: %v", cookies)
+	}
+
+	post := func(client *testClient, token string) int {
+		t.Helper()
+		resp, err := client.http.PostForm(server.URL+"/new-order", url.Values{csrfFormField: {token}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// 頁面上的 token 可以送出表單 (欄位不完整 => 400，但通過了 CSRF 檢查)
+	if status := post(browser, token); status == http.StatusForbidden {
+		t.Fatal("頁面上的 token 應該通過 CSRF 檢查")
+	}
+	// 別的瀏覽器的 token、偽造的 token 都不行
+	other := server.newClient(t)
+	expectStatus(t, other.get("/"), http.StatusOK)
+	if status := post(other, token); status != http.StatusForbidden {
+		t.Fatalf("別的瀏覽器的 token: %d", status)
+	}
+	u, _ := url.Parse(server.URL)
+	browser.http.Jar.SetCookies(u, []*http.Cookie{{Name: csrfCookieName, Value: "forged.token", Path: "/"}})
+	if status := post(browser, "forged.token"); status != http.StatusForbidden {
+		t.Fatalf("偽造的 token: %d", status)
+	}
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
 	"pizza-tracker-go/internal/models"
+	"slices"
+	"time"
 
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
@@ -14,39 +16,53 @@ type CustomerData struct {
 	Title    string
 	Order    models.Order
 	Statuses []string
+	Timeline []publicStatusEvent // 不要直接顯示 Order.StatusEvents，裡面有後台人員與內部備註
+}
+
+// 顧客看得到的狀態歷程 (customer.tmpl 與 GET /api/orders/:id)
+// 不包含 UserID (哪個後台人員改的) 與 Note (後台的內部備註)，這兩個只在後台顯示
+type publicStatusEvent struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func publicStatusEvents(events []models.OrderStatusEvent) []publicStatusEvent {
+	timeline := make([]publicStatusEvent, len(events))
+	for i, event := range events {
+		timeline[i] = publicStatusEvent{From: event.FromStatus, To: event.ToStatus, CreatedAt: event.CreatedAt}
+	}
+	return timeline
 }
 
 type OrderFormData struct { // 定義 從 models 取得披薩種類與尺寸的資料 的結構體
-	PizzaTypes []string
-	PizzaSizes []string
+	PizzaTypes []models.Product
+	PizzaSizes []models.ProductSize
+	Prices     map[string]int64 // key => 種類|尺寸，前端即時計算小計用
+	TaxRateBps int64
+	// 每次顯示表單產生新的 key，連點送出只會建立一筆訂單，見 idempotency.go
+	IdempotencyKey string
 }
 
 // dive 是 go-playground/validator 提供的特殊標籤，它用於啟用對 slice/array/map 內部元素的遞歸驗證，若結構體中包含嵌套的切片或數組，且需要驗證其內部字段，必須加上 dive，否則只會驗證外層容器本身（如長度），不會驗證內部元素的字段。
+// form tag => order.tmpl 表單送出；json tag => POST /api/orders，兩者共用同一組 binding 規則
 type OrderReuqest struct {
-	Name         string   `form:"name" binding:"required,min=2,max=100"`
-	Phone        string   `form:"phone" binding:"required,max=20"`
-	Address      string   `form:"address" binding:"required,min=5,max=200"`
-	Sizes        []string `form:"size" binding:"required,min=1,dive,valid_pizza_size"`
-	PizzaTypes   []string `form:"pizza" binding:"required,min=1,dive,valid_pizza_type"`
-	Instructions []string `form:"instructions" binding:"max=200"`
-}
-
-// tmpl 前端模板
-func (h *Handler) ServeNewOrderForm(c *gin.Context) { // ServeNewOrderForm 屬於 Handler 結構體的方法，用來處理 HTTP 請求。
-	// 回傳一個 HTML 頁面
-	c.HTML(http.StatusOK, "order.tmpl", OrderFormData{
-		PizzaTypes: models.PizzaTypes, // 把 資料包裝成 OrderFormData結構體，然後提供給模板
-		PizzaSizes: models.PizzaSizes,
-	})
+	Name         string   `form:"name" json:"name" binding:"required,min=2,max=100"`
+	Phone        string   `form:"phone" json:"phone" binding:"required,max=20"`
+	Address      string   `form:"address" json:"address" binding:"required,min=5,max=200"`
+	Sizes        []string `form:"size" json:"sizes" binding:"required,min=1,dive,valid_pizza_size"`
+	PizzaTypes   []string `form:"pizza" json:"pizzas" binding:"required,min=1,dive,valid_pizza_type"`
+	Quantities   []int    `form:"quantity" json:"quantities" binding:"required,min=1,dive,min=1,max=99"`
+	Instructions []string `form:"instructions" json:"instructions" binding:"omitempty,dive,max=200"`
 }
 
-// Undefined validation function 'min' on field 'Phone' => 這錯誤跟 binding 的寫法錯誤有關
-func (h *Handler) HandleNewOrderPost(c *gin.Context) {
-	var form OrderReuqest
+// 尺寸、種類、件數是一對一的陣列，數量不同時無法組成訂單明細
+var errOrderItemsMismatch = errors.New("size、pizza 與 quantity 的數量不一致")
 
-	if err := c.ShouldBind(&form); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+// 把表單 / JSON 的資料組成一筆新訂單，HandleNewOrderPost 跟 POST /api/orders 共用
+func (r *OrderReuqest) toOrder() (models.Order, error) {
+	if len(r.Sizes) != len(r.PizzaTypes) || len(r.Sizes) != len(r.Quantities) {
+		return models.Order{}, errOrderItemsMismatch
 	}
 	/* 效果:
 	[]models.OrderItem{
@@ -64,25 +80,109 @@ func (h *Handler) HandleNewOrderPost(c *gin.Context) {
 
 	*/
 	// 組合訂單明細 : 準備一個清單，裝每一個pizza訂單項目
-	orderItems := make([]models.OrderItem, len(form.Sizes))
+	orderItems := make([]models.OrderItem, len(r.Sizes))
 	for i := range orderItems { // 把 表單的資料，一筆一筆的轉乘 OrderItem struct，將結果塞進 orderItems slice中
 		orderItems[i] = models.OrderItem{ // 用意: 把訂單項目，變成有意義的物件，而不是零散的slice，也方便後續處理
-			Size:         form.Sizes[i],
-			Pizza:        form.PizzaTypes[i],
-			Instructions: form.Instructions[i],
+			Size:     r.Sizes[i],
+			Pizza:    r.PizzaTypes[i],
+			Quantity: r.Quantities[i],
+		}
+		// 備註是選填，JSON 可能少給，缺少的視為沒有備註
+		if i < len(r.Instructions) {
+			orderItems[i].Instructions = r.Instructions[i]
 		}
 	}
 
-	order := models.Order{
+	return models.Order{
 		Status:       models.OrderStatues[0],
-		CustomerName: form.Name,
-		Phone:        form.Phone,
-		Address:      form.Address,
+		CustomerName: r.Name,
+		Phone:        r.Phone,
+		Address:      r.Address,
 		Items:        orderItems,
+	}, nil
+}
+
+// tmpl 前端模板
+func (h *Handler) ServeNewOrderForm(c *gin.Context) { // ServeNewOrderForm 屬於 Handler 結構體的方法，用來處理 HTTP 請求。
+	// 只顯示目前上架中的品項 (資料庫菜單，有快取)
+	products, err := h.catalog.ActiveProducts()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取菜單失敗")
+		return
+	}
+	sizes, err := h.catalog.ActiveSizes()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取菜單失敗")
+		return
+	}
+	activePrices, err := h.catalog.ActivePrices()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取菜單失敗")
+		return
+	}
+	// JSON 的 key 只能是字串
+	prices := make(map[string]int64, len(activePrices))
+	pricedProducts, pricedSizes := map[string]bool{}, map[string]bool{}
+	for key, price := range activePrices {
+		prices[key.Product+"|"+key.Size] = price
+		pricedProducts[key.Product], pricedSizes[key.Size] = true, true
+	}
+	// 一個價格都沒有的商品 / 尺寸不顯示，顧客選了也一定會被拒絕；
+	// 其他沒有價格的組合由前端顯示「尚未開放」
+	products = slices.DeleteFunc(slices.Clone(products), func(p models.Product) bool { return !pricedProducts[p.Name] })
+	sizes = slices.DeleteFunc(slices.Clone(sizes), func(s models.ProductSize) bool { return !pricedSizes[s.Name] })
+
+	idempotencyKey, err := newIdempotencyKey()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "系統錯誤，請稍後再試")
+		return
+	}
+
+	// 回傳一個 HTML 頁面
+	h.renderHTML(c, http.StatusOK, "order.tmpl", OrderFormData{
+		PizzaTypes:     products, // 把 資料包裝成 OrderFormData結構體，然後提供給模板
+		PizzaSizes:     sizes,
+		Prices:         prices,
+		TaxRateBps:     h.taxRateBps,
+		IdempotencyKey: idempotencyKey,
+	})
+}
+
+// Undefined validation function 'min' on field 'Phone' => 這錯誤跟 binding 的寫法錯誤有關
+func (h *Handler) HandleNewOrderPost(c *gin.Context) {
+	var form OrderReuqest
+
+	if err := c.ShouldBind(&form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := form.toOrder()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 依目前菜單的價格計算金額，並快照到訂單明細
+	if err := h.catalog.PriceOrder(&order, h.taxRateBps); err != nil {
+		if errors.Is(err, models.ErrPriceNotSet) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+		return
 	}
 
 	// 當前 func 已經跟 Handler 結構體綁定，可以直接透過 h.orders 呼叫 OrderModel 的方法
-	if err := h.orders.CreateOrder(&order); err != nil {
+	// 同一個表單連點送出 => 第二次直接導向第一次建立的訂單
+	saved, replayed, err := h.saveOrder(&order, &form, "form", c.PostForm(idempotencyFormField))
+	if err != nil {
+		if errors.Is(err, models.ErrIdempotencyKeyReused) || errors.Is(err, errIdempotencyKeyTooLong) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, models.ErrIdempotentOrderGone) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		// 情況1:會多了 time / level等欄位說明
 		// time=2026-01-08T00:23:00.000+08:00 level=ERROR msg="Failed to create order" error="some error message"
@@ -96,10 +196,15 @@ func (h *Handler) HandleNewOrderPost(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "Something went wrong")
 		return
 	}
+	if replayed {
+		slog.Info("Order replayed", "orderId", saved.ID)
+		c.Redirect(http.StatusSeeOther, "/customer/"+saved.ID)
+		return
+	}
 	slog.Info("Order created", "orderId", order.ID, "customer", order.CustomerName)
 
 	// 發送通知
-	h.notificationManager.Publish("admin:new_orders", "new_order")
+	h.publishOrderEvent(c, orderCreatedEvent(&order))
 
 	// 請求的資源可用，並且應該獲取 https://blog.csdn.net/weixin_42073635/article/details/143805554
 	// c.Redirect(statusCode, location)
@@ -123,25 +228,11 @@ func (h *Handler) serveCustomer(c *gin.Context) {
 	}
 
 	// 如果資料庫有訂單，以 tmpl 呈現給前端
-	c.HTML(http.StatusOK, "customer.tmpl", CustomerData{
+	h.renderHTML(c, http.StatusOK, "customer.tmpl", CustomerData{
 		Title:    "仙境傳說接單系統" + orderID,
 		Order:    *order,
+		Timeline: publicStatusEvents(order.StatusEvents),
 		Statuses: models.OrderStatues, // {{range $index, $status := .Statuses}}
 		// .Statuses：代表傳入模板的資料結構中，名為 Statuses 的欄位（通常是一個 slice）
 	})
 }
-
-// http://localhost:8080/api/admin/dashboard
-// Handler.go => 這樣 /api/admin/dashboard 就會回傳 JSON，React 可以直接拿。
-func (h *Handler) GetAdminDashboardJSON(c *gin.Context) {
-	// 假設你有 session，可以拿到使用者名稱
-	session := sessions.Default(c)
-	username := session.Get("username")
-
-	// 這裡可以查 DB 或組合資料
-	c.JSON(200, gin.H{
-		"username": username,
-		"orders":   []string{"order1", "order2"},
-		"status":   "ok",
-	})
-}
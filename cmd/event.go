@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 )
 
+// 連線中斷後，瀏覽器等多久再重連
+const sseRetry = 3 * time.Second
+
 // 通知顧客，當前這筆訂單狀態剛剛改變
 func (h *Handler) notificationHandler(c *gin.Context) {
 	orderId := c.Query("orderId")
@@ -22,49 +31,137 @@ func (h *Handler) notificationHandler(c *gin.Context) {
 		c.String(http.StatusNotFound, "order not found")
 		return
 	}
-	topic := "order:" + orderId
-	client := make(chan string, 10)
+	topic := orderTopic(orderId)
 
 	// 訂閱 order:XXX 這個頻道，之後 admin 更改訂單狀態時，都會把訊息發送給有訂閱這個訂單的 clients
-	h.notificationManager.Subscribe(topic, client)
-
-	// 不管這個函數從哪裡 return（400、404、或是正常跑完 SSE），進入 defer 的 code 一定會在函數結束前執行一次。
-	defer func() {
-		h.notificationManager.Unsubscribe(topic, client)
-		slog.Info("Unsubscribed from topic", "orderId", topic)
-	}()
-
-	h.streamSSE(c, client)
+	h.subscribeSSE(c, topic)
 }
 
 // 通知 ADMIN 有新的訂單請求
 func (h *Handler) StreamNewOrderNotifications(c *gin.Context) {
-	topic := "admin:new_orders"
+	topic := adminTopic
 
-	client := make(chan string, 10)
+	h.subscribeSSE(c, topic)
+}
 
-	h.notificationManager.Subscribe(topic, client)
+// 訂閱 topic 並以 SSE 持續推送，連線結束時取消訂閱
+// 瀏覽器重連時會帶上 Last-Event-ID，先補送斷線期間漏掉的事件
+func (h *Handler) subscribeSSE(c *gin.Context, topic string) {
+	ctx := c.Request.Context()
+	client := make(chan Event, 10)
+
+	backlog, err := h.notificationManager.Subscribe(ctx, topic, client, SubscribeOptions{
+		LastEventID: lastEventID(c),
+		ClientIP:    c.ClientIP(),
+	})
+	if errors.Is(err, ErrTooManySubscribers) {
+		slog.Warn("SSE 連線數已達上限", "topic", topic, "ip", c.ClientIP(), "error", err)
+		c.String(http.StatusTooManyRequests, "too many subscribers")
+		return
+	}
+	if err != nil {
+		slog.Error("訂閱通知失敗", "topic", topic, "error", err)
+		c.String(http.StatusServiceUnavailable, "notification service unavailable")
+		return
+	}
 
 	// 不管這個函數從哪裡 return（400、404、或是正常跑完 SSE），進入 defer 的 code 一定會在函數結束前執行一次。
+	// 請求的 ctx 在連線結束時已經被取消，取消訂閱改用 context.Background()
 	defer func() {
-		h.notificationManager.Unsubscribe(topic, client)
+		h.notificationManager.Unsubscribe(context.Background(), topic, client)
 		slog.Info("Unsubscribed from topic", "orderId", topic)
 	}()
 
-	h.streamSSE(c, client)
+	h.streamSSE(c, backlog, client)
+}
+
+// Last-Event-ID 不存在或格式錯誤都當成第一次連線
+func lastEventID(c *gin.Context) uint64 {
+	id, err := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// 發送通知，失敗只記錄 log，不影響原本的請求 (訂單已經寫入資料庫)
+func (h *Handler) publish(c *gin.Context, topic string, ev Event) {
+	if err := h.notificationManager.Publish(c.Request.Context(), topic, ev); err != nil {
+		slog.Error("發送通知失敗", "topic", topic, "error", err)
+	}
 }
 
 // SSE/WebSocket 長連接...訂閱後的固定寫法
-func (h *Handler) streamSSE(c *gin.Context, client chan string) {
+// 先送 retry: 提示與補送的事件，之後才是即時事件；ID 不大於已送出的事件代表重複 (補送與即時重疊)，直接略過
+// 以下任一情況結束連線:
+//   - client 斷線 (request 的 ctx 被取消)，不用等到下一個事件送不出去才發現
+//   - 連線超過 sseMaxDuration，瀏覽器會帶著 Last-Event-ID 自動重連，不會漏掉事件
+//   - 被取消訂閱或因為太慢被踢掉 (client 被 close)
+//
+// 沒有事件時每隔 sseHeartbeat 送一行註解 (: ping)，避免 proxy 把閒置連線切斷
+func (h *Handler) streamSSE(c *gin.Context, backlog []Event, client chan Event) {
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", sseRetry.Milliseconds())
+	var sent uint64
+	for _, ev := range backlog {
+		writeSSE(c, ev)
+		sent = ev.ID
+	}
+	c.Writer.Flush()
+
+	// nil channel 永遠不會收到值，設定為 0 時等同關閉該功能
+	var heartbeat, deadline <-chan time.Time
+	if h.sseHeartbeat > 0 {
+		ticker := time.NewTicker(h.sseHeartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	if h.sseMaxDuration > 0 {
+		timer := time.NewTimer(h.sseMaxDuration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ctx := c.Request.Context()
+
 	c.Stream(func(w io.Writer) bool {
-		if msg, ok := <-client; ok {
-			c.SSEvent("message", msg)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline:
+			return false
+		case <-heartbeat:
+			fmt.Fprint(w, ": ping\n\n")
+			return true
+		case ev, ok := <-client:
+			if !ok {
+				return false // 取消訂閱或因為太慢被踢掉，結束連線讓瀏覽器重連
+			}
+			if sent == 0 || ev.ID > sent {
+				writeSSE(c, ev)
+				sent = ev.ID
+			}
 			return true
 		}
-		return false
+	})
+}
+
+// GET /api/admin/notifications/stats => 目前的 SSE 訂閱數、被拒絕與被踢掉的次數
+func (h *Handler) getNotificationStatsJSON(c *gin.Context) {
+	c.JSON(http.StatusOK, h.notificationManager.Stats())
+}
+
+// 沒有指定 Type 的事件照舊以 message 送出，前端的 onmessage 才收得到
+func writeSSE(c *gin.Context, ev Event) {
+	name := ev.Type
+	if name == "" {
+		name = "message"
+	}
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatUint(ev.ID, 10),
+		Event: name,
+		Data:  ev.Data,
 	})
 }
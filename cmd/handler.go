@@ -1,22 +1,72 @@
 // Package 引入
 package main
 
-import "pizza-tracker-go/internal/models"
+import (
+	"errors"
+	"html/template"
+	"pizza-tracker-go/internal/models"
+	"reflect"
+	"time"
+)
 
 // 用來管理應用的主要邏輯層跟服務層
 type Handler struct {
-	orders              *models.OrderModel
-	users               *models.UserModel
-	notificationManager *NotificationManager
+	orders               models.OrderStore
+	users                models.UserStore
+	catalog              models.CatalogStore
+	notificationManager  Broker
+	taxRateBps           int64
+	sseHeartbeat         time.Duration
+	sseMaxDuration       time.Duration
+	idempotencyTTL       time.Duration
+	trashRetention       time.Duration
+	archiveAfter         time.Duration
+	loginRecordRetention time.Duration
+	csrfSecret           []byte             // 簽署 CSRF token，見 csrf.go
+	templates            *template.Template // 只用來 Clone，見 renderHTML
 }
 
-// 1. 單元測試時，可以注入假的 MockOrderModel，輕鬆模擬資料庫行為
-// 2. 未來換成 Redis 或其他資料庫，只需要修改 NewHandler 的呼叫處理即可
+// 1. 訂單、帳號與菜單透過 OrderStore / UserStore / CatalogStore 介面注入，單元測試可以傳入 models.NewMemoryStore()，不需要準備資料庫
+// 2. 未來換成 Redis 或其他資料庫，只需要實作這三個介面並修改 NewHandler 的呼叫處理即可
 // 3. 配置靈活，可切換 dev 跟 prod環境
-func NewHandler(dbModel *models.DBModel) *Handler {
+func NewHandler(orders models.OrderStore, users models.UserStore, catalog models.CatalogStore, cfg Config, templates *template.Template) (*Handler, error) {
+	// 少了任何一個 store，handler 會在第一個請求時 panic，啟動時就回報
+	for _, store := range []any{orders, users, catalog} {
+		if isNilStore(store) {
+			return nil, errors.New("NewHandler: orders、users、catalog 都必須提供")
+		}
+	}
+	// 依 Config 決定通知要走單機記憶體還是 Redis
+	broker, err := newBroker(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return &Handler{
-		orders:              &dbModel.Order,
-		users:               &dbModel.User,
-		notificationManager: NewNotificationManager(),
+		orders:               orders,
+		users:                users,
+		catalog:              catalog,
+		notificationManager:  broker,
+		taxRateBps:           cfg.TaxRateBps,
+		sseHeartbeat:         cfg.SSEHeartbeat,
+		sseMaxDuration:       cfg.SSEMaxDuration,
+		idempotencyTTL:       cfg.IdempotencyTTL,
+		trashRetention:       cfg.TrashRetention,
+		archiveAfter:         cfg.ArchiveAfter,
+		loginRecordRetention: cfg.LoginRecordRetention,
+		csrfSecret:           []byte(cfg.SessionSecretKey),
+		templates:            templates,
+	}, nil
+}
+
+// interface 裡包著 nil 指標時 (例如 (*models.OrderModel)(nil)) store == nil 是 false，要檢查實際的值
+func isNilStore(store any) bool {
+	if store == nil {
+		return true
+	}
+	v := reflect.ValueOf(store)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
 	}
+	return false
 }
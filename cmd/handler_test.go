@@ -0,0 +1,25 @@
+package main
+
+import (
+	"pizza-tracker-go/internal/models"
+	"testing"
+)
+
+func TestNewHandlerRequiresStores(t *testing.T) {
+	store := models.NewMemoryStore()
+	if _, err := NewHandler(store, store, nil, loadConfig(), nil); err == nil {
+		t.Fatal("catalog 為 nil 時 NewHandler 應該回傳錯誤")
+	}
+	// interface 裡包著 nil 指標也要擋下來
+	var orders *models.OrderModel
+	if _, err := NewHandler(orders, store, store, loadConfig(), nil); err == nil {
+		t.Fatal("orders 為 nil 的 *OrderModel 時 NewHandler 應該回傳錯誤")
+	}
+	var users *models.MemoryStore
+	if _, err := NewHandler(store, users, store, loadConfig(), nil); err == nil {
+		t.Fatal("users 為 nil 的 *MemoryStore 時 NewHandler 應該回傳錯誤")
+	}
+	if _, err := NewHandler(store, store, store, loadConfig(), nil); err != nil {
+		t.Fatalf("三個 store 都有提供: %v", err)
+	}
+}
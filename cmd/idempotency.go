@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"pizza-tracker-go/internal/models"
+)
+
+/*
+建立訂單的冪等處理，見 models/idempotency.go
+- order.tmpl => 每次顯示表單產生一個隱藏欄位 idempotency_key，連點送出時第二次會導向同一筆訂單
+- POST /api/orders => 呼叫端自行帶 Idempotency-Key header (例如 UUID)，逾時重送時用同一個 key
+沒有帶 key 時維持原本的行為，每次都建立新訂單
+*/
+
+const (
+	idempotencyHeader    = "Idempotency-Key"
+	idempotencyFormField = "idempotency_key"
+	idempotencyKeyMaxLen = 255
+)
+
+var errIdempotencyKeyTooLong = errors.New("Idempotency-Key 不能超過 255 個字元")
+
+// 表單用的一次性 key
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 請求內容的 SHA-256，同一個 key 搭配不同內容時拒絕，避免 key 被誤用在另一筆訂單
+func orderRequestHash(req *OrderReuqest) (string, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// saveOrder 建立訂單，有 key 時同一個 key 只會建立一次
+// scope 區分 key 的來源 (form / api)；replayed 為 true 代表回傳的是先前建立的訂單，不需要再發通知
+func (h *Handler) saveOrder(order *models.Order, req *OrderReuqest, scope, key string) (*models.Order, bool, error) {
+	if key == "" {
+		return order, false, h.orders.CreateOrder(order)
+	}
+	if len(key) > idempotencyKeyMaxLen {
+		return nil, false, errIdempotencyKeyTooLong
+	}
+	hash, err := orderRequestHash(req)
+	if err != nil {
+		return nil, false, err
+	}
+	return h.orders.CreateOrderIdempotent(scope+":"+key, hash, order, h.idempotencyTTL)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// 定期清理資料的背景工作，serve 啟動時執行
+
+// 每個清理工作執行的間隔
+const purgeInterval = time.Hour
+
+func (h *Handler) startBackgroundJobs() {
+	// 過期的 session 紀錄 (/admin/sessions)
+	go runPurgeJob("session", purgeInterval, h.users.PurgeExpiredSessions)
+	// 超過保留期間的登入紀錄與不再需要的登入失敗次數
+	go runPurgeJob("login record", purgeInterval, func() (int64, error) {
+		return h.users.PurgeLoginRecords(h.loginRecordRetention)
+	})
+	// 超過保留時間的 Idempotency-Key
+	go runPurgeJob("idempotency key", purgeInterval, h.orders.PurgeExpiredIdempotencyKeys)
+	// 垃圾桶裡超過保留期間的訂單
+	go runPurgeJob("deleted order", purgeInterval, func() (int64, error) {
+		return h.orders.PurgeDeletedOrders(h.trashRetention)
+	})
+	// 已結案的舊訂單搬到封存資料表
+	if h.archiveAfter > 0 {
+		go runPurgeJob("order archive", purgeInterval, func() (int64, error) {
+			return h.orders.ArchiveOrders(h.archiveAfter)
+		})
+	}
+}
+
+// 每隔 interval 執行一次 purge，失敗只記錄 log，下一次再試
+func runPurgeJob(name string, interval time.Duration, purge func() (int64, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		purged, err := purge()
+		if err != nil {
+			slog.Error("背景清理失敗", "job", name, "error", err)
+			continue
+		}
+		if purged > 0 {
+			slog.Info("背景清理完成", "job", name, "count", purged)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"pizza-tracker-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 登入紀錄與鎖定管理 /admin/logins (需要 audit:view 權限，只有店主有)
+
+type LoginAuditData struct {
+	Attempts []models.LoginAttempt
+	Locks    []models.LoginThrottle
+	Labels   map[string]string // 登入結果的中文名稱
+	Query    models.LoginAttemptQuery
+	Username string
+	Error    string
+	Notice   string
+}
+
+type loginUnlockForm struct {
+	Key string `form:"key" json:"key" binding:"required"`
+}
+
+// 查詢條件: ?username=&ip=&failed=1
+func loginAttemptQuery(c *gin.Context) models.LoginAttemptQuery {
+	return models.LoginAttemptQuery{
+		Username:   c.Query("username"),
+		IP:         c.Query("ip"),
+		FailedOnly: c.Query("failed") == "1",
+	}
+}
+
+func (h *Handler) ServeLoginAudit(c *gin.Context) {
+	h.renderLoginAudit(c, http.StatusOK, "", "")
+}
+
+func (h *Handler) renderLoginAudit(c *gin.Context, status int, errMsg, notice string) {
+	q := loginAttemptQuery(c)
+	attempts, err := h.users.ListLoginAttempts(q)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取登入紀錄失敗")
+		return
+	}
+	locks, err := h.users.ListLoginLocks()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取登入鎖定失敗")
+		return
+	}
+	h.renderHTML(c, status, "logins.tmpl", LoginAuditData{
+		Attempts: attempts,
+		Locks:    locks,
+		Labels:   models.LoginResultLabels,
+		Query:    q,
+		Username: GetSession(c, "username"),
+		Error:    errMsg,
+		Notice:   notice,
+	})
+}
+
+func (h *Handler) handleLoginUnlock(c *gin.Context) {
+	var form loginUnlockForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderLoginAudit(c, http.StatusBadRequest, "Invalid input: "+err.Error(), "")
+		return
+	}
+	if err := h.users.UnlockLogin(form.Key); err != nil {
+		h.renderLoginAudit(c, loginErrorCode(err), err.Error(), "")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/logins")
+}
+
+// GET /api/admin/logins?username=&ip=&failed=1
+func (h *Handler) listLoginAttemptsJSON(c *gin.Context) {
+	attempts, err := h.users.ListLoginAttempts(loginAttemptQuery(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "讀取登入紀錄失敗")
+		return
+	}
+	locks, err := h.users.ListLoginLocks()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "讀取登入鎖定失敗")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"attempts": attempts, "locks": locks})
+}
+
+// POST /api/admin/logins/unlock
+func (h *Handler) unlockLoginJSON(c *gin.Context) {
+	var body loginUnlockForm
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if err := h.users.UnlockLogin(body.Key); err != nil {
+		respondError(c, loginErrorCode(err), err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func loginErrorCode(err error) int {
+	if errors.Is(err, models.ErrLoginLockNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
 	"pizza-tracker-go/internal/models"
@@ -32,38 +33,65 @@ func main() {
 	}
 	slog.SetDefault(slog.New(handler))
 
+	// 沒有子指令時等同 serve，維持原本 go run ./cmd 的行為；其他子指令見 cli.go
+	os.Exit(runCommand(cfg, os.Args[1:]))
+}
+
+// 啟動 HTTP server，只有啟動失敗時才會回傳
+func serve(cfg Config) error {
 	// 1. 先初始化DB，連接DB，接著才處理結構體可以使用tag規則
 	// dbModel := &DBModel{
 	// 	DB: db, // *gorm.DB 把sqlite的 db gorm物件覆寫
 	// 	Order: OrderModel{DB: db}, // 把sqlite的 db gorm物件覆寫在 OrderModel裡的 DB
 	// }
-	dbModel, err := models.InitDB(cfg.DBPath)
+	dbModel, err := models.InitDB(cfg.dbConfig())
 
 	if err != nil {
-		slog.Error("資料庫初始化失敗", "error", err)
-		os.Exit(1)
+		return fmt.Errorf("資料庫初始化失敗: %w", err)
 	}
 
-	slog.Info("資料庫連接成功", "path", cfg.DBPath)
+	slog.Info("資料庫連接成功", "driver", dbModel.DB.Dialector.Name(), "url", models.RedactDatabaseURL(cfg.DatabaseURL))
 	// 處理結構體可以使用tag規則
-	RegisterCustomValidators()
+	RegisterCustomValidators(&dbModel.Catalog)
+	// SeedDefaults 只建立商品與尺寸，價格要由店家設定；沒有價格時所有訂單都會被拒絕
+	if prices, err := dbModel.Catalog.ActivePrices(); err == nil && len(prices) == 0 {
+		slog.Warn("菜單還沒有設定任何價格，顧客目前無法下單；請到 /admin/catalog 設定價格，或執行 seed 寫入示範價格")
+	}
 
-	h := NewHandler(dbModel) // 綁定了資料庫跟對應的模組裡的方法
+	templates, err := loadTemplates() // 載入模板文件
+	if err != nil {
+		return fmt.Errorf("載入模板失敗: %w", err)
+	}
 
-	// gin.Default()是对gin.new()的封装，加入了局日志和错误恢复中间件
-	// Gin 框架在默认情况下设置了全局的日志（logger）和恢复（recovery）中间件。这些中间件对于记录请求信息和恢复从 panic 中恢复的功能是非常有用的
-	router := gin.Default()                       // https://juejin.cn/post/7325611798136487986
-	if err := loadTemplates(router); err != nil { // 載入模板文件
-		slog.Error("載入模板失敗", "error", err)
-		os.Exit(1)
+	h, err := NewHandler(&dbModel.Order, &dbModel.User, &dbModel.Catalog, cfg, templates) // 綁定了資料庫跟對應的模組裡的方法
+	if err != nil {
+		return fmt.Errorf("通知服務 (%s) 初始化失敗: %w", cfg.NotifyBackend, err)
+	}
+
+	router, err := newRouter(cfg)
+	if err != nil {
+		return err
 	}
 
 	sessionStore := createSessionStore(dbModel.DB, []byte(cfg.SessionSecretKey))
 	setupRoutes(router, h, sessionStore)
+	h.startBackgroundJobs()
 	// slog.Info("hello, world", "user", os.Getenv("USER"))
 	// 2023/08/04 16:27:19 INFO hello, world user=jba
 	// 下方 => 2025/01/12 16:27:19 INFO 啟動伺服器 url=http
 	slog.Info("Server starting", "url", "http://localhost:"+cfg.Port)
 
-	router.Run(":" + cfg.Port)
+	return router.Run(":" + cfg.Port)
+}
+
+func newRouter(cfg Config) (*gin.Engine, error) {
+	// gin.Default()是对gin.new()的封装，加入了局日志和错误恢复中间件
+	// Gin 框架在默认情况下设置了全局的日志（logger）和恢复（recovery）中间件。这些中间件对于记录请求信息和恢复从 panic 中恢复的功能是非常有用的
+	router := gin.Default() // https://juejin.cn/post/7325611798136487986
+	// c.ClientIP() 用在登入失敗的 IP 限制與 SSE 的 IP 連線上限，預設 gin 信任所有 proxy，
+	// 任何人都能用 X-Forwarded-For 假造 IP；只有 TRUSTED_PROXIES 列出的 proxy 送來的 header 才採用
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES 設定錯誤: %w", err)
+	}
+	return router, nil
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 只有 TRUSTED_PROXIES 列出的 proxy 送來的 X-Forwarded-For 才採用，其他人不能假造 IP
+func TestTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1")
+	cfg := loadConfig()
+	router, err := newRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{"10.1.2.3:5000", "203.0.113.9"},
+		{"192.168.1.1:5000", "203.0.113.9"},
+		{"198.51.100.7:5000", "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if got := w.Body.String(); got != tt.want {
+			t.Errorf("從 %s 連線的 ClientIP = %s，預期 %s", tt.remoteAddr, got, tt.want)
+		}
+	}
+
+	// 沒有設定時不信任任何 proxy
+	t.Setenv("TRUSTED_PROXIES", "")
+	router, err = newRouter(loadConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+	req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+	req.RemoteAddr = "10.1.2.3:5000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if got := w.Body.String(); got != "10.1.2.3" {
+		t.Fatalf("沒有 TRUSTED_PROXIES 時 ClientIP = %s", got)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "not-an-ip")
+	if _, err := newRouter(loadConfig()); err == nil {
+		t.Fatal("TRUSTED_PROXIES 格式錯誤時應該回傳錯誤")
+	}
+}
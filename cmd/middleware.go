@@ -1,11 +1,20 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"pizza-tracker-go/internal/models"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// AuthMiddleware 驗證成功後，把目前登入的 User 放進 gin.Context 的 key
+const contextUserKey = "currentUser"
+
+// APIAuthMiddleware 用 API token 驗證時，把 token 放進 gin.Context 的 key
+const contextAPITokenKey = "currentAPIToken"
+
 // https://zhuanlan.zhihu.com/p/30184285330
 func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -37,7 +46,190 @@ func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 3. 驗證成功 => 執行 route group /admin 中的 handler
+		// 3. 帳號已被停用 => 清掉 session 強制登出，停用後的下一個請求就會生效
+		if user.Disabled {
+			ClearAllSession(c)
+			c.Redirect(http.StatusSeeOther, "/login")
+			c.AbortWithStatusJSON(403, gin.H{"error": "帳號已停用"})
+			return
+		}
+
+		// 3-1. session 已經被遠端登出 (/admin/sessions、重設密碼)，見 sessions.go
+		if err := h.users.TouchSession(currentSessionID(c), user.ID, c.ClientIP()); err != nil {
+			if errors.Is(err, models.ErrSessionRevoked) {
+				ClearAllSession(c)
+				c.Redirect(http.StatusSeeOther, "/login")
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(500, gin.H{"error": "資料庫錯誤"})
+			return
+		}
+
+		// 4. 角色被要求必須啟用兩步驟驗證但還沒設定 => 只能使用 /admin/account 底下的頁面 (設定兩步驟驗證、修改密碼)
+		c.Set(contextUserKey, user)
+		if !strings.HasPrefix(c.Request.URL.Path, "/admin/account/") {
+			pending, err := h.twoFactorPending(user)
+			if err != nil {
+				c.AbortWithStatusJSON(500, gin.H{"error": "資料庫錯誤"})
+				return
+			}
+			if pending {
+				c.Redirect(http.StatusSeeOther, "/admin/account/2fa")
+				c.Abort()
+				return
+			}
+		}
+
+		// 5. 驗證成功 => 執行 route group /admin 中的 handler
+		// 每次請求都從資料庫讀取，角色調整後下一個請求就會生效
+		c.Next()
+	}
+}
+
+// 角色被要求啟用兩步驟驗證，但這個帳號還沒設定
+func (h *Handler) twoFactorPending(user *models.User) (bool, error) {
+	if user.TOTPEnabled {
+		return false, nil
+	}
+	return h.users.TwoFactorRequired(user.Role)
+}
+
+/*
+APIAuthMiddleware => /api/admin 使用，失敗時一律回傳 JSON 401 / 403，不會重導向到 /login
+1. 有 Authorization: Bearer <token> => 用 API token 驗證 (POS 串接腳本等)，權限再受 token 的 scopes 限制
+2. 沒有 => 跟 AuthMiddleware 一樣讀 cookie session (React 後台)
+*/
+func (h *Handler) APIAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if header := c.GetHeader("Authorization"); header != "" {
+			h.authenticateBearer(c, header)
+			return
+		}
+
+		userID := GetSession(c, "userID")
+		if userID == "" {
+			respondError(c, http.StatusUnauthorized, "請先登入或使用 API token")
+			return
+		}
+		user, err := h.users.GetUserByID(userID)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "資料庫錯誤")
+			return
+		}
+		if user == nil {
+			respondError(c, http.StatusUnauthorized, "資料庫裡已經沒有這個使用者")
+			return
+		}
+		if user.Disabled {
+			ClearAllSession(c)
+			respondError(c, http.StatusForbidden, "帳號已停用")
+			return
+		}
+		if err := h.users.TouchSession(currentSessionID(c), user.ID, c.ClientIP()); err != nil {
+			if errors.Is(err, models.ErrSessionRevoked) {
+				ClearAllSession(c)
+				respondError(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+			respondError(c, http.StatusInternalServerError, "資料庫錯誤")
+			return
+		}
+		// 帳號自己的設定 (修改密碼) 不受兩步驟驗證限制，跟 /admin/account 一樣
+		if !strings.HasPrefix(c.Request.URL.Path, "/api/admin/account/") {
+			pending, err := h.twoFactorPending(user)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, "資料庫錯誤")
+				return
+			}
+			if pending {
+				respondError(c, http.StatusForbidden, "目前的角色必須先啟用兩步驟驗證")
+				return
+			}
+		}
+
+		c.Set(contextUserKey, user)
+		c.Next()
+	}
+}
+
+// Authorization: Bearer pzt_xxx
+// 401 時依 RFC 6750 加上 WWW-Authenticate，讓呼叫端知道要換 token
+func (h *Handler) authenticateBearer(c *gin.Context, header string) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		c.Header("WWW-Authenticate", `Bearer realm="api"`)
+		respondError(c, http.StatusUnauthorized, "Authorization header 格式錯誤，應為 Bearer <token>")
+		return
+	}
+
+	apiToken, user, err := h.users.AuthenticateAPIToken(strings.TrimSpace(token))
+	switch {
+	case errors.Is(err, models.ErrAPITokenInvalid):
+		c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+		respondError(c, http.StatusUnauthorized, err.Error())
+		return
+	case errors.Is(err, models.ErrUserDisabled):
+		respondError(c, http.StatusForbidden, "帳號已停用")
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "資料庫錯誤")
+		return
+	}
+
+	c.Set(contextUserKey, user)
+	c.Set(contextAPITokenKey, apiToken)
+	c.Next()
+}
+
+// 取得 AuthMiddleware 放進 context 的登入者，沒有經過 AuthMiddleware 時回傳 nil
+func currentUser(c *gin.Context) *models.User {
+	user, _ := c.Get(contextUserKey)
+	u, _ := user.(*models.User)
+	return u
+}
+
+// 用 API token 呼叫時回傳該 token，cookie session 回傳 nil
+func currentAPIToken(c *gin.Context) *models.APIToken {
+	token, _ := c.Get(contextAPITokenKey)
+	t, _ := token.(*models.APIToken)
+	return t
+}
+
+// 目前登入者的角色，沒有登入時為空字串 (沒有任何權限)
+func currentRole(c *gin.Context) models.Role {
+	if user := currentUser(c); user != nil {
+		return user.Role
+	}
+	return ""
+}
+
+// RequirePermission => 放在 AuthMiddleware 之後，登入者的角色沒有該權限時回傳 403
+// 用 API token 呼叫時，token 的 scopes 也必須包含該權限
+// /api 開頭的路由回傳 JSON 錯誤格式，其他回傳純文字
+func RequirePermission(p models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := currentAPIToken(c)
+		if currentRole(c).Can(p) && (token == nil || token.HasScope(p)) {
+			c.Next()
+			return
+		}
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			respondError(c, http.StatusForbidden, "沒有權限執行此操作")
+			return
+		}
+		c.String(http.StatusForbidden, "沒有權限執行此操作")
+		c.Abort()
+	}
+}
+
+// RequireSession => API token 不能使用的路由 (修改密碼、管理 token)，避免外流的 token 被用來擴大權限
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentAPIToken(c) != nil {
+			respondError(c, http.StatusForbidden, "此操作需要登入後台，不能使用 API token")
+			return
+		}
 		c.Next()
 	}
 }
@@ -1,21 +1,38 @@
 package main
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
 
 /*
 RWMutex (讀寫鎖)：區分「讀」和「寫」兩種操作：
 讀鎖 (RLock)：允許多個 goroutine 同時讀取資源，只要沒有 goroutine 在寫。
 寫鎖 (Lock)：只允許一個 goroutine 寫入資源，並且會阻塞所有其他的讀和寫。
+
+NotificationManager => 單一程序內的 Broker 實作，只能通知連到同一台機器的 client
+每個 topic 另外保留最近的事件 (replay)，讓斷線重連的 client 可以補收漏掉的通知
 */
 type NotificationManager struct {
-	clients map[string]map[chan string]bool
-	mu      sync.RWMutex // 讀寫鎖 (Read-Write Mutex)
+	clients   map[string]map[chan Event]bool
+	replay    map[string]*eventRing
+	lastSweep time.Time
+	mu        sync.RWMutex // 讀寫鎖 (Read-Write Mutex)
+
+	limits    SubscriberLimits
+	clientIPs map[chan Event]string // 每個 client 來自哪個 IP
+	perIP     map[string]int        // 每個 IP 目前的連線數
+	evicted   uint64
+	rejected  uint64
 }
 
-/* clients: make(map[string]map[chan string]bool)
+/* clients: make(map[string]map[chan Event]bool)
 當有新訂單事件發生時，系統只需遍歷對應主題的 channel 清單，即可只推送給相關訂單的客戶端，避免浪費資源全域廣播。
-這種巢狀 map[string]map[chan string]bool 結構實現多播通知（Pub/Sub Pattern）：
-clients map[string]map[chan string]bool = {
+這種巢狀 map[string]map[chan Event]bool 結構實現多播通知（Pub/Sub Pattern）：
+clients map[string]map[chan Event]bool = {
 	"order-123": { // 頻道名稱 (TOPIC)
 		// 該群組內所有客戶端的 channel，當消息有發布的時候，只有下列這些client有訂閱過該頻道(TOPIC)的才會收到訊息
 		0xc0000a4000: true,
@@ -29,47 +46,148 @@ clients map[string]map[chan string]bool = {
 	},
 }
 */
-func NewNotificationManager() *NotificationManager {
-	return &NotificationManager{clients: make(map[string]map[chan string]bool)}
+func NewNotificationManager(limits SubscriberLimits) *NotificationManager {
+	return &NotificationManager{
+		clients:   make(map[string]map[chan Event]bool),
+		replay:    make(map[string]*eventRing),
+		lastSweep: time.Now(),
+		limits:    limits,
+		clientIPs: make(map[chan Event]string),
+		perIP:     make(map[string]int),
+	}
 }
 
 // 1. 訂閱頻道
-func (n *NotificationManager) Subscribe(topic string, client chan string) {
+// 在同一把鎖內取出補送的事件並加入訂閱，中間不會有事件被漏掉或重複
+func (n *NotificationManager) Subscribe(ctx context.Context, topic string, client chan Event, opts SubscribeOptions) ([]Event, error) {
 	n.mu.Lock()         // 🔒 上鎖
 	defer n.mu.Unlock() // 🔓 自動解鎖
 
+	if n.limits.PerTopic > 0 && len(n.clients[topic]) >= n.limits.PerTopic {
+		n.rejected++
+		return nil, fmt.Errorf("%w: topic %s", ErrTooManySubscribers, topic)
+	}
+	if n.limits.PerIP > 0 && opts.ClientIP != "" && n.perIP[opts.ClientIP] >= n.limits.PerIP {
+		n.rejected++
+		return nil, fmt.Errorf("%w: IP %s", ErrTooManySubscribers, opts.ClientIP)
+	}
+
 	if n.clients[topic] == nil { // ⚠️ Race Condition，使用 Lock 跟 Unlock 就不會有這問題
-		n.clients[topic] = make(map[chan string]bool)
+		n.clients[topic] = make(map[chan Event]bool)
 	}
 	n.clients[topic][client] = true
+	if opts.ClientIP != "" {
+		n.clientIPs[client] = opts.ClientIP
+		n.perIP[opts.ClientIP]++
+	}
+
+	var backlog []Event
+	if ring, ok := n.replay[topic]; ok {
+		backlog = eventsAfter(ring.all(), opts.LastEventID)
+	}
+	return backlog, nil
 }
 
 // 2. 取消訂閱頻道
-func (n *NotificationManager) Unsubscribe(topic string, client chan string) {
+func (n *NotificationManager) Unsubscribe(ctx context.Context, topic string, client chan Event) error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
-	if clients, ok := n.clients[topic]; ok {
-		delete(clients, client)
-	}
+	n.removeClient(topic, client)
+	return nil
+}
 
-	if len(n.clients[topic]) == 0 {
+// 從 topic 移除 client 並 close，client 已經被移除 (例如因為太慢被踢掉) 時什麼都不做，避免重複 close
+// 呼叫前必須持有寫鎖
+func (n *NotificationManager) removeClient(topic string, client chan Event) {
+	clients, ok := n.clients[topic]
+	if !ok || !clients[client] {
+		return
+	}
+	delete(clients, client)
+	if len(clients) == 0 {
 		delete(n.clients, topic)
 	}
-
+	if ip, ok := n.clientIPs[client]; ok {
+		delete(n.clientIPs, client)
+		if n.perIP[ip]--; n.perIP[ip] <= 0 {
+			delete(n.perIP, ip)
+		}
+	}
 	close(client)
 }
 
-// 2. 對特定頻道發送通知
-func (n *NotificationManager) Publish(room_id string, message string) {
+func (n *NotificationManager) Stats() BrokerStats {
 	n.mu.RLock()
 	defer n.mu.RUnlock()
 
-	if clients, ok := n.clients[room_id]; ok {
-		for client := range clients {
-			select {
-			case client <- message: // 非阻塞發送
-			default: // 客戶端緩衝滿，忽略
-			}
+	stats := BrokerStats{
+		Topics:       make(map[string]int, len(n.clients)),
+		ClientIPs:    len(n.perIP),
+		ReplayTopics: len(n.replay),
+		Evicted:      n.evicted,
+		Rejected:     n.rejected,
+	}
+	for topic, clients := range n.clients {
+		stats.Topics[topic] = len(clients)
+		stats.Subscribers += len(clients)
+	}
+	return stats
+}
+
+// 3. 對特定頻道發送通知
+// 事件 ID 由這個 topic 的緩衝區接續編號
+func (n *NotificationManager) Publish(ctx context.Context, room_id string, ev Event) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var lastID uint64
+	if ring, ok := n.replay[room_id]; ok {
+		lastID = ring.lastID
+	}
+	ev.ID = lastID + 1
+	n.deliverLocked(room_id, ev)
+	return nil
+}
+
+// 送出已經編好 ID 的事件，RedisBroker 收到其他機器發布的事件時使用 (ID 由 Redis 統一產生)
+func (n *NotificationManager) deliver(topic string, ev Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliverLocked(topic, ev)
+}
+
+func (n *NotificationManager) deliverLocked(topic string, ev Event) {
+	n.sweepLocked()
+
+	ring, ok := n.replay[topic]
+	if !ok {
+		ring = newEventRing()
+		n.replay[topic] = ring
+	}
+	ring.push(ev)
+
+	for client := range n.clients[topic] {
+		select {
+		case client <- ev: // 非阻塞發送
+		default:
+			// 客戶端緩衝滿 => 直接斷開，瀏覽器會帶著 Last-Event-ID 重連，漏掉的事件從緩衝區補送
+			slog.Warn("SSE client 來不及接收，中斷連線", "topic", topic, "eventId", ev.ID)
+			n.removeClient(topic, client)
+			n.evicted++
+		}
+	}
+}
+
+// 每分鐘最多清一次：沒有人訂閱、且超過 replayTTL 沒有新事件的 topic 不再保留緩衝區
+func (n *NotificationManager) sweepLocked() {
+	now := time.Now()
+	if now.Sub(n.lastSweep) < time.Minute {
+		return
+	}
+	n.lastSweep = now
+	for topic, ring := range n.replay {
+		if len(n.clients[topic]) == 0 && now.Sub(ring.updated) > replayTTL {
+			delete(n.replay, topic)
 		}
 	}
 }
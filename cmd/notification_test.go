@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func subscribeTest(t *testing.T, n *NotificationManager, topic, ip string) chan Event {
+	t.Helper()
+	client := make(chan Event, 10)
+	if _, err := n.Subscribe(context.Background(), topic, client, SubscribeOptions{ClientIP: ip}); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestNotificationManagerPerTopicLimit(t *testing.T) {
+	n := NewNotificationManager(SubscriberLimits{PerTopic: 2})
+	ctx := context.Background()
+	first := subscribeTest(t, n, "order:1", "10.0.0.1")
+	subscribeTest(t, n, "order:1", "10.0.0.2")
+
+	_, err := n.Subscribe(ctx, "order:1", make(chan Event, 1), SubscribeOptions{ClientIP: "10.0.0.3"})
+	if !errors.Is(err, ErrTooManySubscribers) {
+		t.Fatalf("超過 topic 上限: %v", err)
+	}
+	// 其他 topic 不受影響
+	subscribeTest(t, n, "order:2", "10.0.0.3")
+
+	// 取消訂閱後空出名額，被取消的 client 會被 close
+	if err := n.Unsubscribe(ctx, "order:1", first); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-first; ok {
+		t.Fatal("取消訂閱後 client 應該被關閉")
+	}
+	subscribeTest(t, n, "order:1", "10.0.0.3")
+
+	if stats := n.Stats(); stats.Rejected != 1 || stats.Topics["order:1"] != 2 || stats.Subscribers != 3 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestNotificationManagerPerIPLimit(t *testing.T) {
+	n := NewNotificationManager(SubscriberLimits{PerIP: 2})
+	ctx := context.Background()
+	first := subscribeTest(t, n, "order:1", "10.0.0.1")
+	subscribeTest(t, n, "order:2", "10.0.0.1")
+
+	// 同一個 IP 的上限是所有 topic 合計
+	_, err := n.Subscribe(ctx, "order:3", make(chan Event, 1), SubscribeOptions{ClientIP: "10.0.0.1"})
+	if !errors.Is(err, ErrTooManySubscribers) {
+		t.Fatalf("超過 IP 上限: %v", err)
+	}
+	subscribeTest(t, n, "order:3", "10.0.0.2")
+	// 沒有 IP 的訂閱不計算
+	for range 3 {
+		subscribeTest(t, n, "order:3", "")
+	}
+
+	if err := n.Unsubscribe(ctx, "order:1", first); err != nil {
+		t.Fatal(err)
+	}
+	subscribeTest(t, n, "order:3", "10.0.0.1")
+	if stats := n.Stats(); stats.Rejected != 1 || stats.ClientIPs != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+// 緩衝區滿的 client 被踢掉並 close，名額一併釋放，其他 client 照常收到
+func TestNotificationManagerEvictsSlowClient(t *testing.T) {
+	n := NewNotificationManager(SubscriberLimits{PerIP: 1})
+	ctx := context.Background()
+	slow := make(chan Event, 1)
+	if _, err := n.Subscribe(ctx, "order:1", slow, SubscribeOptions{ClientIP: "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	fast := subscribeTest(t, n, "order:1", "10.0.0.2")
+
+	for _, data := range []string{"first", "second"} {
+		if err := n.Publish(ctx, "order:1", Event{Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ev := <-slow; ev.ID != 1 {
+		t.Fatalf("被踢掉前收到的事件 = %+v", ev)
+	}
+	if _, ok := <-slow; ok {
+		t.Fatal("來不及接收的 client 應該被關閉")
+	}
+	for want := uint64(1); want <= 2; want++ {
+		if ev := <-fast; ev.ID != want {
+			t.Fatalf("收到的事件 = %+v，預期 ID %d", ev, want)
+		}
+	}
+
+	// 已經被踢掉的 client 再取消訂閱不會出錯，也不會重複 close
+	if err := n.Unsubscribe(ctx, "order:1", slow); err != nil {
+		t.Fatal(err)
+	}
+	subscribeTest(t, n, "order:1", "10.0.0.1")
+	if stats := n.Stats(); stats.Evicted != 1 || stats.Subscribers != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
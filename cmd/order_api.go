@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"pizza-tracker-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 顧客端 (手機 App) 使用的 JSON API，功能與 order.tmpl / customer.tmpl 相同
+
+// GET /api/orders/:id 的回應 => 訂單內容加上目前狀態在 OrderStatues 中的位置，方便畫進度條
+// StatusEvents 蓋掉 Order 裡的同名欄位，只輸出顧客看得到的歷程 (沒有 userId / note)
+type orderStatusResponse struct {
+	*models.Order
+	StatusEvents []publicStatusEvent `json:"statusEvents,omitempty"`
+	StatusIndex  int                 `json:"statusIndex"`
+	Statuses     []string            `json:"statuses"`
+}
+
+func newOrderStatusResponse(order *models.Order) orderStatusResponse {
+	return orderStatusResponse{
+		Order:        order,
+		StatusEvents: publicStatusEvents(order.StatusEvents),
+		StatusIndex:  models.StatusIndex(order.Status),
+		Statuses:     models.OrderStatues,
+	}
+}
+
+// POST /api/orders
+// 成功回傳 201 + Location: /api/orders/:id
+// 帶 Idempotency-Key header 時，同一個 key 重送會拿到原本的訂單 (一樣是 201，加上 Idempotent-Replayed: true)
+func (h *Handler) createOrderJSON(c *gin.Context) {
+	var req OrderReuqest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	order, err := req.toOrder()
+	if err != nil {
+		respondError(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err := h.catalog.PriceOrder(&order, h.taxRateBps); err != nil {
+		if errors.Is(err, models.ErrPriceNotSet) {
+			respondError(c, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "計算訂單金額失敗")
+		return
+	}
+
+	saved, replayed, err := h.saveOrder(&order, &req, "api", c.GetHeader(idempotencyHeader))
+	if err != nil {
+		if errors.Is(err, models.ErrIdempotencyKeyReused) || errors.Is(err, errIdempotencyKeyTooLong) {
+			respondError(c, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if errors.Is(err, models.ErrIdempotentOrderGone) {
+			respondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		slog.Error("處理請求失敗", "error", err)
+		respondError(c, http.StatusInternalServerError, "建立訂單失敗")
+		return
+	}
+	if replayed {
+		c.Header("Idempotent-Replayed", "true")
+	} else {
+		slog.Info("Order created", "orderId", saved.ID, "customer", saved.CustomerName, "via", "api")
+		h.publishOrderEvent(c, orderCreatedEvent(saved))
+	}
+
+	c.Header("Location", "/api/orders/"+saved.ID)
+	c.JSON(http.StatusCreated, newOrderStatusResponse(saved))
+}
+
+// GET /api/orders/:id
+func (h *Handler) getOrderStatusJSON(c *gin.Context) {
+	order, err := h.orders.FindOrder(c.Param("id"))
+	if err != nil {
+		respondError(c, orderErrorCode(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, newOrderStatusResponse(order))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"pizza-tracker-go/internal/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SSE 的 event: 名稱，前端依名稱分別處理，不需要比對中文訊息
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+	EventOrderDeleted       = "order.deleted"
+	EventOrderRestored      = "order.restored" // 從垃圾桶還原
+)
+
+// 後台的 SSE 頻道，所有訂單的事件都會送一份過來；顧客則是訂閱自己訂單的 order:<id>
+const adminTopic = "admin:new_orders"
+
+func orderTopic(orderID string) string {
+	return "order:" + orderID
+}
+
+/*
+OrderEvent => 訂單事件的內容，以 JSON 放在 SSE 的 data: 欄位
+
+	event: order.status_changed
+	data: {"type":"order.status_changed","orderId":"abc","oldStatus":"已成功下單","newStatus":"製作中","statusIndex":1,"timestamp":"..."}
+
+StatusIndex => 新狀態在 OrderStatues 中的位置，顧客頁的進度條直接拿來用；order.deleted 時為 -1
+*/
+type OrderEvent struct {
+	Type        string    `json:"type"`
+	OrderID     string    `json:"orderId"`
+	OldStatus   string    `json:"oldStatus,omitempty"`
+	NewStatus   string    `json:"newStatus,omitempty"`
+	StatusIndex int       `json:"statusIndex"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func orderCreatedEvent(order *models.Order) OrderEvent {
+	return OrderEvent{
+		Type:        EventOrderCreated,
+		OrderID:     order.ID,
+		NewStatus:   order.Status,
+		StatusIndex: models.StatusIndex(order.Status),
+		Timestamp:   order.CreatedAt,
+	}
+}
+
+func orderStatusChangedEvent(event *models.OrderStatusEvent) OrderEvent {
+	return OrderEvent{
+		Type:        EventOrderStatusChanged,
+		OrderID:     event.OrderID,
+		OldStatus:   event.FromStatus,
+		NewStatus:   event.ToStatus,
+		StatusIndex: models.StatusIndex(event.ToStatus),
+		Timestamp:   event.CreatedAt,
+	}
+}
+
+func orderDeletedEvent(orderID string) OrderEvent {
+	return OrderEvent{
+		Type:        EventOrderDeleted,
+		OrderID:     orderID,
+		StatusIndex: -1,
+		Timestamp:   time.Now(),
+	}
+}
+
+func orderRestoredEvent(order *models.Order) OrderEvent {
+	return OrderEvent{
+		Type:        EventOrderRestored,
+		OrderID:     order.ID,
+		NewStatus:   order.Status,
+		StatusIndex: models.StatusIndex(order.Status),
+		Timestamp:   time.Now(),
+	}
+}
+
+// 同一個事件同時送給該訂單的顧客與後台
+func (h *Handler) publishOrderEvent(c *gin.Context, ev OrderEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		slog.Error("序列化訂單事件失敗", "type", ev.Type, "error", err)
+		return
+	}
+	for _, topic := range []string{orderTopic(ev.OrderID), adminTopic} {
+		h.publish(c, topic, Event{Type: ev.Type, Data: string(data)})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import "time"
+
+const (
+	replayBufferSize = 50               // 每個 topic 最多保留幾筆事件供斷線重連時補送
+	replayTTL        = 10 * time.Minute // topic 超過這段時間沒有新事件也沒有人訂閱，就把緩衝區丟掉
+)
+
+/*
+Event => 送給 SSE client 的一筆通知
+
+	ID 在同一個 topic 內單調遞增，會當成 SSE 的 id: 欄位送出，
+	瀏覽器斷線重連時會自動帶上 Last-Event-ID，server 就能把中間漏掉的事件補送回去
+	Type 會當成 SSE 的 event: 欄位 (例如 order.created)，前端用 addEventListener 分別處理
+*/
+type Event struct {
+	ID   uint64 `json:"id"`
+	Type string `json:"type,omitempty"`
+	Data string `json:"data"`
+}
+
+// 固定大小的環狀緩衝區，只保留最近 replayBufferSize 筆事件
+type eventRing struct {
+	events  []Event
+	next    int // 下一筆要寫入的位置
+	lastID  uint64
+	updated time.Time
+}
+
+func newEventRing() *eventRing {
+	return &eventRing{events: make([]Event, 0, replayBufferSize), updated: time.Now()}
+}
+
+func (r *eventRing) push(ev Event) {
+	if len(r.events) < replayBufferSize {
+		r.events = append(r.events, ev)
+	} else {
+		r.events[r.next] = ev
+	}
+	r.next = (r.next + 1) % replayBufferSize
+	r.lastID = ev.ID
+	r.updated = time.Now()
+}
+
+// 依 ID 由舊到新回傳緩衝區內所有事件
+func (r *eventRing) all() []Event {
+	if len(r.events) < replayBufferSize {
+		return append([]Event(nil), r.events...)
+	}
+	return append(append([]Event(nil), r.events[r.next:]...), r.events[:r.next]...)
+}
+
+/*
+eventsAfter => 從由舊到新排序的事件中，挑出 ID 大於 lastID 的部分
+
+	lastID 比緩衝區裡最新的 ID 還大，代表序號已經重置 (例如 server 重啟、緩衝區過期)，
+	client 手上的 ID 已經沒有意義，整個緩衝區都補送
+*/
+func eventsAfter(events []Event, lastID uint64) []Event {
+	if lastID == 0 || len(events) == 0 {
+		return nil
+	}
+	if events[len(events)-1].ID < lastID {
+		return events
+	}
+	for i, ev := range events {
+		if ev.ID > lastID {
+			return events[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func eventIDs(events []Event) []uint64 {
+	ids := make([]uint64, len(events))
+	for i, ev := range events {
+		ids[i] = ev.ID
+	}
+	return ids
+}
+
+func eventsWithIDs(ids ...uint64) []Event {
+	events := make([]Event, len(ids))
+	for i, id := range ids {
+		events[i] = Event{ID: id}
+	}
+	return events
+}
+
+func TestEventsAfter(t *testing.T) {
+	buffered := eventsWithIDs(5, 6, 7, 8)
+	tests := []struct {
+		name   string
+		events []Event
+		lastID uint64
+		want   []uint64
+	}{
+		{"緩衝區是空的", nil, 3, nil},
+		{"沒有 Last-Event-ID", buffered, 0, nil},
+		{"從中間接續", buffered, 6, []uint64{7, 8}},
+		{"比最舊的事件還舊，能補的全部補送", buffered, 2, []uint64{5, 6, 7, 8}},
+		{"等於最新的事件，不用補送", buffered, 8, nil},
+		{"序號重置 (緩衝區過期被清掉) 後 client 的 ID 比較大，整個緩衝區補送", eventsWithIDs(1, 2), 8, []uint64{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := eventIDs(eventsAfter(tt.events, tt.lastID))
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("eventsAfter(%d) = %v，預期 %v", tt.lastID, got, tt.want)
+			}
+		})
+	}
+}
+
+// 環狀緩衝區寫滿後覆蓋最舊的事件，all() 仍然由舊到新排序
+func TestEventRingKeepsLatestEvents(t *testing.T) {
+	ring := newEventRing()
+	for id := uint64(1); id <= replayBufferSize+7; id++ {
+		ring.push(Event{ID: id})
+	}
+	got := eventIDs(ring.all())
+	if len(got) != replayBufferSize {
+		t.Fatalf("緩衝區有 %d 筆，應該只保留 %d 筆", len(got), replayBufferSize)
+	}
+	for i, id := range got {
+		if want := uint64(8 + i); id != want {
+			t.Fatalf("第 %d 筆 ID = %d，預期 %d", i, id, want)
+		}
+	}
+	if ring.lastID != replayBufferSize+7 {
+		t.Fatalf("lastID = %d", ring.lastID)
+	}
+}
+
+func TestLastEventIDHeader(t *testing.T) {
+	tests := map[string]uint64{
+		"":     0,
+		"42":   42,
+		"abc":  0,
+		"-1":   0,
+		" 7":   0,
+		"1e3":  0,
+		"0042": 42,
+	}
+	for header, want := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			c.Request.Header.Set("Last-Event-ID", header)
+		}
+		if got := lastEventID(c); got != want {
+			t.Errorf("Last-Event-ID %q => %d，預期 %d", header, got, want)
+		}
+	}
+}
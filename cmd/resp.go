@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+/*
+RESP (REdis Serialization Protocol) 的最小實作，只涵蓋 pub/sub 需要的部分
+https://redis.io/docs/latest/develop/reference/protocol-spec/
+
+	送出指令 => 一律是 bulk string 組成的 array: *2\r\n$9\r\nSUBSCRIBE\r\n$5\r\ntopic\r\n
+	讀取回覆 => +OK / -ERR / :1 / $5\r\nhello / *3\r\n...
+*/
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Redis 回覆的錯誤 (-ERR ...)
+type respError string
+
+func (e respError) Error() string { return "redis: " + string(e) }
+
+func dialRESP(addr, password string, timeout time.Duration) (*respConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &respConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if password != "" {
+		if err := rc.writeCommand("AUTH", password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if _, err := rc.readReply(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+func (rc *respConn) Close() error {
+	return rc.conn.Close()
+}
+
+func (rc *respConn) writeCommand(args ...string) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	_, err := rc.conn.Write(buf)
+	return err
+}
+
+// 讀取一個回覆，回傳型別:
+// string (simple / bulk string)、int64 (integer)、nil (null bulk)、[]any (array)
+// -ERR 回覆會以 respError 回傳
+func (rc *respConn) readReply() (any, error) {
+	line, err := rc.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: 空的回覆")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, respError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2) // 內容 + \r\n
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = rc.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: 無法解析的回覆 %q", line)
+	}
+}
+
+func (rc *respConn) readLine() (string, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: 格式錯誤的回覆 %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -1,17 +1,21 @@
 package main
 
 import (
+	"pizza-tracker-go/internal/models"
+
 	"github.com/gin-contrib/sessions"
-	gormsessions "github.com/gin-contrib/sessions/gorm"
 	"github.com/gin-gonic/gin"
 )
 
 /*
 第二個參數放的是 處理該路由的 handler function，發送請求時要執行的邏輯。
 r.GET("/ping", func(c *gin.Context) { c.JSON(200, gin.H{"message": "pong"}) })
+store 在正式環境是 createSessionStore 建立的 gormstore，測試時可以換成 memstore / cookie store
 */
-func setupRoutes(router *gin.Engine, h *Handler, store gormsessions.Store) {
-	router.Use(sessions.Sessions("pizza-tracker", store))
+func setupRoutes(router *gin.Engine, h *Handler, store sessions.Store) {
+	router.Use(sessions.Sessions(sessionCookieName, store))
+	// 所有 POST / PUT / PATCH / DELETE 都要帶 CSRF token，見 csrf.go
+	router.Use(h.CSRFMiddleware())
 
 	// ====== TMPL 版本 ======
 	router.GET("/", h.ServeNewOrderForm)
@@ -20,23 +24,77 @@ func setupRoutes(router *gin.Engine, h *Handler, store gormsessions.Store) {
 
 	// 客戶端訂閱特定訂單的通知，並在管理員更新訂單狀態時即時推送訊息。
 	router.GET("/notifications", h.notificationHandler)
+	// WebSocket 版本的即時通知，一條連線可以訂閱多個 topic，admin:* 需要登入
+	router.GET("/ws", h.handleWebSocket)
 
 	// ====== React 版本 ======
 
 	router.GET("/login", h.HandleLoginGet)
 	router.POST("/login", h.HandleLoginPost)
+	router.GET("/login/2fa", h.HandleTwoFactorLoginGet)
+	router.POST("/login/2fa", h.HandleTwoFactorLoginPost)
 	router.POST("/logout", h.HandleLogoutPost)
 
+	// 每個路由依功能檢查權限，角色與權限的對應見 models.RolePermissions
+	canView := RequirePermission(models.PermOrderView)
+	canUpdate := RequirePermission(models.PermOrderUpdate)
+	canDelete := RequirePermission(models.PermOrderDelete)
+	canEditCatalog := RequirePermission(models.PermCatalogEdit)
+	canManageUsers := RequirePermission(models.PermUserManage)
+	canViewAudit := RequirePermission(models.PermAuditView)
+
 	admin := router.Group("/admin")
 	admin.Use(h.AuthMiddleware())
 	{
-		admin.GET("", h.ServeAdminDashboard)
-		// admin 更新訂單狀態
-		admin.POST("/order/:id/update", h.handleOrderPut)
-		// admin 刪除訂單
-		admin.POST("/order/:id/delete", h.handleOrderDelete)
+		admin.GET("", canView, h.ServeAdminDashboard)
+		// admin 更新訂單狀態 (能改成哪些狀態再依角色判斷)
+		admin.POST("/order/:id/update", canUpdate, h.handleOrderPut)
+		// admin 刪除訂單 (移到垃圾桶)
+		admin.POST("/order/:id/delete", canDelete, h.handleOrderDelete)
+		// admin 垃圾桶: 還原 / 永久刪除
+		admin.GET("/trash", canDelete, h.ServeTrash)
+		admin.POST("/trash/:id/restore", canDelete, h.handleOrderRestore)
+		admin.POST("/trash/:id/purge", canDelete, h.handleOrderPurge)
+		// admin 查詢封存訂單
+		admin.GET("/archive", canView, h.ServeArchive)
+		// admin 即時更新表格用的單列 HTML 片段
+		admin.GET("/order/:id/row", canView, h.serveOrderRow)
 		// client 新增訂單, admin 接收訊息
-		admin.GET("/notifications", h.StreamNewOrderNotifications)
+		admin.GET("/notifications", canView, h.StreamNewOrderNotifications)
+		// admin 菜單管理，:kind => products / sizes
+		admin.GET("/catalog", canEditCatalog, h.ServeCatalog)
+		admin.POST("/catalog/prices", canEditCatalog, h.handlePricesUpdate)
+		admin.POST("/catalog/:kind", canEditCatalog, h.handleCatalogCreate)
+		admin.POST("/catalog/:kind/:id/update", canEditCatalog, h.handleCatalogUpdate)
+		admin.POST("/catalog/:kind/:id/delete", canEditCatalog, h.handleCatalogDelete)
+		// admin 帳號管理
+		admin.GET("/users", canManageUsers, h.ServeUsers)
+		admin.POST("/users", canManageUsers, h.handleUserCreate)
+		admin.POST("/users/:id/role", canManageUsers, h.handleUserRole)
+		admin.POST("/users/:id/disable", canManageUsers, h.handleUserDisable)
+		admin.POST("/users/:id/enable", canManageUsers, h.handleUserEnable)
+		admin.POST("/users/:id/password", canManageUsers, h.handleUserPasswordReset)
+		admin.POST("/users/:id/2fa/reset", canManageUsers, h.handleUserTwoFactorReset)
+		admin.POST("/two-factor-roles", canManageUsers, h.handleTwoFactorRoles)
+		// admin 登入紀錄與解除鎖定
+		admin.GET("/logins", canViewAudit, h.ServeLoginAudit)
+		admin.POST("/logins/unlock", canViewAudit, h.handleLoginUnlock)
+		// 每個登入者都可以修改自己的密碼
+		admin.GET("/account/password", h.ServeAccountPassword)
+		admin.POST("/account/password", h.handleAccountPassword)
+		admin.GET("/account/2fa", h.ServeTwoFactorSettings)
+		admin.POST("/account/2fa/setup", h.handleTwoFactorSetup)
+		admin.POST("/account/2fa/enable", h.handleTwoFactorEnable)
+		admin.POST("/account/2fa/disable", h.handleTwoFactorDisable)
+		admin.POST("/account/2fa/recovery-codes", h.handleRecoveryCodesRegenerate)
+		// API token，每個人管理自己的，有 user:manage 權限的人可以看到所有人的
+		admin.GET("/tokens", h.ServeAPITokens)
+		admin.POST("/tokens", h.handleAPITokenCreate)
+		admin.POST("/tokens/:id/revoke", h.handleAPITokenRevoke)
+		// 登入階段，每個人管理自己的，有 user:manage 權限的人可以登出任何人
+		admin.GET("/sessions", h.ServeSessions)
+		admin.POST("/sessions/revoke-all", h.handleSessionRevokeAll)
+		admin.POST("/sessions/:id/revoke", h.handleSessionRevoke)
 	}
 
 	// ====== TMPL 版本 ====== 把數據直接交付給 templtate
@@ -45,10 +103,44 @@ func setupRoutes(router *gin.Engine, h *Handler, store gormsessions.Store) {
 	// ====== React API 版本 ======
 	api := router.Group("/api")
 	{
+		// 前端送出修改類的請求前，取得 X-CSRF-Token header 要用的 token
+		api.GET("/csrf", h.getCSRFTokenJSON)
+		// 顧客端 (手機 App)
+		api.POST("/orders", h.createOrderJSON)
+		api.GET("/orders/:id", h.getOrderStatusJSON)
+
+		// cookie session 或 Authorization: Bearer <API token>，失敗時回傳 JSON 401 / 403
 		adminApi := api.Group("/admin")
-		adminApi.Use(h.AuthMiddleware())
+		adminApi.Use(h.APIAuthMiddleware())
+		sessionOnly := RequireSession()
 		{
-			adminApi.GET("/dashboard", h.GetAdminDashboardJSON)
+			adminApi.GET("/dashboard", canView, h.GetAdminDashboardJSON)
+			adminApi.GET("/orders", canView, h.listOrdersJSON)
+			adminApi.GET("/orders/:id", canView, h.getOrderJSON)
+			adminApi.PATCH("/orders/:id", canUpdate, h.patchOrderJSON)
+			adminApi.DELETE("/orders/:id", canDelete, h.deleteOrderJSON)
+			adminApi.GET("/trash", canDelete, h.listDeletedOrdersJSON)
+			adminApi.POST("/trash/:id/restore", canDelete, h.restoreOrderJSON)
+			adminApi.DELETE("/trash/:id", canDelete, h.purgeOrderJSON)
+			adminApi.GET("/archive", canView, h.listArchivedOrdersJSON)
+			adminApi.GET("/archive/:id", canView, h.getArchivedOrderJSON)
+			adminApi.GET("/notifications/stats", RequirePermission(models.PermSystemStatus), h.getNotificationStatsJSON)
+			adminApi.GET("/users", canManageUsers, h.listUsersJSON)
+			adminApi.POST("/users", canManageUsers, h.createUserJSON)
+			adminApi.PATCH("/users/:id", canManageUsers, h.patchUserJSON)
+			adminApi.POST("/users/:id/password", canManageUsers, h.resetUserPasswordJSON)
+			adminApi.POST("/users/:id/2fa/reset", canManageUsers, h.resetUserTwoFactorJSON)
+			adminApi.GET("/two-factor-roles", canManageUsers, h.getTwoFactorRolesJSON)
+			adminApi.PUT("/two-factor-roles", canManageUsers, h.putTwoFactorRolesJSON)
+			adminApi.POST("/account/password", sessionOnly, h.changePasswordJSON)
+			adminApi.GET("/logins", canViewAudit, h.listLoginAttemptsJSON)
+			adminApi.POST("/logins/unlock", canViewAudit, h.unlockLoginJSON)
+			adminApi.GET("/tokens", sessionOnly, h.listAPITokensJSON)
+			adminApi.POST("/tokens", sessionOnly, h.createAPITokenJSON)
+			adminApi.DELETE("/tokens/:id", sessionOnly, h.revokeAPITokenJSON)
+			adminApi.GET("/sessions", sessionOnly, h.listSessionsJSON)
+			adminApi.POST("/sessions/revoke-all", sessionOnly, h.revokeAllSessionsJSON)
+			adminApi.DELETE("/sessions/:id", sessionOnly, h.revokeSessionJSON)
 		}
 	}
 
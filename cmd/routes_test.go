@@ -0,0 +1,585 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"pizza-tracker-go/internal/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// 設定一組價格，回傳商品與尺寸的名稱
+func setTestPrice(t *testing.T, store *models.MemoryStore, price int64) (string, string) {
+	t.Helper()
+	products, _ := store.ActiveProducts()
+	sizes, _ := store.ActiveSizes()
+	if len(products) == 0 || len(sizes) == 0 {
+		t.Fatal("MemoryStore 沒有預設的菜單")
+	}
+	if err := store.SetPrice(products[0].ID, sizes[0].ID, &price); err != nil {
+		t.Fatal(err)
+	}
+	return products[0].Name, sizes[0].Name
+}
+
+// 建立帳號並登入，回傳已登入的瀏覽器
+func loginAs(t *testing.T, server *testServer, username string, role models.Role) *testClient {
+	t.Helper()
+	if _, err := server.store.CreateUser(username, "secret123", role); err != nil {
+		t.Fatal(err)
+	}
+	browser := server.newClient(t)
+	expectRedirect(t, browser.login(username, "secret123"), "/admin")
+	return browser
+}
+
+// 從帳號列表找出 loginAs 建立的帳號
+func findTestUser(t *testing.T, server *testServer, username string) *models.User {
+	t.Helper()
+	users, err := server.store.ListUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range users {
+		if users[i].Username == username {
+			return &users[i]
+		}
+	}
+	t.Fatalf("找不到帳號 %s", username)
+	return nil
+}
+
+// 直接寫入一筆已下單的訂單，不經過菜單計價
+func createTestOrder(t *testing.T, server *testServer, customer string) *models.Order {
+	t.Helper()
+	order := &models.Order{
+		Status:       models.StatusPlaced,
+		CustomerName: customer,
+		Phone:        "0911222333",
+		Address:      "台中市公益路 5 號",
+		Items:        []models.OrderItem{{Pizza: models.PizzaTypes[0], Size: models.PizzaSizes[0], Quantity: 1, UnitPrice: 30000, LineTotal: 30000}},
+		Subtotal:     30000,
+		Total:        30000,
+	}
+	if err := server.store.CreateOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func TestAdminOrderStatusRoute(t *testing.T) {
+	server := newTestServer(t)
+	order := createTestOrder(t, server, "Carol")
+	path := "/admin/order/" + order.ID + "/update"
+
+	// 外送員不能開始製作 => 409
+	rider := loginAs(t, server, "rider", models.RoleDriver)
+	expectStatus(t, rider.postForm(path, url.Values{"status": {models.StatusPreparing}}), http.StatusConflict)
+
+	cook := loginAs(t, server, "cook", models.RoleKitchen)
+	expectRedirect(t, cook.postForm(path, url.Values{"status": {models.StatusPreparing}}), "/admin")
+	expectStatus(t, cook.postForm(path, url.Values{"status": {models.StatusPlaced}}), http.StatusConflict)
+	expectStatus(t, cook.postForm(path, url.Values{"status": {"bogus"}}), http.StatusUnprocessableEntity)
+	expectStatus(t, cook.postForm("/admin/order/missing/update", url.Values{"status": {models.StatusReady}}), http.StatusNotFound)
+
+	got, err := server.store.GetOrder(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.StatusPreparing {
+		t.Fatalf("狀態 = %s，預期 %s", got.Status, models.StatusPreparing)
+	}
+}
+
+// 顧客頁面與 GET /api/orders/:id 的歷程不能出現後台人員與內部備註
+func TestPublicTimelineHidesStaffNotes(t *testing.T) {
+	server := newTestServer(t)
+	order := createTestOrder(t, server, "Dave")
+	cook := loginAs(t, server, "cook", models.RoleKitchen)
+	expectRedirect(t, cook.postForm("/admin/order/"+order.ID+"/update", url.Values{"status": {models.StatusPreparing}, "note": {"內部備註"}}), "/admin")
+
+	customer := server.newClient(t)
+	for _, path := range []string{"/customer/" + order.ID, "/api/orders/" + order.ID} {
+		resp := customer.get(path)
+		expectStatus(t, resp, http.StatusOK)
+		body := readBody(t, resp)
+		if strings.Contains(body, "內部備註") || strings.Contains(body, "userId") {
+			t.Fatalf("%s 洩漏了後台資訊", path)
+		}
+		if !strings.Contains(body, models.StatusPreparing) {
+			t.Fatalf("%s 沒有顯示目前的狀態", path)
+		}
+	}
+}
+
+func TestOrderAPIRoutes(t *testing.T) {
+	server := newTestServer(t)
+	client := server.newClient(t)
+	pizza, size := setTestPrice(t, server.store, 25000)
+	request := map[string]any{
+		"name": "Bob", "phone": "0987654321", "address": "高雄市中山路 100 號",
+		"pizzas": []string{pizza}, "sizes": []string{size}, "quantities": []int{1},
+	}
+
+	resp := client.postJSON("/api/orders", request)
+	expectStatus(t, resp, http.StatusCreated)
+	var created struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Status != models.StatusPlaced || resp.Header.Get("Location") != "/api/orders/"+created.ID {
+		t.Fatalf("建立訂單回應錯誤: %+v, Location=%s", created, resp.Header.Get("Location"))
+	}
+	expectStatus(t, client.get("/api/orders/"+created.ID), http.StatusOK)
+	expectStatus(t, client.get("/api/orders/not-found"), http.StatusNotFound)
+
+	// JSON 格式錯誤 => 400；欄位驗證失敗與明細數量不一致 => 422
+	expectStatus(t, client.do(http.MethodPost, "/api/orders", "{", "application/json"), http.StatusBadRequest)
+	resp = client.postJSON("/api/orders", map[string]any{"name": "B", "phone": "0987654321", "address": "高雄市中山路 100 號"})
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	if body := readBody(t, resp); !strings.Contains(body, `"field":"name"`) {
+		t.Fatalf("驗證錯誤沒有列出欄位: %s", body)
+	}
+	request["quantities"] = []int{1, 2}
+	expectStatus(t, client.postJSON("/api/orders", request), http.StatusUnprocessableEntity)
+}
+
+func TestCatalogRoutes(t *testing.T) {
+	server := newTestServer(t)
+	owner := loginAs(t, server, "owner", models.RoleOwner)
+	expectStatus(t, owner.get("/admin/catalog"), http.StatusOK)
+
+	// 新增商品，名稱重複 => 409；不存在的品項 => 404
+	entry := url.Values{"name": {"Hawaiian"}, "description": {"鳳梨"}, "sort_order": {"99"}, "active": {"true"}}
+	expectRedirect(t, owner.postForm("/admin/catalog/products", entry), "/admin/catalog")
+	expectStatus(t, owner.postForm("/admin/catalog/products", entry), http.StatusConflict)
+	expectStatus(t, owner.postForm("/admin/catalog/products/9999/update", entry), http.StatusNotFound)
+	expectStatus(t, owner.postForm("/admin/catalog/products/9999/delete", nil), http.StatusNotFound)
+	expectStatus(t, owner.postForm("/admin/catalog/drinks", entry), http.StatusNotFound)
+
+	products, _ := server.store.ListProducts()
+	hawaiian := products[len(products)-1]
+	if hawaiian.Name != "Hawaiian" || !hawaiian.Active {
+		t.Fatalf("最後一個商品 = %+v，預期上架中的 Hawaiian", hawaiian)
+	}
+	hawaiianPath := "/admin/catalog/products/" + strconv.FormatUint(uint64(hawaiian.ID), 10)
+
+	// 下架後驗證器不接受這個商品
+	expectRedirect(t, owner.postForm(hawaiianPath+"/update", url.Values{"name": {"Hawaiian"}, "sort_order": {"99"}}), "/admin/catalog")
+	sizes, _ := server.store.ActiveSizes()
+	order := map[string]any{
+		"name": "Eve", "phone": "0900000000", "address": "新竹市光復路 1 號",
+		"pizzas": []string{"Hawaiian"}, "sizes": []string{sizes[0].Name}, "quantities": []int{1},
+	}
+	resp := owner.postJSON("/api/orders", order)
+	expectStatus(t, resp, http.StatusUnprocessableEntity)
+	if body := readBody(t, resp); !strings.Contains(body, "valid_pizza_type") {
+		t.Fatalf("下架的商品應該被驗證器拒絕: %s", body)
+	}
+
+	expectRedirect(t, owner.postForm(hawaiianPath+"/delete", nil), "/admin/catalog")
+	if products, _ := server.store.ListProducts(); len(products) != len(models.PizzaTypes) {
+		t.Fatalf("刪除後剩下 %d 個商品", len(products))
+	}
+}
+
+func TestOrderFormRoute(t *testing.T) {
+	server := newTestServer(t)
+	browser := server.newClient(t)
+
+	// 還沒有任何價格 => 顯示尚未開放
+	resp := browser.get("/")
+	expectStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); !strings.Contains(body, "目前還沒有開放下單的品項") {
+		t.Fatal("沒有價格時表單應該顯示尚未開放")
+	}
+
+	pizza, size := setTestPrice(t, server.store, 30000)
+	resp = browser.get("/")
+	expectStatus(t, resp, http.StatusOK)
+	body := readBody(t, resp)
+	if strings.Contains(body, "目前還沒有開放下單的品項") || !strings.Contains(body, pizza) || !strings.Contains(body, size) {
+		t.Fatalf("設定價格後表單應該列出 %s / %s", pizza, size)
+	}
+
+	// 表單送出 => 依菜單價格計算金額，導向顧客頁面
+	resp = browser.postForm("/new-order", url.Values{
+		"name": {"Alice"}, "phone": {"0912345678"}, "address": {"台北市信義路 1 號"},
+		"pizza": {pizza}, "size": {size}, "quantity": {"2"},
+	})
+	expectStatus(t, resp, http.StatusSeeOther)
+	location := resp.Header.Get("Location")
+	if !strings.HasPrefix(location, "/customer/") {
+		t.Fatalf("下單後導向 %s，預期 /customer/:id", location)
+	}
+	expectStatus(t, browser.get(location), http.StatusOK)
+	order, err := server.store.GetOrder(strings.TrimPrefix(location, "/customer/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Items[0].UnitPrice != 30000 || order.Subtotal != 60000 {
+		t.Fatalf("單價 %d / 小計 %d，預期 30000 / 60000", order.Items[0].UnitPrice, order.Subtotal)
+	}
+
+	// 沒有價格的組合 => 400
+	sizes, _ := server.store.ActiveSizes()
+	expectStatus(t, browser.postForm("/new-order", url.Values{
+		"name": {"Alice"}, "phone": {"0912345678"}, "address": {"台北市信義路 1 號"},
+		"pizza": {pizza}, "size": {sizes[len(sizes)-1].Name}, "quantity": {"1"},
+	}), http.StatusBadRequest)
+}
+
+func TestCatalogPriceGridRoute(t *testing.T) {
+	server := newTestServer(t)
+	owner := loginAs(t, server, "owner", models.RoleOwner)
+	products, _ := server.store.ListProducts()
+	sizes, _ := server.store.ListSizes()
+	cell := func(product models.Product, size models.ProductSize) string {
+		return "price[" + strconv.FormatUint(uint64(product.ID), 10) + ":" + strconv.FormatUint(uint64(size.ID), 10) + "]"
+	}
+	first, second := cell(products[0], sizes[0]), cell(products[1], sizes[0])
+
+	// 一格正確、一格錯誤 => 400，正確的那一格也不能存進去
+	for _, bad := range []string{"abc", "1.234"} {
+		expectStatus(t, owner.postForm("/admin/catalog/prices", url.Values{first: {"320.50"}, second: {bad}}), http.StatusBadRequest)
+		if prices, _ := server.store.ListPrices(); len(prices) != 0 {
+			t.Fatalf("價格 %q 錯誤時仍寫入了 %+v", bad, prices)
+		}
+	}
+	expectStatus(t, owner.postForm("/admin/catalog/prices", url.Values{"price[x:1]": {"100"}, first: {"320.50"}}), http.StatusBadRequest)
+
+	expectRedirect(t, owner.postForm("/admin/catalog/prices", url.Values{first: {"320.50"}, second: {"1,200"}}), "/admin/catalog")
+	prices, _ := server.store.ActivePrices()
+	if got := prices[models.PriceKey{Product: products[0].Name, Size: sizes[0].Name}]; got != 32050 {
+		t.Fatalf("價格 = %d，預期 32050", got)
+	}
+	if got := prices[models.PriceKey{Product: products[1].Name, Size: sizes[0].Name}]; got != 120000 {
+		t.Fatalf("價格 = %d，預期 120000", got)
+	}
+
+	// 留空代表取消此組合
+	expectRedirect(t, owner.postForm("/admin/catalog/prices", url.Values{first: {""}}), "/admin/catalog")
+	if prices, _ := server.store.ListPrices(); len(prices) != 1 {
+		t.Fatalf("取消後剩下 %+v", prices)
+	}
+}
+
+// 寫入價格一律失敗的菜單，其他方法沿用 MemoryStore
+type failingPriceCatalog struct {
+	*models.MemoryStore
+}
+
+func (failingPriceCatalog) SetPrices([]models.PriceUpdate) error {
+	return errors.New("database is locked")
+}
+
+func TestCatalogPriceGridStorageError(t *testing.T) {
+	server := newTestServerWithCatalog(t, func(store *models.MemoryStore) models.CatalogStore {
+		return failingPriceCatalog{store}
+	})
+	owner := loginAs(t, server, "owner", models.RoleOwner)
+	resp := owner.postForm("/admin/catalog/prices", url.Values{"price[1:1]": {"100"}})
+	expectStatus(t, resp, http.StatusInternalServerError)
+	if body := readBody(t, resp); strings.Contains(body, "database is locked") {
+		t.Fatal("不應該把資料庫錯誤顯示給使用者")
+	}
+}
+
+// 帶 Idempotency-Key header 呼叫 POST /api/orders (沒有 session cookie，不需要 CSRF token)
+func postOrderWithKey(t *testing.T, client *testClient, key string, request map[string]any) *http.Response {
+	t.Helper()
+	b, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, client.server.URL+"/api/orders", strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyHeader, key)
+	resp, err := client.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func countTestOrders(t *testing.T, server *testServer) int {
+	t.Helper()
+	page, err := server.store.ListOrders(models.OrderQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(page.Orders)
+}
+
+func TestOrderAPIIdempotency(t *testing.T) {
+	server := newTestServer(t)
+	client := server.newClient(t)
+	pizza, size := setTestPrice(t, server.store, 25000)
+	request := map[string]any{
+		"name": "Bob", "phone": "0987654321", "address": "高雄市中山路 100 號",
+		"pizzas": []string{pizza}, "sizes": []string{size}, "quantities": []int{1},
+	}
+
+	first := postOrderWithKey(t, client, "retry-1", request)
+	expectStatus(t, first, http.StatusCreated)
+	location := first.Header.Get("Location")
+	if first.Header.Get("Idempotent-Replayed") != "" {
+		t.Fatal("第一次建立不應該有 Idempotent-Replayed")
+	}
+
+	// 重送 => 同樣的 201 與 Location，不會建立第二筆
+	replay := postOrderWithKey(t, client, "retry-1", request)
+	expectStatus(t, replay, http.StatusCreated)
+	if replay.Header.Get("Idempotent-Replayed") != "true" || replay.Header.Get("Location") != location {
+		t.Fatalf("重送的回應: Idempotent-Replayed=%q, Location=%s，預期 %s",
+			replay.Header.Get("Idempotent-Replayed"), replay.Header.Get("Location"), location)
+	}
+	if n := countTestOrders(t, server); n != 1 {
+		t.Fatalf("重送後有 %d 筆訂單", n)
+	}
+
+	// 同一個 key 換了內容、key 太長 => 422
+	request["quantities"] = []int{3}
+	expectStatus(t, postOrderWithKey(t, client, "retry-1", request), http.StatusUnprocessableEntity)
+	expectStatus(t, postOrderWithKey(t, client, strings.Repeat("k", idempotencyKeyMaxLen+1), request), http.StatusUnprocessableEntity)
+
+	// 原本的訂單已經刪除 => 409，不會重新建立
+	request["quantities"] = []int{1}
+	if err := server.store.DeleteOrder(strings.TrimPrefix(location, "/api/orders/"), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, postOrderWithKey(t, client, "retry-1", request), http.StatusConflict)
+	if n := countTestOrders(t, server); n != 0 {
+		t.Fatalf("訂單刪除後重送不應該建立訂單，目前有 %d 筆", n)
+	}
+}
+
+var idempotencyFieldPattern = regexp.MustCompile(`name="idempotency_key" value="([^"]+)"`)
+
+// 表單每次顯示都有新的一次性 key，連點送出只建立一筆訂單
+func TestOrderFormIdempotency(t *testing.T) {
+	server := newTestServer(t)
+	browser := server.newClient(t)
+	pizza, size := setTestPrice(t, server.store, 30000)
+
+	formKey := func() string {
+		t.Helper()
+		match := idempotencyFieldPattern.FindStringSubmatch(readBody(t, browser.get("/")))
+		if match == nil {
+			t.Fatal("表單沒有 idempotency_key 欄位")
+		}
+		return match[1]
+	}
+	key := formKey()
+	if other := formKey(); other == key {
+		t.Fatal("每次顯示表單應該產生新的 key")
+	}
+
+	form := url.Values{
+		"name": {"Alice"}, "phone": {"0912345678"}, "address": {"台北市信義路 1 號"},
+		"pizza": {pizza}, "size": {size}, "quantity": {"2"}, idempotencyFormField: {key},
+	}
+	first := browser.postForm("/new-order", form)
+	expectStatus(t, first, http.StatusSeeOther)
+	second := browser.postForm("/new-order", form)
+	expectRedirect(t, second, first.Header.Get("Location"))
+	if n := countTestOrders(t, server); n != 1 {
+		t.Fatalf("連點送出後有 %d 筆訂單", n)
+	}
+
+	// 同一張表單改了內容再送出 => 422
+	form.Set("quantity", "3")
+	expectStatus(t, browser.postForm("/new-order", form), http.StatusUnprocessableEntity)
+}
+
+func TestAdminUserRoutes(t *testing.T) {
+	server := newTestServer(t)
+	owner := loginAs(t, server, "owner", models.RoleOwner)
+	expectStatus(t, owner.get("/admin/users"), http.StatusOK)
+
+	form := url.Values{"username": {"cook"}, "password": {"secret123"}, "role": {string(models.RoleKitchen)}}
+	expectRedirect(t, owner.postForm("/admin/users", form), "/admin/users")
+	expectStatus(t, owner.postForm("/admin/users", form), http.StatusConflict)
+	form.Set("username", "chef")
+	form.Set("role", "chef")
+	expectStatus(t, owner.postForm("/admin/users", form), http.StatusUnprocessableEntity)
+
+	cookID := strconv.FormatUint(uint64(findTestUser(t, server, "cook").ID), 10)
+	expectRedirect(t, owner.postForm("/admin/users/"+cookID+"/disable", nil), "/admin/users")
+	if got, _ := server.store.GetUserByID(cookID); !got.Disabled {
+		t.Fatal("停用後帳號應該是停用狀態")
+	}
+	expectRedirect(t, owner.postForm("/admin/users/"+cookID+"/enable", nil), "/admin/users")
+
+	// 沒有 user:manage 權限 => 403
+	kitchen := server.newClient(t)
+	expectRedirect(t, kitchen.login("cook", "secret123"), "/admin")
+	expectStatus(t, kitchen.get("/admin/users"), http.StatusForbidden)
+	expectStatus(t, kitchen.postForm("/admin/users", form), http.StatusForbidden)
+}
+
+func TestAdminTokenRoutesAndBearerAuth(t *testing.T) {
+	server := newTestServer(t)
+	createTestOrder(t, server, "Hank")
+	cook := loginAs(t, server, "cook", models.RoleKitchen)
+	expectStatus(t, cook.get("/admin/tokens"), http.StatusOK)
+
+	// 明文只出現在建立後的頁面
+	resp := cook.postForm("/admin/tokens", url.Values{"name": {"pos"}, "scopes": {string(models.PermOrderView)}, "days": {"30"}})
+	expectStatus(t, resp, http.StatusCreated)
+	plain := regexp.MustCompile(`pzt_[A-Za-z0-9_-]+`).FindString(readBody(t, resp))
+	if plain == "" {
+		t.Fatal("建立後的頁面沒有顯示 token")
+	}
+	// 角色沒有的權限不能勾選 => 422
+	expectStatus(t, cook.postForm("/admin/tokens", url.Values{"name": {"pos"}, "scopes": {string(models.PermUserManage)}, "days": {"30"}}), http.StatusUnprocessableEntity)
+
+	bearer := func(method, path string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+plain)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// /api/admin/orders: session 與 Bearer 都可以，沒有登入 => 401
+	expectStatus(t, cook.get("/api/admin/orders"), http.StatusOK)
+	if status := bearer(http.MethodGet, "/api/admin/orders"); status != http.StatusOK {
+		t.Fatalf("Bearer 查詢訂單: %d", status)
+	}
+	expectStatus(t, server.newClient(t).get("/api/admin/orders"), http.StatusUnauthorized)
+	// token 沒有勾選的權限、只限 session 的路由 => 403
+	if status := bearer(http.MethodPatch, "/api/admin/orders/missing"); status != http.StatusForbidden {
+		t.Fatalf("Bearer 沒有 order:update 權限: %d", status)
+	}
+	if status := bearer(http.MethodGet, "/api/admin/tokens"); status != http.StatusForbidden {
+		t.Fatalf("Bearer 管理 token: %d", status)
+	}
+
+	// 撤銷後立即失效
+	tokens, err := server.store.ListAPITokens(0)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("token 列表 = %+v, %v", tokens, err)
+	}
+	expectRedirect(t, cook.postForm("/admin/tokens/"+strconv.FormatUint(uint64(tokens[0].ID), 10)+"/revoke", nil), "/admin/tokens")
+	if status := bearer(http.MethodGet, "/api/admin/orders"); status != http.StatusUnauthorized {
+		t.Fatalf("撤銷後的 token: %d", status)
+	}
+}
+
+func TestAdminSessionRoutes(t *testing.T) {
+	server := newTestServer(t)
+	laptop := loginAs(t, server, "cook", models.RoleKitchen)
+	phone := server.newClient(t)
+	expectRedirect(t, phone.login("cook", "secret123"), "/admin")
+
+	resp := laptop.get("/admin/sessions")
+	expectStatus(t, resp, http.StatusOK)
+	if sessions, _ := server.store.ListSessions(0); len(sessions) != 2 {
+		t.Fatalf("登入階段 = %d 筆，預期 2 筆", len(sessions))
+	}
+
+	// 登出其他裝置: 目前的裝置不受影響，其他裝置被導回登入頁
+	expectStatus(t, laptop.postForm("/admin/sessions/revoke-all", nil), http.StatusOK)
+	expectStatus(t, laptop.get("/admin"), http.StatusOK)
+	expectRedirect(t, phone.get("/admin"), "/login")
+
+	// 沒有 user:manage 權限不能登出別人
+	owner := loginAs(t, server, "owner", models.RoleOwner)
+	ownerID := strconv.FormatUint(uint64(findTestUser(t, server, "owner").ID), 10)
+	expectStatus(t, laptop.postForm("/admin/sessions/revoke-all", url.Values{"user_id": {ownerID}}), http.StatusForbidden)
+	expectStatus(t, owner.get("/admin"), http.StatusOK)
+}
+
+// 刪除、垃圾桶與封存: 角色沒有 order:delete 權限 => 403
+func TestAdminTrashAndArchiveRoutes(t *testing.T) {
+	server := newTestServer(t)
+	order := createTestOrder(t, server, "Ivy")
+	cook := loginAs(t, server, "cook", models.RoleKitchen)
+	manager := loginAs(t, server, "boss", models.RoleManager)
+
+	expectStatus(t, cook.postForm("/admin/order/"+order.ID+"/delete", nil), http.StatusForbidden)
+	expectStatus(t, cook.get("/admin/trash"), http.StatusForbidden)
+	expectStatus(t, cook.do(http.MethodDelete, "/api/admin/orders/"+order.ID, "", ""), http.StatusForbidden)
+	if _, err := server.store.FindOrder(order.ID); err != nil {
+		t.Fatalf("沒有權限時訂單不應該被刪除: %v", err)
+	}
+
+	expectRedirect(t, manager.postForm("/admin/order/"+order.ID+"/delete", url.Values{"reason": {"重複下單"}}), "/admin")
+	resp := manager.get("/admin/trash")
+	expectStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); !strings.Contains(body, "Ivy") || !strings.Contains(body, "重複下單") {
+		t.Fatal("垃圾桶應該列出刪除的訂單與原因")
+	}
+	expectStatus(t, manager.postForm("/admin/trash/"+order.ID+"/restore", nil), http.StatusOK)
+	expectStatus(t, manager.postForm("/admin/trash/"+order.ID+"/restore", nil), http.StatusConflict)
+
+	// 封存: 結案超過保留時間的訂單移到封存區，有 order:view 權限就能查詢
+	if _, err := server.store.UpdateOrderStatus(order.ID, models.StatusChange{To: models.StatusFailed, Actor: models.ActorSystem}); err != nil {
+		t.Fatal(err)
+	}
+	server.store.Clock = func() time.Time { return time.Now().Add(48 * time.Hour) }
+	if n, err := server.store.ArchiveOrders(24 * time.Hour); err != nil || n != 1 {
+		t.Fatalf("封存 %d 筆, %v", n, err)
+	}
+	resp = cook.get("/admin/archive?q=Ivy")
+	expectStatus(t, resp, http.StatusOK)
+	if body := readBody(t, resp); !strings.Contains(body, "Ivy") {
+		t.Fatal("封存查詢應該列出封存的訂單")
+	}
+	expectStatus(t, cook.get("/admin/archive?from=yesterday"), http.StatusBadRequest)
+}
+
+func TestAccountTwoFactorRoutes(t *testing.T) {
+	server := newTestServer(t)
+	cook := loginAs(t, server, "cook", models.RoleKitchen)
+	expectStatus(t, cook.get("/admin/account/2fa"), http.StatusOK)
+
+	expectRedirect(t, cook.postForm("/admin/account/2fa/setup", nil), "/admin/account/2fa")
+	user := findTestUser(t, server, "cook")
+	if user.TOTPSecret == "" {
+		t.Fatal("setup 後應該產生金鑰")
+	}
+	code, _ := models.TOTPCode(user.TOTPSecret, time.Now())
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	expectStatus(t, cook.postForm("/admin/account/2fa/enable", url.Values{"code": {wrong}}), http.StatusBadRequest)
+	expectStatus(t, cook.postForm("/admin/account/2fa/enable", url.Values{"code": {code}}), http.StatusOK)
+
+	expectStatus(t, cook.postForm("/admin/account/2fa/disable", url.Values{"password": {"wrong-password"}}), http.StatusBadRequest)
+	expectStatus(t, cook.postForm("/admin/account/2fa/disable", url.Values{"password": {"secret123"}}), http.StatusOK)
+	if findTestUser(t, server, "cook").TOTPEnabled {
+		t.Fatal("關閉後不應該再要求兩步驟驗證")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"pizza-tracker-go/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions/memstore"
+	"github.com/gin-gonic/gin"
+)
+
+// 路由測試用的 server: 訂單、帳號與菜單放在 MemoryStore，session 用 memstore，不需要資料庫
+type testServer struct {
+	*httptest.Server
+	store  *models.MemoryStore
+	broker Broker
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWithCatalog(t, nil)
+}
+
+// catalog 為 nil 時使用 store 本身的菜單，測試可以傳入包裝過的 CatalogStore 模擬寫入失敗
+func newTestServerWithCatalog(t *testing.T, catalog func(store *models.MemoryStore) models.CatalogStore) *testServer {
+	t.Helper()
+	t.Chdir("..") // 模板在專案根目錄的 templates/
+	gin.SetMode(gin.TestMode)
+
+	store := models.NewMemoryStore()
+	var catalogStore models.CatalogStore = store
+	if catalog != nil {
+		catalogStore = catalog(store)
+	}
+	RegisterCustomValidators(catalogStore)
+	templates, err := loadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := loadConfig()
+	cfg.NotifyBackend = BrokerMemory
+	h, err := NewHandler(store, store, catalogStore, cfg, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	setupRoutes(router, h, memstore.NewStore([]byte("test-secret")))
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return &testServer{Server: server, store: store, broker: h.notificationManager}
+}
+
+// 各自保存 cookie 的瀏覽器，不會自動跟隨重導向，測試可以檢查 Location
+type testClient struct {
+	t      *testing.T
+	server *testServer
+	http   *http.Client
+}
+
+func (s *testServer) newClient(t *testing.T) *testClient {
+	jar, _ := cookiejar.New(nil)
+	return &testClient{t: t, server: s, http: &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+func (c *testClient) do(method, path string, body string, contentType string) *http.Response {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if method != http.MethodGet {
+		req.Header.Set(csrfHeader, c.csrfToken())
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (c *testClient) get(path string) *http.Response {
+	c.t.Helper()
+	return c.do(http.MethodGet, path, "", "")
+}
+
+func (c *testClient) postForm(path string, form url.Values) *http.Response {
+	c.t.Helper()
+	return c.do(http.MethodPost, path, form.Encode(), "application/x-www-form-urlencoded")
+}
+
+func (c *testClient) postJSON(path string, body any) *http.Response {
+	c.t.Helper()
+	b, err := json.Marshal(body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return c.do(http.MethodPost, path, string(b), "application/json")
+}
+
+// 從 /api/csrf 取得這個瀏覽器 (cookie jar) 的 token
+func (c *testClient) csrfToken() string {
+	c.t.Helper()
+	resp, err := c.http.Get(c.server.URL + "/api/csrf")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		c.t.Fatal(err)
+	}
+	return body.Token
+}
+
+func (c *testClient) login(account, password string) *http.Response {
+	c.t.Helper()
+	return c.postForm("/login", url.Values{"account": {account}, "password": {password}})
+}
+
+func expectRedirect(t *testing.T, resp *http.Response, location string) {
+	t.Helper()
+	if resp.StatusCode != http.StatusSeeOther && resp.StatusCode != http.StatusFound {
+		t.Fatalf("%s %s => %d，預期重導向到 %s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, location)
+	}
+	if got := resp.Header.Get("Location"); got != location {
+		t.Fatalf("%s %s 重導向到 %s，預期 %s", resp.Request.Method, resp.Request.URL.Path, got, location)
+	}
+}
+
+func expectStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s => %d，預期 %d", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"pizza-tracker-go/internal/models"
+	"strconv"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// 登入階段管理 /admin/sessions: 每個人可以看到並登出自己其他裝置的 session
+// 有 user:manage 權限 (店主) 的人可以看到所有人的 session，並把任何人強制登出
+
+type SessionsData struct {
+	Sessions         []models.UserSession
+	CurrentSessionID uint // 目前這個瀏覽器的 session，列表上標示「目前裝置」
+	ManageAll        bool
+	Username         string
+	Error            string
+	Notice           string
+}
+
+// 目前請求的 session ID (gormstore sessions.id)，還沒存過的新 session 為空字串
+func currentSessionID(c *gin.Context) string {
+	return sessions.Default(c).ID()
+}
+
+// 登入成功 (密碼或兩步驟驗證通過) 後寫入 session，並記錄這個 session 屬於誰
+func (h *Handler) startSession(c *gin.Context, user *models.User) error {
+	// 需要改成字串，因為等下操作 DB 的 GetUserByID 是拿 string去搜尋
+	if err := SetSession(c, "userID", fmt.Sprintf("%v", user.ID)); err != nil {
+		return err
+	}
+	if err := SetSession(c, "username", user.Username); err != nil {
+		return err
+	}
+	return h.users.RecordSession(currentSessionID(c), user.ID, c.ClientIP(), c.Request.UserAgent())
+}
+
+func (h *Handler) ServeSessions(c *gin.Context) {
+	h.renderSessions(c, http.StatusOK, "", "")
+}
+
+func (h *Handler) renderSessions(c *gin.Context, status int, errMsg, notice string) {
+	user := currentUser(c)
+	list, err := h.users.ListSessions(sessionOwnerFilter(user))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取登入階段失敗")
+		return
+	}
+	var currentID uint
+	sid := currentSessionID(c)
+	for _, s := range list {
+		if s.SessionID == sid {
+			currentID = s.ID
+		}
+	}
+	h.renderHTML(c, status, "sessions.tmpl", SessionsData{
+		Sessions:         list,
+		CurrentSessionID: currentID,
+		ManageAll:        user.Role.Can(models.PermUserManage),
+		Username:         user.Username,
+		Error:            errMsg,
+		Notice:           notice,
+	})
+}
+
+// 有 user:manage 權限時可以看到 / 登出所有人的 session (回傳 0)，否則只有自己的
+func sessionOwnerFilter(user *models.User) uint {
+	if user.Role.Can(models.PermUserManage) {
+		return 0
+	}
+	return user.ID
+}
+
+func (h *Handler) handleSessionRevoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "無效的登入階段ID")
+		return
+	}
+	if err := h.users.RevokeSession(uint(id), sessionOwnerFilter(currentUser(c))); err != nil {
+		h.renderSessions(c, sessionErrorCode(err), err.Error(), "")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/sessions")
+}
+
+// POST /admin/sessions/revoke-all
+// 沒有帶 user_id (或是自己的 ID) => 登出自己除了目前裝置以外的所有 session
+// 帶別人的 user_id => 需要 user:manage 權限，登出該帳號所有的 session
+func (h *Handler) handleSessionRevokeAll(c *gin.Context) {
+	count, err := h.revokeAllSessions(c, c.PostForm("user_id"))
+	if err != nil {
+		h.renderSessions(c, sessionErrorCode(err), err.Error(), "")
+		return
+	}
+	h.renderSessions(c, http.StatusOK, "", fmt.Sprintf("已登出 %d 個登入階段", count))
+}
+
+var errSessionForbidden = errors.New("沒有權限登出其他帳號的登入階段")
+
+func (h *Handler) revokeAllSessions(c *gin.Context, userIDParam string) (int, error) {
+	user := currentUser(c)
+	if userIDParam == "" || userIDParam == strconv.FormatUint(uint64(user.ID), 10) {
+		return h.users.RevokeUserSessions(user.ID, currentSessionID(c))
+	}
+	if !user.Role.Can(models.PermUserManage) {
+		return 0, errSessionForbidden
+	}
+	id, err := strconv.ParseUint(userIDParam, 10, 64)
+	if err != nil {
+		return 0, models.ErrUserNotFound
+	}
+	return h.users.RevokeUserSessions(uint(id), "")
+}
+
+// GET /api/admin/sessions
+func (h *Handler) listSessionsJSON(c *gin.Context) {
+	list, err := h.users.ListSessions(sessionOwnerFilter(currentUser(c)))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "讀取登入階段失敗")
+		return
+	}
+	sid := currentSessionID(c)
+	type sessionJSON struct {
+		models.UserSession
+		Username string `json:"username"`
+		Current  bool   `json:"current"`
+	}
+	out := make([]sessionJSON, len(list))
+	for i, s := range list {
+		out[i] = sessionJSON{UserSession: s, Username: s.User.Username, Current: s.SessionID == sid}
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": out})
+}
+
+// DELETE /api/admin/sessions/:id
+func (h *Handler) revokeSessionJSON(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "無效的登入階段ID")
+		return
+	}
+	if err := h.users.RevokeSession(uint(id), sessionOwnerFilter(currentUser(c))); err != nil {
+		respondError(c, sessionErrorCode(err), err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /api/admin/sessions/revoke-all，body: {"userId": 3} (可省略，規則同 /admin/sessions/revoke-all)
+func (h *Handler) revokeAllSessionsJSON(c *gin.Context) {
+	var body struct {
+		UserID uint `json:"userId"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+	var param string
+	if body.UserID != 0 {
+		param = strconv.FormatUint(uint64(body.UserID), 10)
+	}
+	count, err := h.revokeAllSessions(c, param)
+	if err != nil {
+		respondError(c, sessionErrorCode(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": count})
+}
+
+func sessionErrorCode(err error) int {
+	switch {
+	case errors.Is(err, models.ErrSessionNotFound), errors.Is(err, models.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errSessionForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"pizza-tracker-go/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API token 管理 /admin/tokens，每個登入者都可以替自己發行 token
+// 有 user:manage 權限 (店主) 的人可以看到並撤銷所有人的 token
+
+type TokensData struct {
+	Tokens      []apiTokenView
+	Permissions []models.Permission // 目前角色可以授權給 token 的權限
+	ManageAll   bool
+	NewToken    string // 剛建立的 token 明文，只顯示這一次
+	MaxDays     int
+	Username    string
+	Error       string
+	Notice      string
+}
+
+// 列表與 JSON 使用，把逗號分隔的 scopes 展開，並附上擁有者名稱
+type apiTokenView struct {
+	models.APIToken
+	Scopes   []models.Permission `json:"scopes"`
+	Username string              `json:"username"`
+	Active   bool                `json:"active"`
+}
+
+type apiTokenForm struct {
+	Name   string              `form:"name" json:"name" binding:"required,max=100"`
+	Scopes []models.Permission `form:"scopes" json:"scopes" binding:"required,min=1"`
+	Days   int                 `form:"days" json:"days" binding:"required,min=1,max=365"`
+}
+
+func (h *Handler) ServeAPITokens(c *gin.Context) {
+	h.renderAPITokens(c, http.StatusOK, "", "", "")
+}
+
+func (h *Handler) renderAPITokens(c *gin.Context, status int, errMsg, notice, newToken string) {
+	user := currentUser(c)
+	tokens, err := h.listAPITokenViews(c)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取 API token 失敗")
+		return
+	}
+	h.renderHTML(c, status, "tokens.tmpl", TokensData{
+		Tokens:      tokens,
+		Permissions: user.Role.Permissions(),
+		ManageAll:   user.Role.Can(models.PermUserManage),
+		NewToken:    newToken,
+		MaxDays:     models.APITokenMaxDays,
+		Username:    user.Username,
+		Error:       errMsg,
+		Notice:      notice,
+	})
+}
+
+// 有 user:manage 權限時列出所有人的 token，否則只列出自己的
+func (h *Handler) listAPITokenViews(c *gin.Context) ([]apiTokenView, error) {
+	user := currentUser(c)
+	var ownerID uint
+	if !user.Role.Can(models.PermUserManage) {
+		ownerID = user.ID
+	}
+	tokens, err := h.users.ListAPITokens(ownerID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	views := make([]apiTokenView, len(tokens))
+	for i, t := range tokens {
+		views[i] = apiTokenView{APIToken: t, Scopes: t.ScopeList(), Username: t.User.Username, Active: t.Active(now)}
+	}
+	return views, nil
+}
+
+func (h *Handler) handleAPITokenCreate(c *gin.Context) {
+	var form apiTokenForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderAPITokens(c, http.StatusBadRequest, "Invalid input: "+err.Error(), "", "")
+		return
+	}
+	plain, _, err := h.users.CreateAPIToken(currentUser(c).ID, form.Name, form.Scopes, form.Days)
+	if err != nil {
+		h.renderAPITokens(c, apiTokenErrorCode(err), err.Error(), "", "")
+		return
+	}
+	// 不重導向，token 明文只出現在這次的回應裡
+	h.renderAPITokens(c, http.StatusCreated, "", "已建立 API token，請立即複製保存，離開此頁後就不會再顯示", plain)
+}
+
+func (h *Handler) handleAPITokenRevoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "無效的 token ID")
+		return
+	}
+	if err := h.revokeAPIToken(c, uint(id)); err != nil {
+		h.renderAPITokens(c, apiTokenErrorCode(err), err.Error(), "", "")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/tokens")
+}
+
+// 沒有 user:manage 權限時只能撤銷自己的 token，別人的 token 當作不存在
+func (h *Handler) revokeAPIToken(c *gin.Context, id uint) error {
+	user := currentUser(c)
+	var ownerID uint
+	if !user.Role.Can(models.PermUserManage) {
+		ownerID = user.ID
+	}
+	return h.users.RevokeAPIToken(id, ownerID)
+}
+
+// GET /api/admin/tokens
+func (h *Handler) listAPITokensJSON(c *gin.Context) {
+	tokens, err := h.listAPITokenViews(c)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "讀取 API token 失敗")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// POST /api/admin/tokens => 回應的 token 欄位是明文，只會出現這一次
+func (h *Handler) createAPITokenJSON(c *gin.Context) {
+	var body apiTokenForm
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	user := currentUser(c)
+	plain, token, err := h.users.CreateAPIToken(user.ID, body.Name, body.Scopes, body.Days)
+	if err != nil {
+		respondError(c, apiTokenErrorCode(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"token":    plain,
+		"apiToken": apiTokenView{APIToken: *token, Scopes: token.ScopeList(), Username: user.Username, Active: true},
+	})
+}
+
+// DELETE /api/admin/tokens/:id
+func (h *Handler) revokeAPITokenJSON(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "無效的 token ID")
+		return
+	}
+	if err := h.revokeAPIToken(c, uint(id)); err != nil {
+		respondError(c, apiTokenErrorCode(err), err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func apiTokenErrorCode(err error) int {
+	switch {
+	case errors.Is(err, models.ErrAPITokenNotFound), errors.Is(err, models.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrAPITokenRevoked), errors.Is(err, models.ErrUserDisabled):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrAPITokenNoScope), errors.Is(err, models.ErrAPITokenExpiry), errors.Is(err, models.ErrAPITokenScope):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
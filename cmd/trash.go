@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"pizza-tracker-go/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 訂單垃圾桶 /admin/trash: 刪除的訂單在保留期間內可以還原，也可以立即永久刪除
+// 需要 order:delete 權限，超過保留期間的訂單由背景工作永久刪除 (jobs.go)
+
+type TrashData struct {
+	Orders        []models.DeletedOrder
+	RetentionDays int
+	Username      string
+	Error         string
+	Notice        string
+}
+
+type orderDeleteForm struct {
+	Reason string `form:"reason" json:"reason" binding:"max=200"`
+}
+
+// 軟刪除訂單，記錄刪除者與原因
+func (h *Handler) deleteOrder(c *gin.Context, orderID, reason string) error {
+	var userID *uint
+	if user := currentUser(c); user != nil {
+		userID = &user.ID
+	}
+	return h.orders.DeleteOrder(orderID, userID, reason)
+}
+
+func (h *Handler) ServeTrash(c *gin.Context) {
+	h.renderTrash(c, http.StatusOK, "", "")
+}
+
+func (h *Handler) renderTrash(c *gin.Context, status int, errMsg, notice string) {
+	orders, err := h.orders.ListDeletedOrders(h.trashRetention)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取垃圾桶失敗")
+		return
+	}
+	h.renderHTML(c, status, "trash.tmpl", TrashData{
+		Orders:        orders,
+		RetentionDays: int(h.trashRetention.Hours() / 24),
+		Username:      currentUser(c).Username,
+		Error:         errMsg,
+		Notice:        notice,
+	})
+}
+
+// POST /admin/trash/:id/restore
+func (h *Handler) handleOrderRestore(c *gin.Context) {
+	orderID := c.Param("id")
+	order, err := h.orders.RestoreOrder(orderID, h.trashRetention)
+	if err != nil {
+		h.renderTrash(c, orderErrorCode(err), err.Error(), "")
+		return
+	}
+	h.publishOrderEvent(c, orderRestoredEvent(order))
+	h.renderTrash(c, http.StatusOK, "", fmt.Sprintf("已還原訂單 %s", orderID))
+}
+
+// POST /admin/trash/:id/purge
+func (h *Handler) handleOrderPurge(c *gin.Context) {
+	orderID := c.Param("id")
+	if err := h.orders.PurgeOrder(orderID); err != nil {
+		h.renderTrash(c, orderErrorCode(err), err.Error(), "")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/trash")
+}
+
+// GET /api/admin/trash
+func (h *Handler) listDeletedOrdersJSON(c *gin.Context) {
+	orders, err := h.orders.ListDeletedOrders(h.trashRetention)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "讀取垃圾桶失敗")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+// POST /api/admin/trash/:id/restore
+func (h *Handler) restoreOrderJSON(c *gin.Context) {
+	order, err := h.orders.RestoreOrder(c.Param("id"), h.trashRetention)
+	if err != nil {
+		respondError(c, orderErrorCode(err), err.Error())
+		return
+	}
+	h.publishOrderEvent(c, orderRestoredEvent(order))
+	c.JSON(http.StatusOK, order)
+}
+
+// DELETE /api/admin/trash/:id => 永久刪除
+func (h *Handler) purgeOrderJSON(c *gin.Context) {
+	if err := h.orders.PurgeOrder(c.Param("id")); err != nil {
+		respondError(c, orderErrorCode(err), err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
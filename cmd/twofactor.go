@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"pizza-tracker-go/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// 兩步驟驗證 (TOTP):
+// 1. 登入: 密碼正確且已啟用時，先把 userID 放在 pending2faUserID，輸入驗證碼 (/login/2fa) 後才寫入 userID
+// 2. 設定: /admin/account/2fa 產生金鑰與 QR code，輸入第一個驗證碼後啟用並顯示備用碼
+// 3. 店主可以要求特定角色必須啟用 (/admin/two-factor-roles)，未啟用的人登入後只能進入設定頁
+
+// 驗證 App 裡顯示的服務名稱
+const totpIssuer = "Pizza Tracker"
+
+// 輸入密碼後，多久之內要完成兩步驟驗證
+const pendingTwoFactorTTL = 5 * time.Minute
+
+type TwoFactorLoginData struct {
+	Error string
+}
+
+type TwoFactorData struct {
+	Username       string
+	Enabled        bool
+	Required       bool         // 角色被要求必須啟用，不顯示關閉按鈕
+	QRCode         template.URL // 設定中 (尚未輸入第一個驗證碼) 才有
+	Secret         string       // 無法掃描 QR code 時手動輸入
+	RecoveryCodes  []string     // 剛產生的備用碼，只顯示這一次
+	RemainingCodes int64
+	Error          string
+	Notice         string
+}
+
+type twoFactorCodeForm struct {
+	Code string `form:"code" binding:"required,max=32"`
+}
+
+type twoFactorPasswordForm struct {
+	Password string `form:"password" binding:"required"`
+}
+
+// 被要求啟用兩步驟驗證的角色，HTML 表單與 JSON API 共用
+type twoFactorRolesForm struct {
+	Roles []models.Role `form:"roles" json:"roles"`
+}
+
+// 密碼驗證通過但還沒完成兩步驟驗證的使用者，逾時或沒有時回傳 0
+func pendingTwoFactorUser(c *gin.Context) uint {
+	at, err := strconv.ParseInt(GetSession(c, "pending2faAt"), 10, 64)
+	if err != nil || time.Since(time.Unix(at, 0)) > pendingTwoFactorTTL {
+		return 0
+	}
+	id, err := strconv.ParseUint(GetSession(c, "pending2faUserID"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
+
+func setPendingTwoFactor(c *gin.Context, userID uint) {
+	SetSession(c, "pending2faUserID", fmt.Sprintf("%v", userID))
+	SetSession(c, "pending2faAt", strconv.FormatInt(time.Now().Unix(), 10))
+}
+
+func clearPendingTwoFactor(c *gin.Context) {
+	session := sessions.Default(c)
+	session.Delete("pending2faUserID")
+	session.Delete("pending2faAt")
+	session.Save()
+}
+
+// GET /login/2fa
+func (h *Handler) HandleTwoFactorLoginGet(c *gin.Context) {
+	if pendingTwoFactorUser(c) == 0 {
+		c.Redirect(http.StatusSeeOther, "/login")
+		return
+	}
+	h.renderHTML(c, http.StatusOK, "login_2fa.tmpl", TwoFactorLoginData{})
+}
+
+// POST /login/2fa
+func (h *Handler) HandleTwoFactorLoginPost(c *gin.Context) {
+	userID := pendingTwoFactorUser(c)
+	if userID == 0 {
+		h.renderHTML(c, http.StatusUnauthorized, "login.tmpl", LoginData{Error: "驗證逾時，請重新登入"})
+		return
+	}
+
+	var form twoFactorCodeForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderHTML(c, http.StatusBadRequest, "login_2fa.tmpl", TwoFactorLoginData{Error: "請輸入驗證碼"})
+		return
+	}
+
+	user, err := h.users.VerifySecondFactor(userID, form.Code, c.ClientIP())
+	if err != nil {
+		var locked *models.LoginLockedError
+		switch {
+		case errors.As(err, &locked):
+			clearPendingTwoFactor(c)
+			wait := time.Until(locked.Until)
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			h.renderHTML(c, http.StatusTooManyRequests, "login.tmpl", LoginData{
+				Error: fmt.Sprintf("登入失敗次數過多，請在 %d 分鐘後再試", int(wait.Minutes())+1),
+			})
+		case errors.Is(err, models.ErrInvalidTOTPCode):
+			h.renderHTML(c, http.StatusUnauthorized, "login_2fa.tmpl", TwoFactorLoginData{Error: err.Error()})
+		case errors.Is(err, models.ErrInvalidCredentials), errors.Is(err, models.ErrUserNotFound):
+			clearPendingTwoFactor(c)
+			h.renderHTML(c, http.StatusUnauthorized, "login.tmpl", LoginData{Error: "請重新登入"})
+		default:
+			log.Println("兩步驟驗證失敗:", err)
+			h.renderHTML(c, http.StatusInternalServerError, "login_2fa.tmpl", TwoFactorLoginData{Error: "系統錯誤，請稍後再試"})
+		}
+		return
+	}
+
+	clearPendingTwoFactor(c)
+	if err := h.startSession(c, user); err != nil {
+		log.Println("建立登入階段失敗:", err)
+		h.renderHTML(c, http.StatusInternalServerError, "login_2fa.tmpl", TwoFactorLoginData{Error: "系統錯誤，請稍後再試"})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin")
+}
+
+// GET /admin/account/2fa
+func (h *Handler) ServeTwoFactorSettings(c *gin.Context) {
+	h.renderTwoFactor(c, http.StatusOK, TwoFactorData{})
+}
+
+// 依登入者目前的狀態補齊 data 再顯示設定頁
+func (h *Handler) renderTwoFactor(c *gin.Context, status int, data TwoFactorData) {
+	// 啟用 / 關閉之後重新讀取，AuthMiddleware 放進 context 的是變更前的資料
+	user, err := h.users.GetUserByID(fmt.Sprintf("%v", currentUser(c).ID))
+	if err != nil || user == nil {
+		c.String(http.StatusInternalServerError, "讀取帳號失敗")
+		return
+	}
+	required, err := h.users.TwoFactorRequired(user.Role)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取兩步驟驗證設定失敗")
+		return
+	}
+
+	data.Username = user.Username
+	data.Enabled = user.TOTPEnabled
+	data.Required = required
+	if user.TOTPEnabled {
+		if data.RemainingCodes, err = h.users.RemainingRecoveryCodes(user.ID); err != nil {
+			c.String(http.StatusInternalServerError, "讀取備用碼失敗")
+			return
+		}
+	} else if user.TOTPSecret != "" {
+		uri := models.TOTPProvisioningURI(totpIssuer, user.Username, user.TOTPSecret)
+		png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "產生 QR code 失敗")
+			return
+		}
+		// data: URI 需要標記為 template.URL，否則 html/template 會把它換成 #ZgotmplZ
+		data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		data.Secret = user.TOTPSecret
+	}
+	h.renderHTML(c, status, "twofactor.tmpl", data)
+}
+
+// POST /admin/account/2fa/setup => 產生新的金鑰，重新整理頁面會顯示 QR code
+func (h *Handler) handleTwoFactorSetup(c *gin.Context) {
+	if _, err := h.users.StartTOTPEnrollment(currentUser(c).ID); err != nil {
+		h.renderTwoFactor(c, userErrorCode(err), TwoFactorData{Error: err.Error()})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/account/2fa")
+}
+
+// POST /admin/account/2fa/enable => 輸入 App 產生的第一個驗證碼
+func (h *Handler) handleTwoFactorEnable(c *gin.Context) {
+	var form twoFactorCodeForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderTwoFactor(c, http.StatusBadRequest, TwoFactorData{Error: "請輸入驗證碼"})
+		return
+	}
+	codes, err := h.users.EnableTOTP(currentUser(c).ID, form.Code)
+	if err != nil {
+		h.renderTwoFactor(c, userErrorCode(err), TwoFactorData{Error: err.Error()})
+		return
+	}
+	h.renderTwoFactor(c, http.StatusOK, TwoFactorData{RecoveryCodes: codes, Notice: "已啟用兩步驟驗證"})
+}
+
+// POST /admin/account/2fa/disable
+func (h *Handler) handleTwoFactorDisable(c *gin.Context) {
+	var form twoFactorPasswordForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderTwoFactor(c, http.StatusBadRequest, TwoFactorData{Error: "請輸入密碼"})
+		return
+	}
+	if err := h.users.DisableTOTP(currentUser(c).ID, form.Password); err != nil {
+		h.renderTwoFactor(c, userErrorCode(err), TwoFactorData{Error: err.Error()})
+		return
+	}
+	h.renderTwoFactor(c, http.StatusOK, TwoFactorData{Notice: "已關閉兩步驟驗證"})
+}
+
+// POST /admin/account/2fa/recovery-codes => 重新產生備用碼
+func (h *Handler) handleRecoveryCodesRegenerate(c *gin.Context) {
+	var form twoFactorPasswordForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderTwoFactor(c, http.StatusBadRequest, TwoFactorData{Error: "請輸入密碼"})
+		return
+	}
+	codes, err := h.users.RegenerateRecoveryCodes(currentUser(c).ID, form.Password)
+	if err != nil {
+		h.renderTwoFactor(c, userErrorCode(err), TwoFactorData{Error: err.Error()})
+		return
+	}
+	h.renderTwoFactor(c, http.StatusOK, TwoFactorData{RecoveryCodes: codes, Notice: "已產生新的備用碼，舊的備用碼已失效"})
+}
+
+// POST /admin/users/:id/2fa/reset => 店主重設其他人的兩步驟驗證
+func (h *Handler) handleUserTwoFactorReset(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.users.ResetTOTP(id); err != nil {
+		h.renderUsers(c, userErrorCode(err), err.Error(), "")
+		return
+	}
+	h.renderUsers(c, http.StatusOK, "", "已重設兩步驟驗證")
+}
+
+// POST /admin/two-factor-roles
+func (h *Handler) handleTwoFactorRoles(c *gin.Context) {
+	var form twoFactorRolesForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderUsers(c, http.StatusBadRequest, "Invalid input: "+err.Error(), "")
+		return
+	}
+	if err := h.users.SetTwoFactorRoles(form.Roles); err != nil {
+		h.renderUsers(c, userErrorCode(err), err.Error(), "")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/users")
+}
+
+// GET /api/admin/two-factor-roles
+func (h *Handler) getTwoFactorRolesJSON(c *gin.Context) {
+	roles, err := h.users.TwoFactorRoles()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "讀取兩步驟驗證設定失敗")
+		return
+	}
+	if roles == nil {
+		roles = []models.Role{}
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// PUT /api/admin/two-factor-roles => 整批取代
+func (h *Handler) putTwoFactorRolesJSON(c *gin.Context) {
+	var body twoFactorRolesForm
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if err := h.users.SetTwoFactorRoles(body.Roles); err != nil {
+		respondError(c, userErrorCode(err), err.Error())
+		return
+	}
+	h.getTwoFactorRolesJSON(c)
+}
+
+// POST /api/admin/users/:id/2fa/reset
+func (h *Handler) resetUserTwoFactorJSON(c *gin.Context) {
+	id, ok := userIDParamJSON(c)
+	if !ok {
+		return
+	}
+	if err := h.users.ResetTOTP(id); err != nil {
+		respondError(c, userErrorCode(err), err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
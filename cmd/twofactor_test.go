@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"pizza-tracker-go/internal/models"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorRequiredRoleGate(t *testing.T) {
+	server := newTestServer(t)
+	now := time.Now()
+	server.store.Clock = func() time.Time { return now }
+	cook, err := server.store.CreateUser("cook", "secret123", models.RoleKitchen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.store.SetTwoFactorRoles([]models.Role{models.RoleKitchen}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 還沒設定兩步驟驗證: 只能進入 /admin/account 底下的頁面
+	browser := server.newClient(t)
+	expectRedirect(t, browser.login("cook", "secret123"), "/admin")
+	expectRedirect(t, browser.get("/admin"), "/admin/account/2fa")
+	expectRedirect(t, browser.get("/admin/sessions"), "/admin/account/2fa")
+	expectStatus(t, browser.get("/admin/account/2fa"), http.StatusOK)
+	expectStatus(t, browser.get("/api/admin/orders"), http.StatusForbidden)
+
+	// 完成設定後不再被擋
+	secret, err := server.store.StartTOTPEnrollment(cook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := models.TOTPCode(secret, now)
+	if _, err := server.store.EnableTOTP(cook.ID, code); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, browser.get("/admin"), http.StatusOK)
+	expectStatus(t, browser.get("/api/admin/orders"), http.StatusOK)
+
+	// 沒有被要求的角色不受影響
+	if _, err := server.store.CreateUser("rider", "secret123", models.RoleDriver); err != nil {
+		t.Fatal(err)
+	}
+	rider := server.newClient(t)
+	expectRedirect(t, rider.login("rider", "secret123"), "/admin")
+	expectStatus(t, rider.get("/admin"), http.StatusOK)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	server := newTestServer(t)
+	now := time.Now()
+	server.store.Clock = func() time.Time { return now }
+	user, err := server.store.CreateUser("alice", "secret123", models.RoleManager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := server.store.StartTOTPEnrollment(user.ID)
+	code, _ := models.TOTPCode(secret, now)
+	if _, err := server.store.EnableTOTP(user.ID, code); err != nil {
+		t.Fatal(err)
+	}
+
+	// 密碼正確還不算登入，要再輸入驗證碼
+	browser := server.newClient(t)
+	expectRedirect(t, browser.login("alice", "secret123"), "/login/2fa")
+	expectRedirect(t, browser.get("/admin"), "/login")
+
+	// 設定時用過的驗證碼不能再用
+	expectStatus(t, browser.postForm("/login/2fa", url.Values{"code": {code}}), http.StatusUnauthorized)
+
+	now = now.Add(30 * time.Second)
+	code, _ = models.TOTPCode(secret, now)
+	expectRedirect(t, browser.postForm("/login/2fa", url.Values{"code": {code}}), "/admin")
+	expectStatus(t, browser.get("/admin"), http.StatusOK)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"pizza-tracker-go/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 後台帳號管理 /admin/users (需要 user:manage 權限)，以及每個人都能使用的修改密碼 /admin/account/password
+
+type UsersData struct {
+	Users         []models.User
+	Roles         []models.Role
+	TwoFactor     map[models.Role]bool // 必須啟用兩步驟驗證的角色
+	CurrentUserID uint                 // 自己的那一列不顯示停用按鈕
+	Username      string
+	Error         string
+	Notice        string
+}
+
+type AccountData struct {
+	Username string
+	Error    string
+	Notice   string
+}
+
+// 新增帳號，HTML 表單與 JSON API 共用
+// 密碼上限 72 => bcrypt 只會使用前 72 bytes
+type userCreateForm struct {
+	Username string      `form:"username" json:"username" binding:"required,min=3,max=50"`
+	Password string      `form:"password" json:"password" binding:"required,min=8,max=72"`
+	Role     models.Role `form:"role" json:"role" binding:"required"`
+}
+
+type passwordResetForm struct {
+	Password string `form:"password" json:"password" binding:"required,min=8,max=72"`
+}
+
+type passwordChangeForm struct {
+	CurrentPassword string `form:"current_password" json:"currentPassword" binding:"required"`
+	NewPassword     string `form:"new_password" json:"newPassword" binding:"required,min=8,max=72,nefield=CurrentPassword"`
+}
+
+var errDisableSelf = errors.New("不能停用自己的帳號")
+
+func (h *Handler) ServeUsers(c *gin.Context) {
+	h.renderUsers(c, http.StatusOK, "", "")
+}
+
+// 顯示帳號管理頁，errMsg / notice 不為空時顯示在頁面上方
+func (h *Handler) renderUsers(c *gin.Context, status int, errMsg, notice string) {
+	users, err := h.users.ListUsers()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取帳號失敗")
+		return
+	}
+	twoFactorRoles, err := h.users.TwoFactorRoles()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "讀取兩步驟驗證設定失敗")
+		return
+	}
+	twoFactor := make(map[models.Role]bool, len(twoFactorRoles))
+	for _, role := range twoFactorRoles {
+		twoFactor[role] = true
+	}
+	var currentID uint
+	if user := currentUser(c); user != nil {
+		currentID = user.ID
+	}
+	h.renderHTML(c, status, "users.tmpl", UsersData{
+		Users:         users,
+		Roles:         models.Roles,
+		TwoFactor:     twoFactor,
+		CurrentUserID: currentID,
+		Username:      GetSession(c, "username"),
+		Error:         errMsg,
+		Notice:        notice,
+	})
+}
+
+func (h *Handler) handleUserCreate(c *gin.Context) {
+	var form userCreateForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderUsers(c, http.StatusBadRequest, "Invalid input: "+err.Error(), "")
+		return
+	}
+	if _, err := h.users.CreateUser(form.Username, form.Password, form.Role); err != nil {
+		h.renderUsers(c, userErrorCode(err), err.Error(), "")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/users")
+}
+
+func (h *Handler) handleUserRole(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.users.SetRole(id, models.Role(c.PostForm("role"))); err != nil {
+		h.renderUsers(c, userErrorCode(err), err.Error(), "")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/users")
+}
+
+func (h *Handler) handleUserDisable(c *gin.Context) {
+	h.setUserDisabled(c, true)
+}
+
+func (h *Handler) handleUserEnable(c *gin.Context) {
+	h.setUserDisabled(c, false)
+}
+
+func (h *Handler) setUserDisabled(c *gin.Context, disabled bool) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	if err := h.disableUser(c, id, disabled); err != nil {
+		h.renderUsers(c, userErrorCode(err), err.Error(), "")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/users")
+}
+
+// 不允許停用自己，避免唯一的管理者把自己鎖在外面
+func (h *Handler) disableUser(c *gin.Context, id uint, disabled bool) error {
+	if user := currentUser(c); disabled && user != nil && user.ID == id {
+		return errDisableSelf
+	}
+	return h.users.SetDisabled(id, disabled)
+}
+
+func (h *Handler) handleUserPasswordReset(c *gin.Context) {
+	id, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+	var form passwordResetForm
+	if err := c.ShouldBind(&form); err != nil {
+		h.renderUsers(c, http.StatusBadRequest, "Invalid input: "+err.Error(), "")
+		return
+	}
+	if err := h.users.ResetPassword(id, form.Password); err != nil {
+		h.renderUsers(c, userErrorCode(err), err.Error(), "")
+		return
+	}
+	h.renderUsers(c, http.StatusOK, "", "密碼已重設")
+}
+
+// GET /admin/account/password => 自行修改密碼
+func (h *Handler) ServeAccountPassword(c *gin.Context) {
+	h.renderHTML(c, http.StatusOK, "account.tmpl", AccountData{Username: GetSession(c, "username")})
+}
+
+func (h *Handler) handleAccountPassword(c *gin.Context) {
+	data := AccountData{Username: GetSession(c, "username")}
+
+	var form passwordChangeForm
+	if err := c.ShouldBind(&form); err != nil {
+		data.Error = "Invalid input: " + err.Error()
+		h.renderHTML(c, http.StatusBadRequest, "account.tmpl", data)
+		return
+	}
+	if err := h.users.ChangePassword(currentUser(c).ID, form.CurrentPassword, form.NewPassword, currentSessionID(c)); err != nil {
+		data.Error = err.Error()
+		h.renderHTML(c, userErrorCode(err), "account.tmpl", data)
+		return
+	}
+	data.Notice = "密碼已更新，其他裝置已登出"
+	h.renderHTML(c, http.StatusOK, "account.tmpl", data)
+}
+
+// 404 => 帳號不存在；409 => 名稱重複、會失去最後一個店主或兩步驟驗證的狀態不符；422 => 角色不存在
+func userErrorCode(err error) int {
+	switch {
+	case errors.Is(err, models.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrUserDuplicate), errors.Is(err, models.ErrLastOwner),
+		errors.Is(err, models.ErrTOTPAlreadyEnabled), errors.Is(err, models.ErrTOTPNotPending),
+		errors.Is(err, models.ErrTOTPNotEnabled), errors.Is(err, models.ErrTOTPRequired):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrInvalidRole):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, models.ErrWrongPassword), errors.Is(err, errDisableSelf), errors.Is(err, models.ErrInvalidTOTPCode):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// 解析路徑上的 :id，格式錯誤時直接回覆 400
+func userIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "無效的帳號ID")
+		return 0, false
+	}
+	return uint(id), true
+}
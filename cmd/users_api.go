@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"pizza-tracker-go/internal/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 帳號管理的 JSON API，功能與 /admin/users 相同
+
+// PATCH /api/admin/users/:id 的 body，沒有帶的欄位不修改
+type userPatch struct {
+	Role     *models.Role `json:"role"`
+	Disabled *bool        `json:"disabled"`
+}
+
+// GET /api/admin/users
+func (h *Handler) listUsersJSON(c *gin.Context) {
+	users, err := h.users.ListUsers()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "讀取帳號失敗")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users, "roles": models.Roles})
+}
+
+// POST /api/admin/users
+func (h *Handler) createUserJSON(c *gin.Context) {
+	var body userCreateForm
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	user, err := h.users.CreateUser(body.Username, body.Password, body.Role)
+	if err != nil {
+		respondError(c, userErrorCode(err), err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, user)
+}
+
+// PATCH /api/admin/users/:id => 調整角色、停用 / 啟用
+func (h *Handler) patchUserJSON(c *gin.Context) {
+	id, ok := userIDParamJSON(c)
+	if !ok {
+		return
+	}
+	var body userPatch
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if body.Role != nil {
+		if err := h.users.SetRole(id, *body.Role); err != nil {
+			respondError(c, userErrorCode(err), err.Error())
+			return
+		}
+	}
+	if body.Disabled != nil {
+		if err := h.disableUser(c, id, *body.Disabled); err != nil {
+			respondError(c, userErrorCode(err), err.Error())
+			return
+		}
+	}
+
+	user, err := h.users.GetUserByID(strconv.FormatUint(uint64(id), 10))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "讀取帳號失敗")
+		return
+	}
+	if user == nil {
+		respondError(c, http.StatusNotFound, models.ErrUserNotFound.Error())
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// POST /api/admin/users/:id/password => 管理者重設密碼
+func (h *Handler) resetUserPasswordJSON(c *gin.Context) {
+	id, ok := userIDParamJSON(c)
+	if !ok {
+		return
+	}
+	var body passwordResetForm
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if err := h.users.ResetPassword(id, body.Password); err != nil {
+		respondError(c, userErrorCode(err), err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// POST /api/admin/account/password => 自行修改密碼，其他裝置的 session 會被登出
+func (h *Handler) changePasswordJSON(c *gin.Context) {
+	var body passwordChangeForm
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if err := h.users.ChangePassword(currentUser(c).ID, body.CurrentPassword, body.NewPassword, currentSessionID(c)); err != nil {
+		respondError(c, userErrorCode(err), err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func userIDParamJSON(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "無效的帳號ID")
+		return 0, false
+	}
+	return uint(id), true
+}
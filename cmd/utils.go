@@ -11,6 +11,10 @@ import (
 	"fmt"
 	"html/template" // 這邊不要用成 text/template，會導致 Gin 無法正確渲染模板 (SetHTMLTemplate)
 	"os"
+	"pizza-tracker-go/internal/models"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	gormsessions "github.com/gin-contrib/sessions/gorm"
@@ -19,17 +23,65 @@ import (
 )
 
 type Config struct {
-	Port             string
-	DBPath           string
-	SessionSecretKey string
+	Port                 string
+	DatabaseURL          string        // sqlite:// / postgres:// / mysql://，沒有 scheme 時視為 SQLite 檔案路徑
+	DBMaxOpenConns       int           // 資料庫連線池: 同時開啟的連線上限，0 代表不限制
+	DBMaxIdleConns       int           // 資料庫連線池: 保留的閒置連線數
+	DBConnLifetime       time.Duration // 資料庫連線使用多久後重新建立，0 代表不限制
+	DBConnIdleTime       time.Duration // 閒置多久的資料庫連線直接關閉，0 代表不限制
+	SessionSecretKey     string
+	TaxRateBps           int64  // 稅率，以萬分之一為單位 (500 = 5%)
+	NotifyBackend        string // memory / redis，多台機器部署時需使用 redis
+	RedisAddr            string
+	RedisPassword        string
+	SSEHeartbeat         time.Duration // SSE 心跳間隔，讓 proxy 不會把閒置連線切斷，也能及早發現斷線
+	SSEMaxDuration       time.Duration // 單一 SSE 連線最長時間，時間到由瀏覽器自動重連，0 代表不限制
+	SSEMaxPerTopic       int           // 同一個 topic 最多幾個 SSE 連線，0 代表不限制
+	SSEMaxPerIP          int           // 同一個 IP 最多幾個 SSE 連線，0 代表不限制
+	IdempotencyTTL       time.Duration // 建立訂單的 Idempotency-Key 保留多久，期間內重送會拿到同一筆訂單
+	TrashRetention       time.Duration // 刪除的訂單在垃圾桶保留多久，期間內可以還原，之後永久刪除
+	ArchiveAfter         time.Duration // 已結案的訂單超過多久沒有更新就封存，0 代表不封存
+	LoginRecordRetention time.Duration // 登入紀錄 (/admin/logins) 保留多久，之後由背景工作刪除
+	TrustedProxies       []string      // 可以信任 X-Forwarded-For 的 proxy (IP 或 CIDR)，空的代表直接用連線的 IP
 }
 
 // 1. 載入環境變數config
 func loadConfig() Config {
 	return Config{
-		Port:             getEnv("PORT", "8080"), // 定義key 跟 value
-		DBPath:           getEnv("DATABASE_URL", "./data/orders.db"),
-		SessionSecretKey: getEnv("SESSION_SECRET_KEY", "pizza-order-secret-key"),
+		Port:                 getEnv("PORT", "8080"), // 定義key 跟 value
+		DatabaseURL:          getEnv("DATABASE_URL", "sqlite://data/orders.db"),
+		DBMaxOpenConns:       getEnvInt("DB_MAX_OPEN_CONNS", 20),
+		DBMaxIdleConns:       getEnvInt("DB_MAX_IDLE_CONNS", 5),
+		DBConnLifetime:       time.Duration(getEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", 30)) * time.Minute,
+		DBConnIdleTime:       time.Duration(getEnvInt("DB_CONN_MAX_IDLE_MINUTES", 5)) * time.Minute,
+		SessionSecretKey:     getEnv("SESSION_SECRET_KEY", "pizza-order-secret-key"),
+		TaxRateBps:           int64(getEnvInt("TAX_RATE_BPS", 500)),
+		NotifyBackend:        getEnv("NOTIFY_BACKEND", BrokerMemory),
+		RedisAddr:            getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:        getEnv("REDIS_PASSWORD", ""),
+		SSEHeartbeat:         time.Duration(getEnvInt("SSE_HEARTBEAT_SECONDS", 15)) * time.Second,
+		SSEMaxDuration:       time.Duration(getEnvInt("SSE_MAX_DURATION_MINUTES", 30)) * time.Minute,
+		SSEMaxPerTopic:       getEnvInt("SSE_MAX_PER_TOPIC", 50),
+		SSEMaxPerIP:          getEnvInt("SSE_MAX_PER_IP", 20),
+		IdempotencyTTL:       time.Duration(getEnvInt("IDEMPOTENCY_TTL_HOURS", 24)) * time.Hour,
+		TrashRetention:       time.Duration(getEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		ArchiveAfter:         time.Duration(getEnvInt("ARCHIVE_AFTER_DAYS", 90)) * 24 * time.Hour,
+		LoginRecordRetention: time.Duration(getEnvInt("LOGIN_RECORD_RETENTION_DAYS", 90)) * 24 * time.Hour,
+		TrustedProxies:       getEnvList("TRUSTED_PROXIES"),
+	}
+}
+
+func (cfg Config) subscriberLimits() SubscriberLimits {
+	return SubscriberLimits{PerTopic: cfg.SSEMaxPerTopic, PerIP: cfg.SSEMaxPerIP}
+}
+
+func (cfg Config) dbConfig() models.DBConfig {
+	return models.DBConfig{
+		URL:             cfg.DatabaseURL,
+		MaxOpenConns:    cfg.DBMaxOpenConns,
+		MaxIdleConns:    cfg.DBMaxIdleConns,
+		ConnMaxLifetime: cfg.DBConnLifetime,
+		ConnMaxIdleTime: cfg.DBConnIdleTime,
 	}
 }
 
@@ -44,8 +96,43 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// 數字型的環境變數，格式錯誤時使用預設值
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// 以逗號分隔的環境變數，忽略空白與空的項目；沒有設定時回傳 nil
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// 金額以最小貨幣單位儲存，顯示時轉成 1,234.50 的格式
+func formatMoney(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	major := strconv.FormatInt(amount/100, 10)
+	// 每三位數加上千分位逗號
+	for i := len(major) - 3; i > 0; i -= 3 {
+		major = major[:i] + "," + major[i:]
+	}
+	return fmt.Sprintf("%s%s.%02d", sign, major, amount%100)
+}
+
 // 2. 載入模板
-func loadTemplates(router *gin.Engine) error {
+// 回傳的模板只拿來 Clone，實際渲染見 renderHTML (csrf.go)
+func loadTemplates() (*template.Template, error) {
 	functions := template.FuncMap{
 		"add": func(a, b int) int { return a + b },
 		// any = interface{}
@@ -59,18 +146,23 @@ func loadTemplates(router *gin.Engine) error {
 			// https://ithelp.ithome.com.tw/articles/10335017
 			return template.JS(b)
 		},
+		// admin.tmpl 下拉選單 => 只列出目前狀態、登入者的角色可以合法轉換過去的狀態
+		"nextStatuses": func(role models.Role, status string) []string {
+			return models.NextStatuses(status, models.ActorStaff, role)
+		},
+		// 模板依角色隱藏沒有權限的操作，例如 {{if can .Role "order:delete"}}
+		"can": func(role models.Role, permission string) bool {
+			return role.Can(models.Permission(permission))
+		},
+		"isTerminal": models.IsTerminalStatus,
+		"money":      formatMoney,
+		// 每個請求由 renderHTML 換成該 session 的 token，這裡只是讓 Parse 時認得這個函式
+		"csrfToken": func() string { return "" },
 	}
 
-	tmpl, err := template.New("").Funcs(functions).ParseGlob("templates/*.tmpl")
-	if err != nil {
-		return err
-	}
-	// Gin 的 SetHTMLTemplate 需要 *html/template.Template
-	// 但你現在用的是 Go 標準庫的 text/template
-	// Gin 的 router.SetHTMLTemplate 明確要求 *html/template.Template，所以你不能傳 *text/template.Template。
-	// 只要把 text/template 換成 html/template
-	router.SetHTMLTemplate(tmpl)
-	return nil
+	// 這邊不使用 router.SetHTMLTemplate => 模板需要每個請求不同的 csrfToken，改由 renderHTML 渲染
+	// 注意 render.HTML 需要的是 *html/template.Template，不能換成 text/template
+	return template.New("").Funcs(functions).ParseGlob("templates/*.tmpl")
 }
 
 /*
@@ -80,6 +172,9 @@ func loadTemplates(router *gin.Engine) error {
     secret => 用來簽署 session cookie 的密鑰（secret key），確保 session ID 不被篡改
     ⚠️ 實際部署時應使用更安全、隨機且保密的金鑰，而非硬編碼 "secret"。
 */
+// session cookie 的名稱，CSRFMiddleware 用它判斷 /api 的呼叫是否來自瀏覽器
+const sessionCookieName = "pizza-tracker"
+
 func createSessionStore(db *gorm.DB, secret []byte) gormsessions.Store {
 	store := gormsessions.NewStore(db, true, secret)
 
@@ -129,6 +224,17 @@ func GetSession(c *gin.Context, key string) string {
 	return str
 }
 
+// session 中的 userID 是字串，寫進資料庫 (例如 OrderStatusEvent.UserID) 時需要轉回 uint
+// 沒登入或格式錯誤時回傳 nil
+func sessionUserID(c *gin.Context) *uint {
+	id, err := strconv.ParseUint(GetSession(c, "userID"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	userID := uint(id)
+	return &userID
+}
+
 func ClearAllSession(c *gin.Context) error {
 	session := sessions.Default(c)
 	// session.Delete("user") => 只刪除 session 中 特定 key（這裡是 "user"）的值。
@@ -1,37 +1,55 @@
 package main
 
 import (
+	"log/slog"
 	"pizza-tracker-go/internal/models"
-	"slices"
+	"reflect"
+	"strings"
 
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10" // 註冊自訂驗證規則，讓你在模型結構體的欄位標籤（struct tag）中可以使用這些規則來驗證輸入資料是否合法
 )
 
+// catalog => 線上菜單，驗證器每次都查詢目前上架的品項 (有快取)，後台修改菜單後不需要重新啟動
+func RegisterCustomValidators(catalog models.CatalogStore) {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 
-func RegisterCustomValidators() {
-    if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
-
-        // 註冊自定義校驗方法:
-		// models.PizzaSizes => createSliceValidator 它接收你想要允許的值清單 ex: []string{"Small", "Medium", "Large",}
-        if err := v.RegisterValidation("valid_pizza_size", createSliceValidator(models.PizzaSizes)); err != nil {
+		// 註冊自定義校驗方法:
+		// catalog.IsActiveSize => createCatalogValidator 它接收一個查詢函式，判斷值是否為上架中的品項
+		if err := v.RegisterValidation("valid_pizza_size", createCatalogValidator(catalog.IsActiveSize)); err != nil {
 			panic(err)
-        }
+		}
 
-		if err := v.RegisterValidation("valid_pizza_type", createSliceValidator(models.PizzaTypes)); err != nil {
+		if err := v.RegisterValidation("valid_pizza_type", createCatalogValidator(catalog.IsActiveProduct)); err != nil {
 			panic(err)
 		}
-        return
-    }
+
+		// 錯誤訊息中的欄位名稱改用 json tag (沒有的話用 form tag)，讓 API 回傳的欄位名稱跟請求一致
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+				if name != "" && name != "-" {
+					return name
+				}
+			}
+			return field.Name
+		})
+		return
+	}
 	panic("validator engine is not of type *validator.Validate")
 }
 
 // 自定義檢測規則
-func createSliceValidator(allowed []string) validator.Func {
+// 查詢資料庫失敗時視為不合法，寧可擋下訂單也不要接受不存在的品項
+func createCatalogValidator(isActive func(name string) (bool, error)) validator.Func {
 	// 任何符合 func(fl validator.FieldLevel) bool 簽名的函式，就是 validator.Func
 	return func(fl validator.FieldLevel) bool {
 		value := fl.Field().String() // 取得欄位字串值
-		return slices.Contains(allowed, value)
+		ok, err := isActive(value)
+		if err != nil {
+			slog.Error("讀取菜單失敗", "error", err)
+			return false
+		}
+		return ok
 	}
- 
 }
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"pizza-tracker-go/internal/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+/*
+/ws => 與 SSE 共用同一組 Broker topic 的 WebSocket 通道，一條連線可以同時訂閱多筆訂單
+
+client 送出的訊息:
+
+	{"action":"subscribe","topic":"order:abc","lastEventId":3}   // lastEventId 選填，補送該 ID 之後的事件
+	{"action":"unsubscribe","topic":"order:abc"}
+	{"action":"ack","topic":"order:abc","eventId":5}              // 回報已處理到哪個事件
+
+server 回覆的訊息:
+
+	{"type":"subscribed","topic":"order:abc"}
+	{"type":"event","topic":"order:abc","id":5,"event":"order.status_changed","data":{...}}
+	{"type":"unsubscribed","topic":"order:abc"}
+	{"type":"error","topic":"order:abc","message":"..."}
+
+topic 規則與 SSE 相同:
+  - order:<id>       => 任何人都可以訂閱，訂單必須存在
+  - admin:new_orders => 需要登入，規則與 /admin 群組的 AuthMiddleware 相同 (連線建立時檢查 session)
+
+ack 過的事件 ID 會記在這條連線上，之後重新訂閱同一個 topic 且沒有帶 lastEventId 時，從 ack 的位置開始補送
+*/
+
+const (
+	wsMaxSubscriptions = 20               // 一條連線最多同時訂閱幾個 topic
+	wsMaxMessageSize   = 4096             // client 送來的單一訊息上限 (bytes)
+	wsWriteTimeout     = 10 * time.Second // 寫入逾時，對方網路太慢時放棄這條連線
+)
+
+// Origin 必須與 Host 相同 (預設行為)，避免其他網站借用登入中的 session 連進來
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+type wsRequest struct {
+	Action      string `json:"action"` // subscribe / unsubscribe / ack
+	Topic       string `json:"topic"`
+	LastEventID uint64 `json:"lastEventId,omitempty"`
+	EventID     uint64 `json:"eventId,omitempty"`
+}
+
+type wsMessage struct {
+	Type    string          `json:"type"` // subscribed / unsubscribed / event / error
+	Topic   string          `json:"topic,omitempty"`
+	ID      uint64          `json:"id,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// 一條 WebSocket 連線上的狀態
+// gorilla/websocket 同一時間只允許一個 goroutine 寫入，所有要送出的訊息都先丟進 out，由 writeLoop 統一寫出
+type wsSession struct {
+	h       *Handler
+	conn    *websocket.Conn
+	ctx     context.Context
+	ip      string
+	isAdmin bool
+
+	out  chan wsMessage
+	done chan struct{}
+
+	mu    sync.Mutex
+	subs  map[string]chan Event
+	acked map[string]uint64
+}
+
+// GET /ws
+func (h *Handler) handleWebSocket(c *gin.Context) {
+	// 升級前先確認登入狀態，升級之後就拿不到 session 的 cookie 了
+	isAdmin := h.isAuthenticated(c)
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 失敗時已經回覆 400 給 client
+		slog.Warn("WebSocket 升級失敗", "error", err)
+		return
+	}
+
+	s := &wsSession{
+		h:       h,
+		conn:    conn,
+		ctx:     c.Request.Context(),
+		ip:      c.ClientIP(),
+		isAdmin: isAdmin,
+		out:     make(chan wsMessage, 32),
+		done:    make(chan struct{}),
+		subs:    make(map[string]chan Event),
+		acked:   make(map[string]uint64),
+	}
+	go s.writeLoop()
+	s.readLoop()
+	s.close()
+}
+
+// 讀取 client 送來的指令，連線中斷或讀取逾時 (沒有回應 ping) 時結束
+func (s *wsSession) readLoop() {
+	s.conn.SetReadLimit(wsMaxMessageSize)
+	s.extendReadDeadline()
+	s.conn.SetPongHandler(func(string) error {
+		s.extendReadDeadline()
+		return nil
+	})
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Warn("WebSocket 連線異常中斷", "ip", s.ip, "error", err)
+			}
+			return
+		}
+
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.send(wsMessage{Type: "error", Message: "訊息格式錯誤，必須是 JSON"})
+			continue
+		}
+
+		switch req.Action {
+		case "subscribe":
+			s.subscribe(req)
+		case "unsubscribe":
+			if s.unsubscribe(req.Topic) {
+				s.send(wsMessage{Type: "unsubscribed", Topic: req.Topic})
+			} else {
+				s.send(wsMessage{Type: "error", Topic: req.Topic, Message: "尚未訂閱此 topic"})
+			}
+		case "ack":
+			s.ack(req)
+		default:
+			s.send(wsMessage{Type: "error", Topic: req.Topic, Message: "未知的 action: " + req.Action})
+		}
+	}
+}
+
+// 沒有 heartbeat 設定時不設讀取逾時，只靠 TCP 本身發現斷線
+func (s *wsSession) extendReadDeadline() {
+	if s.h.sseHeartbeat > 0 {
+		s.conn.SetReadDeadline(time.Now().Add(2 * s.h.sseHeartbeat))
+	}
+}
+
+// 與 SSE 相同的心跳間隔送出 ping，client 必須在兩個間隔內回 pong (瀏覽器會自動回)
+func (s *wsSession) writeLoop() {
+	var heartbeat <-chan time.Time
+	if s.h.sseHeartbeat > 0 {
+		ticker := time.NewTicker(s.h.sseHeartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.done:
+			s.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteTimeout))
+			return
+		case msg := <-s.out:
+			s.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := s.conn.WriteJSON(msg); err != nil {
+				s.conn.Close() // 讓 readLoop 的讀取失敗，進而結束整條連線
+				return
+			}
+		case <-heartbeat:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				s.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// 連線已經結束時直接丟掉訊息，避免 goroutine 卡住
+func (s *wsSession) send(msg wsMessage) {
+	select {
+	case s.out <- msg:
+	case <-s.done:
+	}
+}
+
+func (s *wsSession) subscribe(req wsRequest) {
+	topic := req.Topic
+	if err := s.authorize(topic); err != nil {
+		s.send(wsMessage{Type: "error", Topic: topic, Message: err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	if _, ok := s.subs[topic]; ok {
+		s.mu.Unlock()
+		s.send(wsMessage{Type: "subscribed", Topic: topic}) // 重複訂閱視為成功
+		return
+	}
+	if len(s.subs) >= wsMaxSubscriptions {
+		s.mu.Unlock()
+		s.send(wsMessage{Type: "error", Topic: topic, Message: "訂閱的 topic 數量已達上限"})
+		return
+	}
+	lastEventID := req.LastEventID
+	if lastEventID == 0 {
+		lastEventID = s.acked[topic]
+	}
+
+	client := make(chan Event, 10)
+	backlog, err := s.h.notificationManager.Subscribe(s.ctx, topic, client, SubscribeOptions{
+		LastEventID: lastEventID,
+		ClientIP:    s.ip,
+	})
+	if err != nil {
+		s.mu.Unlock()
+		msg := "訂閱失敗"
+		if errors.Is(err, ErrTooManySubscribers) {
+			msg = "訂閱數已達上限"
+		}
+		slog.Warn("WebSocket 訂閱失敗", "topic", topic, "ip", s.ip, "error", err)
+		s.send(wsMessage{Type: "error", Topic: topic, Message: msg})
+		return
+	}
+	s.subs[topic] = client
+	s.mu.Unlock()
+
+	s.send(wsMessage{Type: "subscribed", Topic: topic})
+	go s.forward(topic, backlog, client)
+}
+
+// 檢查這條連線能不能訂閱 topic，規則與 SSE 的 notificationHandler / StreamNewOrderNotifications 相同
+func (s *wsSession) authorize(topic string) error {
+	switch {
+	case topic == adminTopic:
+		if !s.isAdmin {
+			return errors.New("需要登入才能訂閱此 topic")
+		}
+		return nil
+	case strings.HasPrefix(topic, "order:"):
+		if _, err := s.h.orders.FindOrder(strings.TrimPrefix(topic, "order:")); err != nil {
+			return errors.New("order not found")
+		}
+		return nil
+	default:
+		return errors.New("未知的 topic: " + topic)
+	}
+}
+
+// 把補送的事件與之後的即時事件轉成 wsMessage 送出，client 被 close 時結束
+func (s *wsSession) forward(topic string, backlog []Event, client chan Event) {
+	var sent uint64
+	for _, ev := range backlog {
+		s.send(eventMessage(topic, ev))
+		sent = ev.ID
+	}
+	for ev := range client {
+		if sent == 0 || ev.ID > sent {
+			s.send(eventMessage(topic, ev))
+			sent = ev.ID
+		}
+	}
+
+	// 不是 client 自己取消訂閱，代表太慢被 Broker 踢掉，通知 client 帶著 lastEventId 重新訂閱
+	s.mu.Lock()
+	current, ok := s.subs[topic]
+	evicted := ok && current == client
+	if evicted {
+		delete(s.subs, topic)
+	}
+	s.mu.Unlock()
+	if evicted {
+		// Broker 已經移除這個 client，仍要呼叫 Unsubscribe 讓 RedisBroker 更新 topic 的訂閱數
+		s.h.notificationManager.Unsubscribe(context.Background(), topic, client)
+		s.send(wsMessage{Type: "error", Topic: topic, Message: "接收速度過慢，已取消訂閱，請帶 lastEventId 重新訂閱"})
+	}
+}
+
+// 事件的 Data 是 JSON (order.* 事件) 時原樣放進 data，否則當成字串
+func eventMessage(topic string, ev Event) wsMessage {
+	data := json.RawMessage(ev.Data)
+	if !json.Valid(data) {
+		data, _ = json.Marshal(ev.Data)
+	}
+	return wsMessage{Type: "event", Topic: topic, ID: ev.ID, Event: ev.Type, Data: data}
+}
+
+// 回傳 false 代表原本就沒有訂閱
+func (s *wsSession) unsubscribe(topic string) bool {
+	s.mu.Lock()
+	client, ok := s.subs[topic]
+	delete(s.subs, topic)
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	// Unsubscribe 會 close(client)，forward 隨之結束
+	s.h.notificationManager.Unsubscribe(context.Background(), topic, client)
+	return true
+}
+
+func (s *wsSession) ack(req wsRequest) {
+	s.mu.Lock()
+	_, ok := s.subs[req.Topic]
+	if ok && req.EventID > s.acked[req.Topic] {
+		s.acked[req.Topic] = req.EventID
+	}
+	s.mu.Unlock()
+	if !ok {
+		s.send(wsMessage{Type: "error", Topic: req.Topic, Message: "尚未訂閱此 topic"})
+	}
+}
+
+// 取消所有訂閱並關閉連線
+func (s *wsSession) close() {
+	s.mu.Lock()
+	topics := make([]string, 0, len(s.subs))
+	for topic := range s.subs {
+		topics = append(topics, topic)
+	}
+	s.mu.Unlock()
+	for _, topic := range topics {
+		s.unsubscribe(topic)
+	}
+	close(s.done)
+	s.conn.Close()
+}
+
+// 與 /admin/notifications 相同的判斷: session 中有 userID、資料庫裡還有這個使用者，且角色可以查看訂單
+func (h *Handler) isAuthenticated(c *gin.Context) bool {
+	userID := GetSession(c, "userID")
+	if userID == "" {
+		return false
+	}
+	user, err := h.users.GetUserByID(userID)
+	if err != nil || user == nil || user.Disabled || !user.Role.Can(models.PermOrderView) {
+		return false
+	}
+	// 已經被遠端登出的 session
+	if err := h.users.TouchSession(currentSessionID(c), user.ID, c.ClientIP()); err != nil {
+		return false
+	}
+	// 與 AuthMiddleware 相同，角色被要求兩步驟驗證但還沒設定時不能接收後台通知
+	if !user.TOTPEnabled {
+		required, err := h.users.TwoFactorRequired(user.Role)
+		return err == nil && !required
+	}
+	return true
+}
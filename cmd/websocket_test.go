@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"pizza-tracker-go/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 連到 /ws；browser 不是 nil 時帶上它的 session cookie
+func dialWS(t *testing.T, server *testServer, browser *testClient) *websocket.Conn {
+	t.Helper()
+	header := http.Header{}
+	if browser != nil {
+		u, _ := url.Parse(server.URL)
+		for _, cookie := range browser.http.Jar.Cookies(u) {
+			header.Add("Cookie", cookie.String())
+		}
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func sendWS(t *testing.T, conn *websocket.Conn, req wsRequest) {
+	t.Helper()
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readWS(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func expectWS(t *testing.T, conn *websocket.Conn, msgType, topic string) wsMessage {
+	t.Helper()
+	msg := readWS(t, conn)
+	if msg.Type != msgType || msg.Topic != topic {
+		t.Fatalf("收到 %+v，預期 %s %s", msg, msgType, topic)
+	}
+	return msg
+}
+
+func TestWebSocketTopicAuthorization(t *testing.T) {
+	server := newTestServer(t)
+	order := createTestOrder(t, server, "Dora")
+
+	// 匿名連線只能訂閱存在的訂單
+	anonymous := dialWS(t, server, nil)
+	for _, topic := range []string{adminTopic, "order:missing", "unknown"} {
+		sendWS(t, anonymous, wsRequest{Action: "subscribe", Topic: topic})
+		expectWS(t, anonymous, "error", topic)
+	}
+	sendWS(t, anonymous, wsRequest{Action: "subscribe", Topic: "order:" + order.ID})
+	expectWS(t, anonymous, "subscribed", "order:"+order.ID)
+
+	// 登入的後台帳號可以訂閱新訂單通知
+	admin := dialWS(t, server, loginAs(t, server, "boss", models.RoleManager))
+	sendWS(t, admin, wsRequest{Action: "subscribe", Topic: adminTopic})
+	expectWS(t, admin, "subscribed", adminTopic)
+}
+
+func TestWebSocketSubscriptionLimit(t *testing.T) {
+	server := newTestServer(t)
+	conn := dialWS(t, server, nil)
+	var topics []string
+	for range wsMaxSubscriptions + 1 {
+		topics = append(topics, "order:"+createTestOrder(t, server, "Eve").ID)
+	}
+
+	for _, topic := range topics[:wsMaxSubscriptions] {
+		sendWS(t, conn, wsRequest{Action: "subscribe", Topic: topic})
+		expectWS(t, conn, "subscribed", topic)
+	}
+	// 重複訂閱不佔名額
+	sendWS(t, conn, wsRequest{Action: "subscribe", Topic: topics[0]})
+	expectWS(t, conn, "subscribed", topics[0])
+
+	last := topics[wsMaxSubscriptions]
+	sendWS(t, conn, wsRequest{Action: "subscribe", Topic: last})
+	expectWS(t, conn, "error", last)
+
+	// 取消一個之後就能再訂閱
+	sendWS(t, conn, wsRequest{Action: "unsubscribe", Topic: topics[0]})
+	expectWS(t, conn, "unsubscribed", topics[0])
+	sendWS(t, conn, wsRequest{Action: "subscribe", Topic: last})
+	expectWS(t, conn, "subscribed", last)
+}
+
+// 重新訂閱且沒有帶 lastEventId 時，從 ack 的位置開始補送
+func TestWebSocketReplayFromAck(t *testing.T) {
+	server := newTestServer(t)
+	topic := "order:" + createTestOrder(t, server, "Finn").ID
+	conn := dialWS(t, server, nil)
+	publish := func(data string) {
+		t.Helper()
+		if err := server.broker.Publish(context.Background(), topic, Event{Type: EventOrderStatusChanged, Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sendWS(t, conn, wsRequest{Action: "subscribe", Topic: topic})
+	expectWS(t, conn, "subscribed", topic)
+	publish(`{"status":"製作中"}`)
+	publish(`{"status":"烘烤中"}`)
+	for want := uint64(1); want <= 2; want++ {
+		if msg := expectWS(t, conn, "event", topic); msg.ID != want || msg.Event != EventOrderStatusChanged {
+			t.Fatalf("收到的事件 = %+v，預期 ID %d", msg, want)
+		}
+	}
+
+	// 只 ack 第一筆，取消訂閱期間又發布一筆
+	sendWS(t, conn, wsRequest{Action: "ack", Topic: topic, EventID: 1})
+	sendWS(t, conn, wsRequest{Action: "unsubscribe", Topic: topic})
+	expectWS(t, conn, "unsubscribed", topic)
+	publish("外送中")
+
+	sendWS(t, conn, wsRequest{Action: "subscribe", Topic: topic})
+	expectWS(t, conn, "subscribed", topic)
+	for want := uint64(2); want <= 3; want++ {
+		if msg := expectWS(t, conn, "event", topic); msg.ID != want {
+			t.Fatalf("補送的事件 = %+v，預期 ID %d", msg, want)
+		}
+	}
+
+	// 沒有訂閱的 topic 不能 ack
+	sendWS(t, conn, wsRequest{Action: "ack", Topic: "order:other", EventID: 1})
+	expectWS(t, conn, "error", "order:other")
+}
@@ -1,24 +1,156 @@
-import { useEffect, useState } from "react";
+import { useCallback, useEffect, useState } from "react";
+
+// 後端 API : cmd/admin_api.go
+// gin-contrib/sessions，React 呼叫 API 時要帶 cookie。
+// 帶 cookie 的 POST / PATCH / DELETE 要附上 X-CSRF-Token (cmd/csrf.go)，token 從 /api/csrf 取一次就好
+let csrfToken = null;
+
+async function getCSRFToken() {
+  if (!csrfToken) {
+    const res = await fetch("/api/csrf", { credentials: "include" });
+    csrfToken = (await res.json()).token;
+  }
+  return csrfToken;
+}
+
+async function api(path, options = {}) {
+  const headers = { "Content-Type": "application/json" };
+  if (options.method && options.method !== "GET") {
+    headers["X-CSRF-Token"] = await getCSRFToken();
+  }
+  const res = await fetch(path, {
+    credentials: "include",
+    ...options,
+    headers,
+  });
+  if (res.status === 204) return null;
+  const body = await res.json();
+  if (!res.ok) throw new Error(body.error ?? res.statusText);
+  return body;
+}
 
 export default function AdminDashboard() {
-  const [data, setData] = useState(null);
+  const [meta, setMeta] = useState(null); // username / role / permissions / statuses / transitions
+  const [orders, setOrders] = useState([]);
+  const [nextCursor, setNextCursor] = useState("");
+  const [filters, setFilters] = useState({ status: "", phone: "", from: "", to: "" });
+  const [error, setError] = useState("");
+
+  const query = useCallback(
+    (cursor = "") => {
+      const params = new URLSearchParams({ sort: "-createdAt" });
+      Object.entries(filters).forEach(([key, value]) => value && params.set(key, value));
+      if (cursor) params.set("cursor", cursor);
+      return api(`/api/admin/orders?${params}`);
+    },
+    [filters]
+  );
 
   useEffect(() => {
-    // gin-contrib/sessions，React 呼叫 API 時要帶 cookie。
-    fetch("/api/admin/dashboard", { credentials: "include" })
-      .then(res => res.json())
-      .then(setData);
+    api("/api/admin/dashboard").then(setMeta).catch(err => setError(err.message));
   }, []);
 
-  if (!data) return <p>Loading...</p>;
+  useEffect(() => {
+    query()
+      .then(page => {
+        setOrders(page.orders);
+        setNextCursor(page.nextCursor ?? "");
+      })
+      .catch(err => setError(err.message));
+  }, [query]);
+
+  const loadMore = () =>
+    query(nextCursor)
+      .then(page => {
+        setOrders(prev => [...prev, ...page.orders]);
+        setNextCursor(page.nextCursor ?? "");
+      })
+      .catch(err => setError(err.message));
+
+  const updateStatus = (id, status) =>
+    api(`/api/admin/orders/${id}`, { method: "PATCH", body: JSON.stringify({ status }) })
+      .then(order => setOrders(prev => prev.map(o => (o.id === id ? order : o))))
+      .catch(err => setError(err.message));
+
+  const deleteOrder = id => {
+    if (!confirm("Are you sure you want to delete this order?")) return;
+    api(`/api/admin/orders/${id}`, { method: "DELETE" })
+      .then(() => setOrders(prev => prev.filter(o => o.id !== id)))
+      .catch(err => setError(err.message));
+  };
+
+  if (!meta) return <p>{error || "Loading..."}</p>;
+
+  const setFilter = key => e => setFilters(prev => ({ ...prev, [key]: e.target.value }));
 
   return (
     <div>
-      <p>Welcome, {data.username}</p>
-      <p>Status: {data.status}</p>
-      <ul>
-        {data.orders.map((o, i) => <li key={i}>{o}</li>)}
-      </ul>
+      <p>Welcome, {meta.username}</p>
+      {error && <p style={{ color: "red" }}>{error}</p>}
+      <div>
+        <select value={filters.status} onChange={setFilter("status")}>
+          <option value="">全部狀態</option>
+          {meta.statuses.map(s => (
+            <option key={s} value={s}>
+              {s}
+            </option>
+          ))}
+        </select>
+        <input placeholder="聯絡方式" value={filters.phone} onChange={setFilter("phone")} />
+        <input type="date" value={filters.from} onChange={setFilter("from")} />
+        <input type="date" value={filters.to} onChange={setFilter("to")} />
+      </div>
+      <table>
+        <thead>
+          <tr>
+            <th>訂單編號</th>
+            <th>狀態</th>
+            <th>遊戲暱稱</th>
+            <th>聯絡方式</th>
+            <th>伺服器</th>
+            <th>道具名稱</th>
+            <th>切換製作進度</th>
+          </tr>
+        </thead>
+        <tbody>
+          {orders.map(order => (
+            <tr key={order.id}>
+              <td>
+                <a href={`/customer/${order.id}`}>{order.id}</a>
+              </td>
+              <td>{order.status}</td>
+              <td>{order.customerName}</td>
+              <td>{order.phone}</td>
+              <td>{order.address}</td>
+              <td>
+                {order.items.map(item => (
+                  <div key={item.id} title={item.instructions}>
+                    {item.size} {item.pizza}
+                  </div>
+                ))}
+              </td>
+              <td>
+                {meta.transitions[order.status]?.length > 0 && (
+                  <select value="" onChange={e => updateStatus(order.id, e.target.value)}>
+                    <option value="" disabled>
+                      {order.status}
+                    </option>
+                    {meta.transitions[order.status].map(s => (
+                      <option key={s} value={s}>
+                        {s}
+                      </option>
+                    ))}
+                  </select>
+                )}
+                {meta.permissions.includes("order:delete") && (
+                  <button onClick={() => deleteOrder(order.id)}>刪除</button>
+                )}
+              </td>
+            </tr>
+          ))}
+        </tbody>
+      </table>
+      {nextCursor && <button onClick={loadMore}>載入更多</button>}
     </div>
   );
 }
@@ -0,0 +1,208 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+API token (personal access token)，給 POS 串接腳本等沒有瀏覽器 session 的程式呼叫 /api/admin:
+  - 格式 pzt_<43 字元>，只在建立時顯示一次，資料庫只存 SHA-256 (token 本身是 32 bytes 亂數，不需要 bcrypt)
+  - 每個 token 屬於一個使用者，並限定 Scopes (權限)；實際可用的權限 = 使用者角色的權限 ∩ Scopes，
+    角色被降級後 token 的權限也會跟著縮小
+  - 一定要有到期時間，帳號停用後 token 也一併失效
+*/
+
+const (
+	APITokenPrefix = "pzt_"
+	// 前綴加上幾個字元，列表上用來辨識是哪一個 token
+	apiTokenHintLength = len(APITokenPrefix) + 6
+	APITokenMaxDays    = 365
+	// LastUsedAt 最多每分鐘寫入一次，避免每個 API 請求都更新資料庫
+	apiTokenTouchInterval = time.Minute
+)
+
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"userId"`
+	User       User       `json:"-"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Hint       string     `gorm:"size:20;not null" json:"hint"` // 例如 pzt_Ab12Cd
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"size:500;not null" json:"-"` // 以逗號分隔的 Permission
+	ExpiresAt  time.Time  `gorm:"not null" json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+var (
+	ErrAPITokenNotFound = errors.New("API token 不存在")
+	ErrAPITokenInvalid  = errors.New("API token 無效、已過期或已撤銷")
+	ErrAPITokenRevoked  = errors.New("API token 已經撤銷")
+	ErrAPITokenNoScope  = errors.New("至少需要選擇一項權限")
+	ErrAPITokenExpiry   = fmt.Errorf("有效天數必須介於 1 到 %d 天", APITokenMaxDays)
+	// 只能把自己角色擁有的權限授權給 token
+	ErrAPITokenScope = errors.New("不能授權角色沒有的權限")
+)
+
+// token 的權限清單，給 JSON 與模板顯示
+func (t *APIToken) ScopeList() []Permission {
+	if t.Scopes == "" {
+		return nil
+	}
+	parts := strings.Split(t.Scopes, ",")
+	scopes := make([]Permission, len(parts))
+	for i, p := range parts {
+		scopes[i] = Permission(p)
+	}
+	return scopes
+}
+
+func (t *APIToken) HasScope(p Permission) bool {
+	return slices.Contains(t.ScopeList(), p)
+}
+
+// 還能不能使用 (沒有撤銷也還沒到期)
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+func generateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return APITokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken 建立 token，回傳的明文只有這一次拿得到
+func (u *UserModel) CreateAPIToken(userID uint, name string, scopes []Permission, days int) (string, *APIToken, error) {
+	if days < 1 || days > APITokenMaxDays {
+		return "", nil, ErrAPITokenExpiry
+	}
+	if len(scopes) == 0 {
+		return "", nil, ErrAPITokenNoScope
+	}
+	user, err := findUser(u.DB, userID)
+	if err != nil {
+		return "", nil, err
+	}
+	plain, token, err := newAPIToken(user, name, scopes, u.now().AddDate(0, 0, days))
+	if err != nil {
+		return "", nil, err
+	}
+	if err := u.DB.Create(token).Error; err != nil {
+		return "", nil, err
+	}
+	return plain, token, nil
+}
+
+// 檢查帳號與權限後產生 token 與明文，還沒寫入資料庫 (MemoryStore 共用)
+func newAPIToken(user *User, name string, scopes []Permission, expiresAt time.Time) (string, *APIToken, error) {
+	if user.Disabled {
+		return "", nil, ErrUserDisabled
+	}
+	for _, p := range scopes {
+		if !user.Role.Can(p) {
+			return "", nil, fmt.Errorf("%w: %q", ErrAPITokenScope, p)
+		}
+	}
+	// 依 RolePermissions 的順序存，重複的只留一個
+	var granted []string
+	for _, p := range user.Role.Permissions() {
+		if slices.Contains(scopes, p) {
+			granted = append(granted, string(p))
+		}
+	}
+
+	plain, err := generateAPIToken()
+	if err != nil {
+		return "", nil, err
+	}
+	return plain, &APIToken{
+		UserID:    user.ID,
+		Name:      name,
+		Hint:      plain[:apiTokenHintLength],
+		TokenHash: hashAPIToken(plain),
+		Scopes:    strings.Join(granted, ","),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// AuthenticateAPIToken 驗證 Authorization: Bearer 帶來的 token，回傳 token 與擁有者
+// 找不到、過期、撤銷一律回傳 ErrAPITokenInvalid，不透露是哪一種；帳號停用回傳 ErrUserDisabled
+func (u *UserModel) AuthenticateAPIToken(plain string) (*APIToken, *User, error) {
+	if !strings.HasPrefix(plain, APITokenPrefix) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	var token APIToken
+	err := u.DB.Preload("User").Where("token_hash = ?", hashAPIToken(plain)).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrAPITokenInvalid
+		}
+		return nil, nil, err
+	}
+	now := u.now()
+	if !token.Active(now) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	if token.User.Disabled {
+		return nil, nil, ErrUserDisabled
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+		if err := u.DB.Model(&token).Update("last_used_at", now).Error; err != nil {
+			return nil, nil, err
+		}
+		token.LastUsedAt = &now
+	}
+	user := token.User
+	return &token, &user, nil
+}
+
+// 列出 token，userID 為 0 時列出所有人的 (帳號管理者使用)，新的在前面
+func (u *UserModel) ListAPITokens(userID uint) ([]APIToken, error) {
+	query := u.DB.Preload("User").Order("id DESC")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	var tokens []APIToken
+	err := query.Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokeAPIToken 撤銷 token，保留資料列讓列表還看得到使用紀錄
+// ownerID 不為 0 時只能撤銷該使用者自己的 token
+func (u *UserModel) RevokeAPIToken(id, ownerID uint) error {
+	var token APIToken
+	query := u.DB.Where("id = ?", id)
+	if ownerID != 0 {
+		query = query.Where("user_id = ?", ownerID)
+	}
+	if err := query.First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPITokenNotFound
+		}
+		return err
+	}
+	if token.RevokedAt != nil {
+		return ErrAPITokenRevoked
+	}
+	return u.DB.Model(&token).Update("revoked_at", u.now()).Error
+}
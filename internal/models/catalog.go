@@ -0,0 +1,392 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 商品 (種類) 與尺寸共用的欄位
+// Active => 下架的品項不會出現在 order.tmpl，也不能再被下單，但舊訂單仍保留原本的名稱
+// SortOrder => 數字越小越前面
+type CatalogEntry struct {
+	Name        string `gorm:"uniqueIndex;size:100;not null" json:"name"`
+	Description string `gorm:"size:500" json:"description"`
+	Active      bool   `gorm:"not null" json:"active"`
+	SortOrder   int    `gorm:"not null" json:"sortOrder"`
+}
+
+// 商品種類，對應訂單明細的 OrderItem.Pizza
+type Product struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+	CatalogEntry
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// 商品尺寸，對應訂單明細的 OrderItem.Size
+type ProductSize struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+	CatalogEntry
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// 每個商品 × 尺寸的價格，以最小貨幣單位 (例如「分」) 的整數儲存，避免浮點數誤差
+// 沒有設定價格的組合不能被下單
+type ProductPrice struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ProductID     uint      `gorm:"uniqueIndex:idx_product_prices_product_size;not null" json:"productId"`
+	ProductSizeID uint      `gorm:"uniqueIndex:idx_product_prices_product_size;not null" json:"productSizeId"`
+	Price         int64     `gorm:"not null" json:"price"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+var (
+	ErrCatalogNotFound  = errors.New("品項不存在")
+	ErrCatalogDuplicate = errors.New("品項名稱已存在")
+	ErrPriceNotSet      = errors.New("此品項尚未設定價格")
+	ErrInvalidPrice     = errors.New("價格不能是負數")
+)
+
+// 線上菜單快取多久，過期後重新讀取資料庫
+// 同一台機器上的修改會立刻 Invalidate，TTL 是讓多台機器之間的資料最終一致
+const catalogCacheTTL = 30 * time.Second
+
+type CatalogModel struct {
+	DB    *gorm.DB
+	cache *catalogCache
+}
+
+// 目前上架中的品項，驗證器每次下單都會讀取，所以放在記憶體中
+type catalogCache struct {
+	mu       sync.RWMutex
+	loadedAt time.Time
+	products []Product
+	sizes    []ProductSize
+	prices   map[PriceKey]int64 // 只包含上架中的商品 / 尺寸
+}
+
+// 用名稱查價格，訂單明細存的是名稱而不是ID
+type PriceKey struct {
+	Product string
+	Size    string
+}
+
+func NewCatalogModel(db *gorm.DB) CatalogModel {
+	return CatalogModel{DB: db, cache: &catalogCache{}}
+}
+
+// 第一次啟動時，資料表是空的 => 用原本寫死的 PizzaTypes / PizzaSizes 當作預設菜單
+func (c *CatalogModel) SeedDefaults() error {
+	return c.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Product{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			for i, name := range PizzaTypes {
+				if err := tx.Create(&Product{CatalogEntry: CatalogEntry{Name: name, Active: true, SortOrder: i}}).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Model(&ProductSize{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			for i, name := range PizzaSizes {
+				if err := tx.Create(&ProductSize{CatalogEntry: CatalogEntry{Name: name, Active: true, SortOrder: i}}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// 清除快取，下一次讀取時重新查詢資料庫
+func (c *CatalogModel) Invalidate() {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	c.cache.loadedAt = time.Time{}
+}
+
+// 讀取上架中的品項與價格，快取未過期時直接回傳
+func (c *CatalogModel) active() (*catalogCache, error) {
+	c.cache.mu.RLock()
+	if time.Since(c.cache.loadedAt) < catalogCacheTTL {
+		snapshot := &catalogCache{products: c.cache.products, sizes: c.cache.sizes, prices: c.cache.prices}
+		c.cache.mu.RUnlock()
+		return snapshot, nil
+	}
+	c.cache.mu.RUnlock()
+
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+
+	var products []Product
+	if err := c.DB.Where("active = ?", true).Order("sort_order, id").Find(&products).Error; err != nil {
+		return nil, err
+	}
+	var sizes []ProductSize
+	if err := c.DB.Where("active = ?", true).Order("sort_order, id").Find(&sizes).Error; err != nil {
+		return nil, err
+	}
+	var rows []ProductPrice
+	if err := c.DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	productNames := make(map[uint]string, len(products))
+	for _, p := range products {
+		productNames[p.ID] = p.Name
+	}
+	sizeNames := make(map[uint]string, len(sizes))
+	for _, s := range sizes {
+		sizeNames[s.ID] = s.Name
+	}
+	prices := make(map[PriceKey]int64, len(rows))
+	for _, row := range rows {
+		product, ok1 := productNames[row.ProductID]
+		size, ok2 := sizeNames[row.ProductSizeID]
+		if ok1 && ok2 {
+			prices[PriceKey{Product: product, Size: size}] = row.Price
+		}
+	}
+
+	c.cache.products, c.cache.sizes, c.cache.prices, c.cache.loadedAt = products, sizes, prices, time.Now()
+	return &catalogCache{products: products, sizes: sizes, prices: prices}, nil
+}
+
+// 上架中的商品，order.tmpl 下拉選單使用
+func (c *CatalogModel) ActiveProducts() ([]Product, error) {
+	snapshot, err := c.active()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.products, nil
+}
+
+// 上架中的尺寸，order.tmpl 下拉選單使用
+func (c *CatalogModel) ActiveSizes() ([]ProductSize, error) {
+	snapshot, err := c.active()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.sizes, nil
+}
+
+// 上架中品項的價格表，order.tmpl 用來即時顯示小計
+func (c *CatalogModel) ActivePrices() (map[PriceKey]int64, error) {
+	snapshot, err := c.active()
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.prices, nil
+}
+
+// PriceOrder 把目前的價格寫進每一筆訂單明細，並計算訂單小計 / 稅金 / 總額
+// 價格在建立訂單時複製一份到 OrderItem，之後菜單改價不會影響歷史訂單
+// taxRateBps => 稅率，以萬分之一為單位 (500 = 5%)
+func (c *CatalogModel) PriceOrder(order *Order, taxRateBps int64) error {
+	prices, err := c.ActivePrices()
+	if err != nil {
+		return err
+	}
+	return priceOrder(order, taxRateBps, prices)
+}
+
+// CatalogModel 與 MemoryStore 共用的計價邏輯，prices 為上架中品項的價格表
+func priceOrder(order *Order, taxRateBps int64, prices map[PriceKey]int64) error {
+	for i := range order.Items {
+		item := &order.Items[i]
+		price, err := priceOf(prices, item.Pizza, item.Size)
+		if err != nil {
+			return err
+		}
+		item.UnitPrice = price
+		item.LineTotal = price * int64(item.Quantity)
+	}
+	order.ComputeTotals(taxRateBps)
+	return nil
+}
+
+func priceOf(prices map[PriceKey]int64, product, size string) (int64, error) {
+	price, ok := prices[PriceKey{Product: product, Size: size}]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s %s", ErrPriceNotSet, size, product)
+	}
+	return price, nil
+}
+
+// valid_pizza_type 驗證器使用
+func (c *CatalogModel) IsActiveProduct(name string) (bool, error) {
+	products, err := c.ActiveProducts()
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(products, func(p Product) bool { return p.Name == name }), nil
+}
+
+// valid_pizza_size 驗證器使用
+func (c *CatalogModel) IsActiveSize(name string) (bool, error) {
+	sizes, err := c.ActiveSizes()
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(sizes, func(s ProductSize) bool { return s.Name == name }), nil
+}
+
+// 後台列表 => 包含下架的品項
+func (c *CatalogModel) ListProducts() ([]Product, error) {
+	var products []Product
+	err := c.DB.Order("sort_order, id").Find(&products).Error
+	return products, err
+}
+
+func (c *CatalogModel) ListSizes() ([]ProductSize, error) {
+	var sizes []ProductSize
+	err := c.DB.Order("sort_order, id").Find(&sizes).Error
+	return sizes, err
+}
+
+func (c *CatalogModel) CreateProduct(entry CatalogEntry) (*Product, error) {
+	product := &Product{CatalogEntry: entry}
+	return product, c.create(product)
+}
+
+func (c *CatalogModel) UpdateProduct(id uint, entry CatalogEntry) error {
+	return c.update(&Product{}, id, entry)
+}
+
+func (c *CatalogModel) DeleteProduct(id uint) error {
+	return c.delete(&Product{}, id, "product_id")
+}
+
+func (c *CatalogModel) CreateSize(entry CatalogEntry) (*ProductSize, error) {
+	size := &ProductSize{CatalogEntry: entry}
+	return size, c.create(size)
+}
+
+func (c *CatalogModel) UpdateSize(id uint, entry CatalogEntry) error {
+	return c.update(&ProductSize{}, id, entry)
+}
+
+func (c *CatalogModel) DeleteSize(id uint) error {
+	return c.delete(&ProductSize{}, id, "product_size_id")
+}
+
+// 後台價格表 => 所有商品 × 尺寸 (包含下架) 的價格
+func (c *CatalogModel) ListPrices() ([]ProductPrice, error) {
+	var prices []ProductPrice
+	err := c.DB.Find(&prices).Error
+	return prices, err
+}
+
+// PriceUpdate => 價格表的一格，Price 為 nil 代表取消此組合的價格 (不能下單)
+type PriceUpdate struct {
+	ProductID     uint
+	ProductSizeID uint
+	Price         *int64
+}
+
+// SetPrice 設定單一組合的價格
+func (c *CatalogModel) SetPrice(productID, sizeID uint, price *int64) error {
+	return c.SetPrices([]PriceUpdate{{ProductID: productID, ProductSizeID: sizeID, Price: price}})
+}
+
+// SetPrices 在同一個 transaction 裡儲存多格價格，任何一格不合法或寫入失敗時全部不生效
+func (c *CatalogModel) SetPrices(updates []PriceUpdate) error {
+	if err := validatePriceUpdates(updates); err != nil {
+		return err
+	}
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		for _, u := range updates {
+			if err := tx.Where("product_id = ? AND product_size_id = ?", u.ProductID, u.ProductSizeID).Delete(&ProductPrice{}).Error; err != nil {
+				return err
+			}
+			if u.Price == nil {
+				continue
+			}
+			if err := tx.Create(&ProductPrice{ProductID: u.ProductID, ProductSizeID: u.ProductSizeID, Price: *u.Price}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.Invalidate()
+	return nil
+}
+
+func validatePriceUpdates(updates []PriceUpdate) error {
+	for _, u := range updates {
+		if u.Price != nil && *u.Price < 0 {
+			return ErrInvalidPrice
+		}
+	}
+	return nil
+}
+
+// 以下為商品 / 尺寸共用的寫入邏輯，每次寫入後都要 Invalidate 快取
+
+func (c *CatalogModel) create(entry any) error {
+	if err := c.DB.Create(entry).Error; err != nil {
+		return translateCatalogError(err)
+	}
+	c.Invalidate()
+	return nil
+}
+
+func (c *CatalogModel) update(model any, id uint, entry CatalogEntry) error {
+	// 用 map 更新，Active=false / SortOrder=0 這種零值才會被寫入
+	result := c.DB.Model(model).Where("id = ?", id).Updates(map[string]any{
+		"name":        entry.Name,
+		"description": entry.Description,
+		"active":      entry.Active,
+		"sort_order":  entry.SortOrder,
+	})
+	if result.Error != nil {
+		return translateCatalogError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrCatalogNotFound
+	}
+	c.Invalidate()
+	return nil
+}
+
+// 舊訂單存的是品項名稱與當時的價格，直接刪除不會影響歷史訂單
+// priceColumn => 一併刪除此品項的價格 (product_id / product_size_id)
+func (c *CatalogModel) delete(model any, id uint, priceColumn string) error {
+	err := c.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", id).Delete(model)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCatalogNotFound
+		}
+		return tx.Where(priceColumn+" = ?", id).Delete(&ProductPrice{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	c.Invalidate()
+	return nil
+}
+
+func translateCatalogError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrCatalogDuplicate
+	}
+	return err
+}
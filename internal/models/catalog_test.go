@@ -0,0 +1,207 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func productNames(products []Product) []string {
+	names := make([]string, len(products))
+	for i, p := range products {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func setTestPrice(t *testing.T, catalog CatalogStore, productID, sizeID uint, price *int64) {
+	t.Helper()
+	if err := catalog.SetPrices([]PriceUpdate{{ProductID: productID, ProductSizeID: sizeID, Price: price}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 全新的菜單: 有預設的商品與尺寸，沒有價格
+func TestCatalogDefaults(t *testing.T) {
+	forEachCatalogStore(t, func(t *testing.T, catalog CatalogStore) {
+		products, err := catalog.ActiveProducts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := productNames(products); !slices.Equal(got, PizzaTypes) {
+			t.Fatalf("預設商品 = %v，預期 %v", got, PizzaTypes)
+		}
+		sizes, err := catalog.ActiveSizes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sizes) != len(PizzaSizes) || sizes[0].Name != PizzaSizes[0] {
+			t.Fatalf("預設尺寸 = %+v", sizes)
+		}
+		if prices, _ := catalog.ActivePrices(); len(prices) != 0 {
+			t.Fatalf("預設不應該有價格: %v", prices)
+		}
+		if ok, _ := catalog.IsActiveProduct(PizzaTypes[0]); !ok {
+			t.Fatalf("%s 應該是上架中的商品", PizzaTypes[0])
+		}
+		if ok, _ := catalog.IsActiveSize("Huge"); ok {
+			t.Fatal("不存在的尺寸")
+		}
+	})
+}
+
+func TestCatalogWrites(t *testing.T) {
+	forEachCatalogStore(t, func(t *testing.T, catalog CatalogStore) {
+		first, err := catalog.CreateProduct(CatalogEntry{Name: "Hawaiian", Active: true, SortOrder: -1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.ID == 0 {
+			t.Fatal("建立後應該有 ID")
+		}
+		if _, err := catalog.CreateProduct(CatalogEntry{Name: "Hawaiian"}); !errors.Is(err, ErrCatalogDuplicate) {
+			t.Fatalf("名稱重複: %v", err)
+		}
+		hidden, err := catalog.CreateProduct(CatalogEntry{Name: "Seasonal", Active: false})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 後台列表包含下架的品項，依 SortOrder、ID 排序；前台只列出上架的
+		products, _ := catalog.ListProducts()
+		if got := productNames(products); got[0] != "Hawaiian" || !slices.Contains(got, "Seasonal") {
+			t.Fatalf("後台商品列表 = %v", got)
+		}
+		if ok, _ := catalog.IsActiveProduct("Seasonal"); ok {
+			t.Fatal("下架的商品不應該可以下單")
+		}
+
+		if err := catalog.UpdateProduct(hidden.ID, CatalogEntry{Name: "Hawaiian"}); !errors.Is(err, ErrCatalogDuplicate) {
+			t.Fatalf("改成重複的名稱: %v", err)
+		}
+		if err := catalog.UpdateProduct(9999, CatalogEntry{Name: "Nothing"}); !errors.Is(err, ErrCatalogNotFound) {
+			t.Fatalf("更新不存在的商品: %v", err)
+		}
+		if err := catalog.UpdateProduct(hidden.ID, CatalogEntry{Name: "Seasonal", Active: true, SortOrder: 5}); err != nil {
+			t.Fatal(err)
+		}
+		if ok, _ := catalog.IsActiveProduct("Seasonal"); !ok {
+			t.Fatal("上架後應該可以下單")
+		}
+
+		size, err := catalog.CreateSize(CatalogEntry{Name: "Family", Active: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := catalog.CreateSize(CatalogEntry{Name: "Family"}); !errors.Is(err, ErrCatalogDuplicate) {
+			t.Fatalf("尺寸名稱重複: %v", err)
+		}
+		if err := catalog.UpdateSize(9999, CatalogEntry{Name: "Nothing"}); !errors.Is(err, ErrCatalogNotFound) {
+			t.Fatalf("更新不存在的尺寸: %v", err)
+		}
+
+		// 刪除品項時價格一併刪除
+		price := int64(45000)
+		for _, id := range []uint{first.ID, hidden.ID} {
+			setTestPrice(t, catalog, id, size.ID, &price)
+		}
+		if err := catalog.DeleteProduct(hidden.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := catalog.DeleteProduct(hidden.ID); !errors.Is(err, ErrCatalogNotFound) {
+			t.Fatalf("刪除兩次: %v", err)
+		}
+		prices, _ := catalog.ListPrices()
+		if len(prices) != 1 || prices[0].ProductID != first.ID {
+			t.Fatalf("刪除商品後的價格 = %+v", prices)
+		}
+		if err := catalog.DeleteSize(size.ID); err != nil {
+			t.Fatal(err)
+		}
+		if prices, _ := catalog.ListPrices(); len(prices) != 0 {
+			t.Fatalf("刪除尺寸後的價格 = %+v", prices)
+		}
+		if err := catalog.DeleteSize(size.ID); !errors.Is(err, ErrCatalogNotFound) {
+			t.Fatalf("刪除不存在的尺寸: %v", err)
+		}
+	})
+}
+
+func TestCatalogPriceOrder(t *testing.T) {
+	forEachCatalogStore(t, func(t *testing.T, catalog CatalogStore) {
+		products, _ := catalog.ActiveProducts()
+		sizes, _ := catalog.ActiveSizes()
+		product, size := products[0], sizes[0]
+
+		order := &Order{Items: []OrderItem{{Pizza: product.Name, Size: size.Name, Quantity: 2}}}
+		if err := catalog.PriceOrder(order, 500); !errors.Is(err, ErrPriceNotSet) {
+			t.Fatalf("沒有價格的品項: %v", err)
+		}
+
+		// 重新設定會覆蓋原本的價格
+		for _, amount := range []int64{10000, 30000} {
+			setTestPrice(t, catalog, product.ID, size.ID, &amount)
+		}
+		if prices, _ := catalog.ListPrices(); len(prices) != 1 || prices[0].Price != 30000 {
+			t.Fatalf("價格表 = %+v", prices)
+		}
+		if err := catalog.PriceOrder(order, 500); err != nil {
+			t.Fatal(err)
+		}
+		if item := order.Items[0]; item.UnitPrice != 30000 || item.LineTotal != 60000 {
+			t.Fatalf("明細 = %+v", item)
+		}
+		if order.Subtotal != 60000 || order.Tax != 3000 || order.Total != 63000 {
+			t.Fatalf("小計 %d / 稅金 %d / 總額 %d", order.Subtotal, order.Tax, order.Total)
+		}
+
+		// 下架的商品即使有價格也不能下單
+		if err := catalog.UpdateProduct(product.ID, CatalogEntry{Name: product.Name, Active: false}); err != nil {
+			t.Fatal(err)
+		}
+		if err := catalog.PriceOrder(order, 500); !errors.Is(err, ErrPriceNotSet) {
+			t.Fatalf("下架的商品: %v", err)
+		}
+		if err := catalog.UpdateProduct(product.ID, product.CatalogEntry); err != nil {
+			t.Fatal(err)
+		}
+
+		// 取消價格
+		setTestPrice(t, catalog, product.ID, size.ID, nil)
+		if prices, _ := catalog.ActivePrices(); len(prices) != 0 {
+			t.Fatalf("取消後的價格 = %v", prices)
+		}
+	})
+}
+
+// 價格表一次儲存，有一格不合法時其他格也不會寫入
+func TestCatalogSetPricesIsAllOrNothing(t *testing.T) {
+	forEachCatalogStore(t, func(t *testing.T, catalog CatalogStore) {
+		products, _ := catalog.ActiveProducts()
+		sizes, _ := catalog.ActiveSizes()
+		valid, negative := int64(30000), int64(-1)
+
+		err := catalog.SetPrices([]PriceUpdate{
+			{ProductID: products[0].ID, ProductSizeID: sizes[0].ID, Price: &valid},
+			{ProductID: products[1].ID, ProductSizeID: sizes[0].ID, Price: &negative},
+		})
+		if !errors.Is(err, ErrInvalidPrice) {
+			t.Fatalf("負數價格: %v", err)
+		}
+		if prices, _ := catalog.ListPrices(); len(prices) != 0 {
+			t.Fatalf("有一格錯誤時不應該寫入任何價格: %+v", prices)
+		}
+
+		err = catalog.SetPrices([]PriceUpdate{
+			{ProductID: products[0].ID, ProductSizeID: sizes[0].ID, Price: &valid},
+			{ProductID: products[1].ID, ProductSizeID: sizes[0].ID, Price: &valid},
+			{ProductID: products[1].ID, ProductSizeID: sizes[1].ID, Price: nil},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prices, _ := catalog.ActivePrices(); len(prices) != 2 {
+			t.Fatalf("價格表 = %v", prices)
+		}
+	})
+}
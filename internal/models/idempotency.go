@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+建立訂單的冪等處理 (Idempotency-Key):
+  - 顧客連點送出、手機 App 逾時重送時，同一個 key 只會建立一筆訂單，重送的請求拿到原本那一筆
+  - key 與訂單寫在同一個 transaction，兩個請求同時送達時只有一個能寫入 key，另一個回傳先寫入的那一筆
+  - 同一個 key 但請求內容 (RequestHash) 不同，代表呼叫端重複使用了 key，回傳 ErrIdempotencyKeyReused
+  - 超過保留時間的 key 視為不存在，由背景工作刪除
+*/
+
+type IdempotencyKey struct {
+	// 依來源加上前綴 (form: / api:)，表單與 API 的 key 不會互相衝突
+	// 欄位不叫 key，避免跟 MySQL 的保留字衝突
+	Key         string `gorm:"column:idempotency_key;primaryKey;size:300"`
+	RequestHash string `gorm:"size:64;not null"`
+	OrderID     string `gorm:"not null"`
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index;not null"`
+}
+
+var (
+	ErrIdempotencyKeyReused = errors.New("Idempotency-Key 已經用在內容不同的請求")
+	ErrIdempotentOrderGone  = errors.New("Idempotency-Key 建立的訂單已被刪除")
+)
+
+// CreateOrderIdempotent 用 key 建立訂單，replayed 為 true 代表這個 key 先前已經建立過訂單，回傳的是原本那一筆
+func (o *OrderModel) CreateOrderIdempotent(key, requestHash string, order *Order, ttl time.Duration) (*Order, bool, error) {
+	existing, err := o.findIdempotentOrder(key, requestHash)
+	if err != nil || existing != nil {
+		return existing, existing != nil, err
+	}
+
+	now := time.Now()
+	err = o.DB.Transaction(func(tx *gorm.DB) error {
+		// 過期但還沒被背景工作刪掉的 key 視為不存在
+		if err := tx.Where("idempotency_key = ? AND expires_at <= ?", key, now).Delete(&IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+		if len(order.StatusEvents) == 0 {
+			order.StatusEvents = []OrderStatusEvent{{ToStatus: order.Status}}
+		}
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		return tx.Create(&IdempotencyKey{
+			Key:         key,
+			RequestHash: requestHash,
+			OrderID:     order.ID,
+			ExpiresAt:   now.Add(ttl),
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// 同時送達的另一個請求先寫入了 key，這筆訂單已經跟著 rollback，改回傳先寫入的那一筆
+		existing, err := o.findIdempotentOrder(key, requestHash)
+		if err == nil && existing == nil {
+			err = gorm.ErrDuplicatedKey
+		}
+		return existing, existing != nil, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return order, false, nil
+}
+
+// 找出 key 先前建立的訂單，沒有 (或已過期) 時回傳 nil
+func (o *OrderModel) findIdempotentOrder(key, requestHash string) (*Order, error) {
+	var record IdempotencyKey
+	err := o.DB.Where("idempotency_key = ? AND expires_at > ?", key, time.Now()).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	order, err := o.FindOrder(record.OrderID)
+	// 訂單已經移到垃圾桶 (或被封存)，不重新建立一筆，避免同一個 key 產生兩筆訂單
+	if errors.Is(err, ErrOrderNotFound) {
+		return nil, ErrIdempotentOrderGone
+	}
+	return order, err
+}
+
+// PurgeExpiredIdempotencyKeys 刪除超過保留時間的 key，由背景工作定期呼叫
+func (o *OrderModel) PurgeExpiredIdempotencyKeys() (int64, error) {
+	result := o.DB.Where("expires_at <= ?", time.Now()).Delete(&IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,370 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 登入失敗的次數限制，同時以帳號與來源 IP 計算:
+// 帳號 => 防止針對單一帳號猜密碼；IP => 防止同一個來源輪流嘗試很多帳號
+// 達到門檻後鎖定，之後每多失敗一次鎖定時間加倍 (1, 2, 4, 8 ... 分鐘)，最長 loginMaxLockout
+// 最後一次失敗超過 loginFailureWindow 之後，失敗次數重新計算
+const (
+	loginMaxUserFailures = 5
+	loginMaxIPFailures   = 20
+	loginBaseLockout     = time.Minute
+	loginMaxLockout      = 30 * time.Minute
+	loginFailureWindow   = time.Hour
+)
+
+// 登入紀錄的結果
+const (
+	LoginSuccess       = "success"
+	LoginUnknownUser   = "unknown_user"
+	LoginWrongPassword = "wrong_password"
+	LoginDisabled      = "disabled"
+	LoginLocked        = "locked"
+	LoginTOTPPending   = "totp_pending" // 密碼正確，等待兩步驟驗證
+	LoginTOTPFailed    = "totp_failed"
+)
+
+// 後台登入紀錄頁顯示用
+var LoginResultLabels = map[string]string{
+	LoginSuccess:       "成功",
+	LoginUnknownUser:   "帳號不存在",
+	LoginWrongPassword: "密碼錯誤",
+	LoginDisabled:      "帳號已停用",
+	LoginLocked:        "鎖定中",
+	LoginTOTPPending:   "等待兩步驟驗證",
+	LoginTOTPFailed:    "驗證碼錯誤",
+}
+
+var (
+	// 帳號不存在與密碼錯誤回傳相同的訊息，避免被用來試探有哪些帳號
+	ErrInvalidCredentials = errors.New("帳號或密碼錯誤")
+	ErrLoginLockNotFound  = errors.New("沒有這筆鎖定紀錄")
+)
+
+// LoginLockedError => 帳號或 IP 失敗次數過多，在 Until 之前不接受登入
+// 不論帳號是否存在都會鎖定，所以也不會洩漏帳號是否存在
+type LoginLockedError struct {
+	Until time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return "登入失敗次數過多，請稍後再試"
+}
+
+// LoginAttempt => 每一次登入嘗試的紀錄，給店主查看可疑的登入
+// Username 為使用者輸入的帳號，不一定存在；UserID 只有帳號存在時才有值
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Username  string    `gorm:"size:50;index;not null" json:"username"`
+	UserID    *uint     `json:"userId,omitempty"`
+	IP        string    `gorm:"size:45;index;not null" json:"ip"`
+	Result    string    `gorm:"size:20;not null" json:"result"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+}
+
+// LoginThrottle => 一個帳號或 IP 的連續失敗次數，存在資料庫讓多台機器共用、重新啟動也不會歸零
+// Key 為 user:<帳號> 或 ip:<位址>；key 在 MySQL 是保留字，所以欄位名稱改為 throttle_key
+type LoginThrottle struct {
+	Key           string     `gorm:"primaryKey;size:80;column:throttle_key" json:"key"`
+	Failures      int        `gorm:"not null" json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty"`
+}
+
+// LoginAttemptQuery => 後台查詢登入紀錄的條件，零值代表不過濾
+type LoginAttemptQuery struct {
+	Username   string
+	IP         string
+	FailedOnly bool
+	Limit      int
+}
+
+func userThrottleKey(username string) string { return "user:" + username }
+func ipThrottleKey(ip string) string         { return "ip:" + ip }
+
+// Login => 有次數限制的登入，成功或失敗都會寫入 LoginAttempt
+// 回傳的錯誤: *LoginLockedError、ErrInvalidCredentials、ErrUserDisabled (密碼正確才會出現) 或資料庫錯誤
+// 回傳的 User 若 TOTPEnabled，呼叫端還要再用 VerifySecondFactor 完成登入
+func (u *UserModel) Login(username, password, ip string) (*User, error) {
+	now := u.now()
+	keys := []string{userThrottleKey(username), ipThrottleKey(ip)}
+
+	until, err := lockedUntil(u.DB, now, keys...)
+	if err != nil {
+		return nil, err
+	}
+	if until != nil {
+		if err := u.recordAttempt(username, nil, ip, LoginLocked); err != nil {
+			return nil, err
+		}
+		return nil, &LoginLockedError{Until: *until}
+	}
+
+	user, result, err := u.authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if result == LoginSuccess && user.TOTPEnabled {
+		result = LoginTOTPPending
+	}
+	var userID *uint
+	if user != nil {
+		userID = &user.ID
+	}
+	if err := u.recordAttempt(username, userID, ip, result); err != nil {
+		return nil, err
+	}
+
+	switch result {
+	case LoginSuccess:
+		// 只清除帳號的失敗次數；IP 的次數不因為登入成功而歸零，
+		// 否則攻擊者可以穿插登入自己的帳號來繞過 IP 限制
+		if err := u.DB.Delete(&LoginThrottle{}, "throttle_key = ?", keys[0]).Error; err != nil {
+			return nil, err
+		}
+		return user, nil
+	case LoginTOTPPending:
+		// 帳號的失敗次數等兩步驟驗證成功才清除，
+		// 否則知道密碼的人可以反覆重新輸入密碼，無限次猜驗證碼
+		return user, nil
+	case LoginDisabled:
+		// 密碼正確但帳號已停用，不算猜錯密碼
+		return nil, ErrUserDisabled
+	default:
+		if err := u.recordFailures(keys, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+}
+
+// VerifySecondFactor => 登入的第二步，code 可以是 TOTP 驗證碼或備用碼
+// 與密碼共用帳號 / IP 的失敗次數與鎖定；回傳的錯誤: *LoginLockedError、ErrInvalidCredentials、ErrInvalidTOTPCode 或資料庫錯誤
+func (u *UserModel) VerifySecondFactor(userID uint, code, ip string) (*User, error) {
+	now := u.now()
+	user, err := findUser(u.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	// 輸入密碼之後才被停用或重設兩步驟驗證，要重新登入
+	if user.Disabled || !user.TOTPEnabled {
+		return nil, ErrInvalidCredentials
+	}
+	keys := []string{userThrottleKey(user.Username), ipThrottleKey(ip)}
+
+	until, err := lockedUntil(u.DB, now, keys...)
+	if err != nil {
+		return nil, err
+	}
+	if until != nil {
+		if err := u.recordAttempt(user.Username, &user.ID, ip, LoginLocked); err != nil {
+			return nil, err
+		}
+		return nil, &LoginLockedError{Until: *until}
+	}
+
+	ok, err := u.checkSecondFactor(user, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err := u.recordAttempt(user.Username, &user.ID, ip, LoginTOTPFailed); err != nil {
+			return nil, err
+		}
+		if err := u.recordFailures(keys, now); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidTOTPCode
+	}
+
+	if err := u.recordAttempt(user.Username, &user.ID, ip, LoginSuccess); err != nil {
+		return nil, err
+	}
+	if err := u.DB.Delete(&LoginThrottle{}, "throttle_key = ?", keys[0]).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// keys 依序為帳號與 IP，各自套用不同的門檻
+func (u *UserModel) recordFailures(keys []string, now time.Time) error {
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		if err := recordFailure(tx, keys[0], loginMaxUserFailures, now); err != nil {
+			return err
+		}
+		return recordFailure(tx, keys[1], loginMaxIPFailures, now)
+	})
+}
+
+// 帳號不存在時也跑一次 bcrypt，讓回應時間跟密碼錯誤差不多，避免用時間差試探帳號
+// 第一次用到時才產生，CLI 等不需要登入的指令不用多花 bcrypt 的時間
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := GenerateHashPassword("pizza-tracker-dummy-password")
+	return hash
+})
+
+// 驗證帳號密碼，回傳 LoginAttempt 的結果；error 只代表資料庫錯誤
+func (u *UserModel) authenticate(username, password string) (*User, string, error) {
+	var user User
+	if err := u.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			CompareHashAndPassword(dummyPasswordHash(), password)
+			return nil, LoginUnknownUser, nil
+		}
+		return nil, "", err
+	}
+	if !CompareHashAndPassword(user.Password, password) {
+		return &user, LoginWrongPassword, nil
+	}
+	if user.Disabled {
+		return &user, LoginDisabled, nil
+	}
+	return &user, LoginSuccess, nil
+}
+
+func (u *UserModel) recordAttempt(username string, userID *uint, ip, result string) error {
+	attempt := LoginAttempt{Username: username, UserID: userID, IP: ip, Result: result}
+	if err := u.DB.Create(&attempt).Error; err != nil {
+		return fmt.Errorf("寫入登入紀錄失敗: %w", err)
+	}
+	return nil
+}
+
+// 回傳 keys 中最晚的解鎖時間，都沒有鎖定時回傳 nil
+func lockedUntil(db *gorm.DB, now time.Time, keys ...string) (*time.Time, error) {
+	var throttles []LoginThrottle
+	if err := db.Where("throttle_key IN ? AND locked_until > ?", keys, now).Find(&throttles).Error; err != nil {
+		return nil, err
+	}
+	var until *time.Time
+	for _, t := range throttles {
+		if until == nil || t.LockedUntil.After(*until) {
+			until = t.LockedUntil
+		}
+	}
+	return until, nil
+}
+
+// 失敗次數用 upsert 在資料庫裡加一，多台機器同時記錄失敗也不會互相覆蓋 (先讀再 Save 會少算)
+// 加一之後這筆資料已經被這個交易鎖住，再依新的次數計算鎖定時間
+// 規則與 addFailure 相同；MySQL 的 ON DUPLICATE KEY UPDATE 由左到右套用，last_failure_at 必須最後更新
+func recordFailure(tx *gorm.DB, key string, threshold int, now time.Time) error {
+	expired := now.Add(-loginFailureWindow)
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "throttle_key"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "failures"}, Value: gorm.Expr(
+				"CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END", expired)},
+			{Column: clause.Column{Name: "locked_until"}, Value: gorm.Expr(
+				"CASE WHEN login_throttles.last_failure_at < ? THEN NULL ELSE login_throttles.locked_until END", expired)},
+			{Column: clause.Column{Name: "last_failure_at"}, Value: now},
+		},
+	}).Create(&LoginThrottle{Key: key, Failures: 1, LastFailureAt: now}).Error
+	if err != nil {
+		return err
+	}
+
+	var t LoginThrottle
+	if err := tx.Where("throttle_key = ?", key).First(&t).Error; err != nil {
+		return err
+	}
+	if t.Failures < threshold {
+		return nil
+	}
+	return tx.Model(&LoginThrottle{}).Where("throttle_key = ?", key).
+		Update("locked_until", now.Add(lockoutDuration(t.Failures-threshold))).Error
+}
+
+// 失敗次數加一，達到 threshold 後依超過的次數計算鎖定時間
+func (t *LoginThrottle) addFailure(threshold int, now time.Time) {
+	if now.Sub(t.LastFailureAt) > loginFailureWindow {
+		t.Failures = 0
+		t.LockedUntil = nil
+	}
+	t.Failures++
+	t.LastFailureAt = now
+	if t.Failures >= threshold {
+		until := now.Add(lockoutDuration(t.Failures - threshold))
+		t.LockedUntil = &until
+	}
+}
+
+// 第 n 次超過門檻的鎖定時間: loginBaseLockout * 2^n，最長 loginMaxLockout
+func lockoutDuration(n int) time.Duration {
+	d := loginBaseLockout
+	for range n {
+		d *= 2
+		if d >= loginMaxLockout {
+			return loginMaxLockout
+		}
+	}
+	return d
+}
+
+// 登入紀錄，由新到舊
+func (u *UserModel) ListLoginAttempts(q LoginAttemptQuery) ([]LoginAttempt, error) {
+	limit := q.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	db := u.DB.Model(&LoginAttempt{})
+	if q.Username != "" {
+		db = db.Where("username = ?", q.Username)
+	}
+	if q.IP != "" {
+		db = db.Where("ip = ?", q.IP)
+	}
+	if q.FailedOnly {
+		db = db.Where("result <> ?", LoginSuccess)
+	}
+	var attempts []LoginAttempt
+	err := db.Order("created_at DESC, id DESC").Limit(limit).Find(&attempts).Error
+	return attempts, err
+}
+
+// PurgeLoginRecords 刪除超過 retention 的登入紀錄，以及已經不會再影響登入的失敗次數
+// (最後一次失敗超過 loginFailureWindow 而且沒有鎖定中)，由背景工作定期呼叫
+func (u *UserModel) PurgeLoginRecords(retention time.Duration) (int64, error) {
+	now := u.now()
+	var purged int64
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("created_at < ?", now.Add(-retention)).Delete(&LoginAttempt{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+		result = tx.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until <= ?)", now.Add(-loginFailureWindow), now).
+			Delete(&LoginThrottle{})
+		purged += result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// 目前鎖定中的帳號 / IP
+func (u *UserModel) ListLoginLocks() ([]LoginThrottle, error) {
+	var locks []LoginThrottle
+	err := u.DB.Where("locked_until > ?", u.now()).Order("locked_until DESC").Find(&locks).Error
+	return locks, err
+}
+
+// 店主手動解除鎖定，同時清除失敗次數
+func (u *UserModel) UnlockLogin(key string) error {
+	result := u.DB.Delete(&LoginThrottle{}, "throttle_key = ?", key)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLoginLockNotFound
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginLockoutAndWindowReset(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *DBModel) {
+		now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		users := &db.User
+		users.Clock = func() time.Time { return now }
+		if _, err := users.CreateUser("bob", "secret123", RoleKitchen); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < loginMaxUserFailures; i++ {
+			if _, err := users.Login("bob", "wrong-password", "10.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("第 %d 次密碼錯誤: %v", i+1, err)
+			}
+		}
+		// 達到門檻後連正確的密碼也不接受
+		var locked *LoginLockedError
+		if _, err := users.Login("bob", "secret123", "10.0.0.1"); !errors.As(err, &locked) {
+			t.Fatalf("達到門檻後應該被鎖定，實際: %v", err)
+		}
+		if want := now.Add(loginBaseLockout); !locked.Until.Equal(want) {
+			t.Fatalf("鎖定到 %v，預期 %v", locked.Until, want)
+		}
+
+		// 最後一次失敗超過 loginFailureWindow，失敗次數重新計算，也解除鎖定
+		now = now.Add(loginFailureWindow + time.Minute)
+		if _, err := users.Login("bob", "wrong-password", "10.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatal(err)
+		}
+		var throttle LoginThrottle
+		if err := db.DB.First(&throttle, "throttle_key = ?", userThrottleKey("bob")).Error; err != nil {
+			t.Fatal(err)
+		}
+		if throttle.Failures != 1 || throttle.LockedUntil != nil {
+			t.Fatalf("重新計算後 failures = %d, lockedUntil = %v", throttle.Failures, throttle.LockedUntil)
+		}
+		if _, err := users.Login("bob", "secret123", "10.0.0.1"); err != nil {
+			t.Fatalf("解除鎖定後應該可以登入: %v", err)
+		}
+	})
+}
+
+func TestRecordFailureCountsEveryFailure(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *DBModel) {
+		now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		key := ipThrottleKey("10.0.0.2")
+
+		// 超過門檻後每多失敗一次，鎖定時間加倍
+		for i := 1; i <= loginMaxIPFailures+2; i++ {
+			if err := recordFailure(db.DB, key, loginMaxIPFailures, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var throttle LoginThrottle
+		if err := db.DB.First(&throttle, "throttle_key = ?", key).Error; err != nil {
+			t.Fatal(err)
+		}
+		if throttle.Failures != loginMaxIPFailures+2 {
+			t.Fatalf("failures = %d，預期 %d", throttle.Failures, loginMaxIPFailures+2)
+		}
+		if want := now.Add(4 * loginBaseLockout); throttle.LockedUntil == nil || !throttle.LockedUntil.Equal(want) {
+			t.Fatalf("lockedUntil = %v，預期 %v", throttle.LockedUntil, want)
+		}
+	})
+}
+
+func TestPurgeLoginRecords(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *DBModel) {
+		now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		users := &db.User
+		users.Clock = func() time.Time { return now }
+
+		// 舊的紀錄: 失敗次數早就過期
+		if err := db.DB.Create(&LoginAttempt{Username: "old", IP: "10.0.0.1", Result: LoginWrongPassword, CreatedAt: now.AddDate(0, 0, -100)}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := recordFailure(db.DB, userThrottleKey("old"), loginMaxUserFailures, now.Add(-2*loginFailureWindow)); err != nil {
+			t.Fatal(err)
+		}
+		// 新的紀錄與鎖定中的 IP 要保留
+		if _, err := users.Login("new", "wrong-password", "10.0.0.3"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatal(err)
+		}
+		until := now.Add(time.Minute)
+		if err := db.DB.Create(&LoginThrottle{Key: ipThrottleKey("10.0.0.4"), Failures: 30, LastFailureAt: now.Add(-2 * loginFailureWindow), LockedUntil: &until}).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		purged, err := users.PurgeLoginRecords(90 * 24 * time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if purged != 2 {
+			t.Fatalf("刪除 %d 筆，預期 2 筆", purged)
+		}
+		var keys []string
+		db.DB.Model(&LoginThrottle{}).Order("throttle_key").Pluck("throttle_key", &keys)
+		if len(keys) != 3 || keys[0] != "ip:10.0.0.3" || keys[1] != "ip:10.0.0.4" || keys[2] != "user:new" {
+			t.Fatalf("剩下的 throttle = %v", keys)
+		}
+		attempts, _ := users.ListLoginAttempts(LoginAttemptQuery{})
+		if len(attempts) != 1 || attempts[0].Username != "new" {
+			t.Fatalf("剩下的登入紀錄 = %+v", attempts)
+		}
+	})
+}
+
+// 鎖定、解除鎖定與登入紀錄在 GORM 與 MemoryStore 上行為相同
+func TestLoginLockoutViaUserStore(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	forEachUserStore(t, &now, func(t *testing.T, users UserStore) {
+		if _, err := users.CreateUser("bob", "secret123", RoleKitchen); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < loginMaxUserFailures; i++ {
+			if _, err := users.Login("bob", "wrong-password", "10.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("第 %d 次密碼錯誤: %v", i+1, err)
+			}
+		}
+		var locked *LoginLockedError
+		if _, err := users.Login("bob", "secret123", "10.0.0.1"); !errors.As(err, &locked) {
+			t.Fatalf("達到門檻後應該被鎖定，實際: %v", err)
+		}
+		locks, err := users.ListLoginLocks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(locks) != 1 || locks[0].Key != userThrottleKey("bob") {
+			t.Fatalf("鎖定中的紀錄 = %+v", locks)
+		}
+
+		if err := users.UnlockLogin("user:nobody"); !errors.Is(err, ErrLoginLockNotFound) {
+			t.Fatalf("解除不存在的鎖定: %v", err)
+		}
+		if err := users.UnlockLogin(locks[0].Key); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.Login("bob", "secret123", "10.0.0.1"); err != nil {
+			t.Fatalf("解除鎖定後應該可以登入: %v", err)
+		}
+
+		attempts, err := users.ListLoginAttempts(LoginAttemptQuery{Username: "bob"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(attempts) != loginMaxUserFailures+2 || attempts[0].Result != LoginSuccess {
+			t.Fatalf("登入紀錄 = %d 筆，最新一筆 %+v", len(attempts), attempts[0])
+		}
+	})
+}
@@ -0,0 +1,572 @@
+package models
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teris-io/shortid"
+	"gorm.io/gorm"
+)
+
+/*
+MemoryStore => 把訂單、帳號與菜單放在記憶體的 OrderStore / UserStore / CatalogStore，給 handler 的單元測試使用:
+  - 不需要資料庫檔案，每個測試 NewMemoryStore() 一份，互不影響
+  - 回傳的都是複本，呼叫端修改回傳值不會改到存起來的資料 (跟從資料庫查出來一樣)
+  - 錯誤與排序規則跟 GORM 版本相同，例如找不到訂單回傳 ErrOrderNotFound、GetOrder 回傳 gorm.ErrRecordNotFound
+  - 沒有 gormstore 的 sessions 資料表，session 的到期時間以最後活動時間加上 MemorySessionTTL 計算
+  - 程式結束資料就消失，不能用在正式環境
+*/
+
+type MemoryStore struct {
+	// 驗證 TOTP、計算登入鎖定與 session 到期使用的時鐘，nil 代表 time.Now (與 UserModel.Clock 相同)
+	Clock func() time.Time
+
+	mu     sync.Mutex
+	lastID uint // 自動編號 (狀態歷程、帳號、登入紀錄 ...) 共用，只保證不重複
+
+	orders          map[string]*Order
+	archived        map[string]*ArchivedOrder
+	idempotencyKeys map[string]IdempotencyKey
+
+	users          map[uint]*User
+	loginAttempts  []LoginAttempt
+	throttles      map[string]*LoginThrottle
+	recoveryCodes  []RecoveryCode
+	twoFactorRoles map[Role]bool
+	apiTokens      []*APIToken
+	sessions       map[string]*UserSession // key 為 SessionID
+
+	products []Product
+	sizes    []ProductSize
+	prices   []ProductPrice
+}
+
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		orders:          map[string]*Order{},
+		archived:        map[string]*ArchivedOrder{},
+		idempotencyKeys: map[string]IdempotencyKey{},
+		users:           map[uint]*User{},
+		throttles:       map[string]*LoginThrottle{},
+		twoFactorRoles:  map[Role]bool{},
+		sessions:        map[string]*UserSession{},
+	}
+	m.seedCatalog()
+	return m
+}
+
+func (m *MemoryStore) now() time.Time {
+	if m.Clock != nil {
+		return m.Clock()
+	}
+	return time.Now()
+}
+
+func (m *MemoryStore) nextID() uint {
+	m.lastID++
+	return m.lastID
+}
+
+// ====== 訂單 ======
+
+func (m *MemoryStore) CreateOrder(order *Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createOrder(order)
+}
+
+// 跟 GORM 的 Create 一樣補上 ID 與時間，並寫回呼叫端傳進來的 order
+func (m *MemoryStore) createOrder(order *Order) error {
+	if order.ID == "" {
+		order.ID = shortid.MustGenerate()
+	}
+	if _, exists := m.orders[order.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+	if len(order.StatusEvents) == 0 {
+		order.StatusEvents = []OrderStatusEvent{{ToStatus: order.Status}}
+	}
+	now := m.now()
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = now
+	}
+	if order.UpdatedAt.IsZero() {
+		order.UpdatedAt = now
+	}
+	for i := range order.Items {
+		if order.Items[i].ID == "" {
+			order.Items[i].ID = shortid.MustGenerate()
+		}
+		order.Items[i].OrderID = order.ID
+	}
+	for i := range order.StatusEvents {
+		event := &order.StatusEvents[i]
+		event.ID = m.nextID()
+		event.OrderID = order.ID
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = now
+		}
+	}
+	stored := cloneOrder(order)
+	m.orders[order.ID] = &stored
+	return nil
+}
+
+func (m *MemoryStore) GetOrder(id string) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order := m.liveOrder(id)
+	if order == nil {
+		return &Order{}, gorm.ErrRecordNotFound
+	}
+	found := orderWithHistory(order)
+	return &found, nil
+}
+
+func (m *MemoryStore) FindOrder(id string) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order := m.liveOrder(id)
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	found := orderWithHistory(order)
+	return &found, nil
+}
+
+func (m *MemoryStore) ListOrders(q OrderQuery) (*OrderPage, error) {
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = "createdAt"
+	}
+	column, ok := orderSortColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSort, sortBy)
+	}
+	limit := pageLimit(q.Limit)
+
+	var cursor *orderCursor
+	if q.Cursor != "" {
+		c, err := decodeOrderCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursor = &c
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var orders []Order
+	for _, order := range m.orders {
+		if order.DeletedAt.Valid || !matchOrderFilter(order, q.Status, q.From, q.To, q.Search) {
+			continue
+		}
+		if q.Phone != "" && !containsFold(order.Phone, q.Phone) {
+			continue
+		}
+		if cursor != nil {
+			// 跟 cursor 比較 (排序值, ID)，只留下排在 cursor 後面的
+			c := cmp.Or(orderSortTime(order, column).Compare(cursor.Time), strings.Compare(order.ID, cursor.ID))
+			if q.Desc {
+				c = -c
+			}
+			if c <= 0 {
+				continue
+			}
+		}
+		orders = append(orders, orderWithItems(order))
+	}
+	sortOrders(orders, column, q.Desc)
+
+	page := &OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = encodeOrderCursor(orderCursor{Time: orderSortTime(&last, column), ID: last.ID})
+	}
+	return page, nil
+}
+
+func (m *MemoryStore) SearchOrders(q OrderSearch) (*OrderSearchResult, error) {
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = "createdAt"
+	}
+	column, ok := orderSearchSortColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSort, sortBy)
+	}
+	pageSize := pageLimit(q.PageSize)
+	page := max(q.Page, 1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var orders []Order
+	for _, order := range m.orders {
+		if !order.DeletedAt.Valid && matchOrderFilter(order, q.Status, q.From, q.To, q.Search) {
+			orders = append(orders, orderWithItems(order))
+		}
+	}
+	sortOrders(orders, column, q.Desc)
+
+	result := &OrderSearchResult{Total: int64(len(orders)), Page: page, PageSize: pageSize}
+	start := min((page-1)*pageSize, len(orders))
+	end := min(start+pageSize, len(orders))
+	result.Orders = orders[start:end]
+	return result, nil
+}
+
+func (m *MemoryStore) UpdateOrderStatus(orderID string, change StatusChange) (*OrderStatusEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order := m.liveOrder(orderID)
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if err := CheckTransition(order.Status, change.To, change.Actor, change.Role); err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	event := OrderStatusEvent{
+		ID:         m.nextID(),
+		OrderID:    orderID,
+		FromStatus: order.Status,
+		ToStatus:   change.To,
+		UserID:     change.UserID,
+		Note:       change.Note,
+		CreatedAt:  now,
+	}
+	order.Status = change.To
+	order.UpdatedAt = now
+	order.StatusEvents = append(order.StatusEvents, event)
+	return &event, nil
+}
+
+func (m *MemoryStore) DeleteOrder(id string, userID *uint, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order := m.liveOrder(id)
+	if order == nil {
+		return ErrOrderNotFound
+	}
+	order.DeletedAt = gorm.DeletedAt{Time: m.now(), Valid: true}
+	order.DeletedBy = userID
+	order.DeleteReason = reason
+	return nil
+}
+
+// ====== 垃圾桶 ======
+
+func (m *MemoryStore) ListDeletedOrders(retention time.Duration) ([]DeletedOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []DeletedOrder
+	for _, order := range m.orders {
+		if !order.DeletedAt.Valid {
+			continue
+		}
+		deleted := DeletedOrder{Order: orderWithItems(order), RestoreUntil: order.DeletedAt.Time.Add(retention)}
+		if order.DeletedBy != nil {
+			if user := m.users[*order.DeletedBy]; user != nil {
+				deleted.DeletedByName = user.Username
+			}
+		}
+		list = append(list, deleted)
+	}
+	// 最近刪除的在前面
+	slices.SortFunc(list, func(a, b DeletedOrder) int {
+		return cmp.Or(b.DeletedAt.Time.Compare(a.DeletedAt.Time), strings.Compare(b.ID, a.ID))
+	})
+	return list, nil
+}
+
+func (m *MemoryStore) RestoreOrder(id string, retention time.Duration) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order, err := m.findDeletedOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.now().Sub(order.DeletedAt.Time) > retention {
+		return nil, ErrOrderRestoreExpired
+	}
+	order.DeletedAt = gorm.DeletedAt{}
+	order.DeletedBy = nil
+	order.DeleteReason = ""
+	restored := orderWithHistory(order)
+	return &restored, nil
+}
+
+func (m *MemoryStore) PurgeOrder(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.findDeletedOrder(id); err != nil {
+		return err
+	}
+	m.purgeOrder(id)
+	return nil
+}
+
+func (m *MemoryStore) PurgeDeletedOrders(retention time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := m.now().Add(-retention)
+	var purged int64
+	for id, order := range m.orders {
+		if order.DeletedAt.Valid && !order.DeletedAt.Time.After(cutoff) {
+			m.purgeOrder(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *MemoryStore) findDeletedOrder(id string) (*Order, error) {
+	order := m.orders[id]
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	if !order.DeletedAt.Valid {
+		return nil, ErrOrderNotDeleted
+	}
+	return order, nil
+}
+
+// 跟 purgeOrders 一樣一併刪掉指向這筆訂單的 Idempotency-Key
+func (m *MemoryStore) purgeOrder(id string) {
+	delete(m.orders, id)
+	for key, record := range m.idempotencyKeys {
+		if record.OrderID == id {
+			delete(m.idempotencyKeys, key)
+		}
+	}
+}
+
+// ====== 封存 ======
+
+func (m *MemoryStore) ArchiveOrders(olderThan time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	cutoff := now.Add(-olderThan)
+	var archived int64
+	for id, order := range m.orders {
+		if order.DeletedAt.Valid || !IsArchivableStatus(order.Status) || !order.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		archivedOrder := newArchivedOrder(cloneOrder(order), now)
+		m.archived[id] = &archivedOrder
+		m.purgeOrder(id)
+		archived++
+	}
+	return archived, nil
+}
+
+func (m *MemoryStore) SearchArchivedOrders(q ArchiveQuery) (*ArchivePage, error) {
+	limit := pageLimit(q.Limit)
+	var cursor *orderCursor
+	if q.Cursor != "" {
+		c, err := decodeOrderCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursor = &c
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var orders []ArchivedOrder
+	for _, order := range m.archived {
+		if q.Search != "" && order.ID != q.Search && !containsFold(order.CustomerName, q.Search) && !containsFold(order.Phone, q.Search) {
+			continue
+		}
+		if !inCreatedRange(order.CreatedAt, q.From, q.To) {
+			continue
+		}
+		if cursor != nil && cmp.Or(order.CreatedAt.Compare(cursor.Time), strings.Compare(order.ID, cursor.ID)) >= 0 {
+			continue
+		}
+		found := *order
+		found.Items = slices.Clone(order.Items)
+		found.StatusEvents = nil
+		orders = append(orders, found)
+	}
+	// 建立時間由新到舊
+	slices.SortFunc(orders, func(a, b ArchivedOrder) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(b.ID, a.ID))
+	})
+
+	page := &ArchivePage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = encodeOrderCursor(orderCursor{Time: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+func (m *MemoryStore) GetArchivedOrder(id string) (*ArchivedOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	order := m.archived[id]
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	found := *order
+	found.Items = slices.Clone(order.Items)
+	found.StatusEvents = slices.Clone(order.StatusEvents)
+	slices.SortFunc(found.StatusEvents, func(a, b ArchivedOrderStatusEvent) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return &found, nil
+}
+
+// ====== Idempotency-Key ======
+
+func (m *MemoryStore) CreateOrderIdempotent(key, requestHash string, order *Order, ttl time.Duration) (*Order, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	// 過期但還沒被清掉的 key 視為不存在
+	if record, ok := m.idempotencyKeys[key]; ok && record.ExpiresAt.After(now) {
+		if record.RequestHash != requestHash {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		existing := m.liveOrder(record.OrderID)
+		if existing == nil {
+			return nil, false, ErrIdempotentOrderGone
+		}
+		found := orderWithHistory(existing)
+		return &found, true, nil
+	}
+
+	if err := m.createOrder(order); err != nil {
+		return nil, false, err
+	}
+	m.idempotencyKeys[key] = IdempotencyKey{
+		Key:         key,
+		RequestHash: requestHash,
+		OrderID:     order.ID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	return order, false, nil
+}
+
+func (m *MemoryStore) PurgeExpiredIdempotencyKeys() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var purged int64
+	for key, record := range m.idempotencyKeys {
+		if !record.ExpiresAt.After(now) {
+			delete(m.idempotencyKeys, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// ====== 訂單共用的小工具 ======
+
+// 不在垃圾桶裡的訂單，找不到回傳 nil
+func (m *MemoryStore) liveOrder(id string) *Order {
+	order := m.orders[id]
+	if order == nil || order.DeletedAt.Valid {
+		return nil
+	}
+	return order
+}
+
+func cloneOrder(order *Order) Order {
+	c := *order
+	c.Items = slices.Clone(order.Items)
+	c.StatusEvents = slices.Clone(order.StatusEvents)
+	return c
+}
+
+// 對應 Preload("Items")，列表不載入狀態歷程
+func orderWithItems(order *Order) Order {
+	c := cloneOrder(order)
+	c.StatusEvents = nil
+	return c
+}
+
+// 對應 GetOrder 的 Preload("Items").Preload("StatusEvents")，歷程依時間排序
+func orderWithHistory(order *Order) Order {
+	c := cloneOrder(order)
+	slices.SortFunc(c.StatusEvents, func(a, b OrderStatusEvent) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return c
+}
+
+// 對應 applyOrderSearch 與狀態、建立時間的條件；LIKE 在 SQLite 不分英文大小寫，這裡也一樣
+// 關鍵字裡的 % 與 _ 在 SQL 跳脫後只代表字面上的字元，跟這裡的字串比對相同
+func matchOrderFilter(order *Order, status string, from, to *time.Time, search string) bool {
+	if status != "" && order.Status != status {
+		return false
+	}
+	if !inCreatedRange(order.CreatedAt, from, to) {
+		return false
+	}
+	for _, term := range strings.Fields(search) {
+		matched := order.ID == term ||
+			containsFold(order.CustomerName, term) ||
+			containsFold(order.Phone, term) ||
+			containsFold(order.Address, term) ||
+			slices.ContainsFunc(order.Items, func(item OrderItem) bool { return containsFold(item.Instructions, term) })
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func inCreatedRange(createdAt time.Time, from, to *time.Time) bool {
+	return (from == nil || !createdAt.Before(*from)) && (to == nil || createdAt.Before(*to))
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// column 為 orderSortColumns / orderSearchSortColumns 的資料庫欄位名稱，排序值相同時依 ID
+func sortOrders(orders []Order, column string, desc bool) {
+	slices.SortFunc(orders, func(a, b Order) int {
+		var c int
+		switch column {
+		case "total":
+			c = cmp.Compare(a.Total, b.Total)
+		case "customer_name":
+			c = strings.Compare(a.CustomerName, b.CustomerName)
+		default:
+			c = orderSortTime(&a, column).Compare(orderSortTime(&b, column))
+		}
+		c = cmp.Or(c, strings.Compare(a.ID, b.ID))
+		if desc {
+			return -c
+		}
+		return c
+	})
+}
+
+func orderSortTime(order *Order, column string) time.Time {
+	if column == "updated_at" {
+		return order.UpdatedAt
+	}
+	return order.CreatedAt
+}
+
+// 每頁筆數的預設值與上限，與 ListOrders / SearchOrders 相同
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultOrderPageSize
+	}
+	return min(limit, MaxOrderPageSize)
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"cmp"
+	"slices"
+)
+
+// ====== 菜單 ======
+// 與 CatalogModel 相同: 排序依 SortOrder、ID，名稱重複回傳 ErrCatalogDuplicate，刪除品項時一併刪除價格
+// NewMemoryStore 跟全新的資料庫一樣已經有預設的商品與尺寸 (SeedDefaults)，但沒有價格
+
+func (m *MemoryStore) seedCatalog() {
+	for i, name := range PizzaTypes {
+		m.products = append(m.products, Product{ID: m.nextID(), CatalogEntry: CatalogEntry{Name: name, Active: true, SortOrder: i}})
+	}
+	for i, name := range PizzaSizes {
+		m.sizes = append(m.sizes, ProductSize{ID: m.nextID(), CatalogEntry: CatalogEntry{Name: name, Active: true, SortOrder: i}})
+	}
+}
+
+func (m *MemoryStore) ActiveProducts() ([]Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.activeProducts(), nil
+}
+
+func (m *MemoryStore) ActiveSizes() ([]ProductSize, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.activeSizes(), nil
+}
+
+func (m *MemoryStore) ActivePrices() (map[PriceKey]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.activePrices(), nil
+}
+
+func (m *MemoryStore) PriceOrder(order *Order, taxRateBps int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return priceOrder(order, taxRateBps, m.activePrices())
+}
+
+func (m *MemoryStore) IsActiveProduct(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.ContainsFunc(m.activeProducts(), func(p Product) bool { return p.Name == name }), nil
+}
+
+func (m *MemoryStore) IsActiveSize(name string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.ContainsFunc(m.activeSizes(), func(s ProductSize) bool { return s.Name == name }), nil
+}
+
+func (m *MemoryStore) ListProducts() ([]Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedEntries(m.products, func(p Product) (CatalogEntry, uint) { return p.CatalogEntry, p.ID }), nil
+}
+
+func (m *MemoryStore) ListSizes() ([]ProductSize, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedEntries(m.sizes, func(s ProductSize) (CatalogEntry, uint) { return s.CatalogEntry, s.ID }), nil
+}
+
+func (m *MemoryStore) CreateProduct(entry CatalogEntry) (*Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.ContainsFunc(m.products, func(p Product) bool { return p.Name == entry.Name }) {
+		return nil, ErrCatalogDuplicate
+	}
+	now := m.now()
+	product := Product{ID: m.nextID(), CatalogEntry: entry, CreatedAt: now, UpdatedAt: now}
+	m.products = append(m.products, product)
+	return &product, nil
+}
+
+func (m *MemoryStore) UpdateProduct(id uint, entry CatalogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.products, func(p Product) bool { return p.ID == id })
+	if i < 0 {
+		return ErrCatalogNotFound
+	}
+	if slices.ContainsFunc(m.products, func(p Product) bool { return p.ID != id && p.Name == entry.Name }) {
+		return ErrCatalogDuplicate
+	}
+	m.products[i].CatalogEntry, m.products[i].UpdatedAt = entry, m.now()
+	return nil
+}
+
+func (m *MemoryStore) DeleteProduct(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.products)
+	m.products = slices.DeleteFunc(m.products, func(p Product) bool { return p.ID == id })
+	if len(m.products) == before {
+		return ErrCatalogNotFound
+	}
+	m.prices = slices.DeleteFunc(m.prices, func(p ProductPrice) bool { return p.ProductID == id })
+	return nil
+}
+
+func (m *MemoryStore) CreateSize(entry CatalogEntry) (*ProductSize, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.ContainsFunc(m.sizes, func(s ProductSize) bool { return s.Name == entry.Name }) {
+		return nil, ErrCatalogDuplicate
+	}
+	now := m.now()
+	size := ProductSize{ID: m.nextID(), CatalogEntry: entry, CreatedAt: now, UpdatedAt: now}
+	m.sizes = append(m.sizes, size)
+	return &size, nil
+}
+
+func (m *MemoryStore) UpdateSize(id uint, entry CatalogEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.sizes, func(s ProductSize) bool { return s.ID == id })
+	if i < 0 {
+		return ErrCatalogNotFound
+	}
+	if slices.ContainsFunc(m.sizes, func(s ProductSize) bool { return s.ID != id && s.Name == entry.Name }) {
+		return ErrCatalogDuplicate
+	}
+	m.sizes[i].CatalogEntry, m.sizes[i].UpdatedAt = entry, m.now()
+	return nil
+}
+
+func (m *MemoryStore) DeleteSize(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	before := len(m.sizes)
+	m.sizes = slices.DeleteFunc(m.sizes, func(s ProductSize) bool { return s.ID == id })
+	if len(m.sizes) == before {
+		return ErrCatalogNotFound
+	}
+	m.prices = slices.DeleteFunc(m.prices, func(p ProductPrice) bool { return p.ProductSizeID == id })
+	return nil
+}
+
+func (m *MemoryStore) ListPrices() ([]ProductPrice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.prices), nil
+}
+
+func (m *MemoryStore) SetPrice(productID, sizeID uint, price *int64) error {
+	return m.SetPrices([]PriceUpdate{{ProductID: productID, ProductSizeID: sizeID, Price: price}})
+}
+
+// 先檢查全部的價格再寫入，跟 CatalogModel 的 transaction 一樣不會只存了一部分
+func (m *MemoryStore) SetPrices(updates []PriceUpdate) error {
+	if err := validatePriceUpdates(updates); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range updates {
+		m.prices = slices.DeleteFunc(m.prices, func(p ProductPrice) bool {
+			return p.ProductID == u.ProductID && p.ProductSizeID == u.ProductSizeID
+		})
+		if u.Price != nil {
+			m.prices = append(m.prices, ProductPrice{ID: m.nextID(), ProductID: u.ProductID, ProductSizeID: u.ProductSizeID, Price: *u.Price, UpdatedAt: m.now()})
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) activeProducts() []Product {
+	products := slices.DeleteFunc(slices.Clone(m.products), func(p Product) bool { return !p.Active })
+	return sortedEntries(products, func(p Product) (CatalogEntry, uint) { return p.CatalogEntry, p.ID })
+}
+
+func (m *MemoryStore) activeSizes() []ProductSize {
+	sizes := slices.DeleteFunc(slices.Clone(m.sizes), func(s ProductSize) bool { return !s.Active })
+	return sortedEntries(sizes, func(s ProductSize) (CatalogEntry, uint) { return s.CatalogEntry, s.ID })
+}
+
+// 跟 CatalogModel.active 一樣，只包含上架中的商品 × 尺寸
+func (m *MemoryStore) activePrices() map[PriceKey]int64 {
+	productNames := map[uint]string{}
+	for _, p := range m.activeProducts() {
+		productNames[p.ID] = p.Name
+	}
+	sizeNames := map[uint]string{}
+	for _, s := range m.activeSizes() {
+		sizeNames[s.ID] = s.Name
+	}
+	prices := make(map[PriceKey]int64, len(m.prices))
+	for _, row := range m.prices {
+		product, ok1 := productNames[row.ProductID]
+		size, ok2 := sizeNames[row.ProductSizeID]
+		if ok1 && ok2 {
+			prices[PriceKey{Product: product, Size: size}] = row.Price
+		}
+	}
+	return prices
+}
+
+// 依 SortOrder、ID 排序的複本，對應 ORDER BY sort_order, id
+func sortedEntries[T any](entries []T, key func(T) (CatalogEntry, uint)) []T {
+	sorted := slices.Clone(entries)
+	slices.SortFunc(sorted, func(a, b T) int {
+		entryA, idA := key(a)
+		entryB, idB := key(b)
+		return cmp.Or(cmp.Compare(entryA.SortOrder, entryB.SortOrder), cmp.Compare(idA, idB))
+	})
+	return sorted
+}
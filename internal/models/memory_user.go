@@ -0,0 +1,752 @@
+package models
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryStore 沒有 gormstore 的 sessions 資料表可以 JOIN，session 的到期時間以最後活動時間加上這個值計算
+// 與 createSessionStore 的 Cookie MaxAge 相同
+const MemorySessionTTL = 24 * time.Hour
+
+// ====== 帳號 ======
+
+func (m *MemoryStore) GetUserByID(id string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userID, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return nil, nil // 跟資料庫一樣，格式不對就是查不到
+	}
+	user := m.users[uint(userID)]
+	if user == nil {
+		return nil, nil
+	}
+	found := *user
+	return &found, nil
+}
+
+func (m *MemoryStore) ListUsers() ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	users := make([]User, 0, len(m.users))
+	for _, user := range m.users {
+		users = append(users, *user)
+	}
+	slices.SortFunc(users, func(a, b User) int { return cmp.Compare(a.ID, b.ID) })
+	return users, nil
+}
+
+func (m *MemoryStore) CreateUser(username, password string, role Role) (*User, error) {
+	if !IsValidRole(role) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	hash, err := memoryHashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.userByUsername(username) != nil {
+		return nil, ErrUserDuplicate
+	}
+	user := &User{ID: m.nextID(), Username: username, Password: hash, Role: role}
+	m.users[user.ID] = user
+	created := *user
+	return &created, nil
+}
+
+func (m *MemoryStore) SetDisabled(id uint, disabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.findUser(id)
+	if err != nil {
+		return err
+	}
+	if disabled && user.Role == RoleOwner && !user.Disabled {
+		if err := m.ensureAnotherOwner(id); err != nil {
+			return err
+		}
+	}
+
+	user.Disabled = disabled
+	user.DisabledAt = nil
+	if disabled {
+		now := m.now()
+		user.DisabledAt = &now
+		m.revokeUserSessions(id, "")
+	}
+	return nil
+}
+
+func (m *MemoryStore) SetRole(id uint, role Role) error {
+	if !IsValidRole(role) {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.findUser(id)
+	if err != nil {
+		return err
+	}
+	if user.Role == RoleOwner && role != RoleOwner && !user.Disabled {
+		if err := m.ensureAnotherOwner(id); err != nil {
+			return err
+		}
+	}
+	user.Role = role
+	return nil
+}
+
+func (m *MemoryStore) ResetPassword(id uint, password string) error {
+	return m.setPassword(id, password, "")
+}
+
+func (m *MemoryStore) ChangePassword(id uint, current, password, keepSessionID string) error {
+	m.mu.Lock()
+	user, err := m.findUser(id)
+	ok := err == nil && CompareHashAndPassword(user.Password, current)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+	return m.setPassword(id, password, keepSessionID)
+}
+
+func (m *MemoryStore) setPassword(id uint, password, keepSessionID string) error {
+	hash, err := memoryHashPassword(password)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.findUser(id)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	m.revokeUserSessions(id, keepSessionID)
+	return nil
+}
+
+// 測試不需要 bcrypt 的預設強度，用最低的 cost 讓建立帳號快一點
+func memoryHashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	return string(hash), err
+}
+
+func (m *MemoryStore) findUser(id uint) (*User, error) {
+	user := m.users[id]
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (m *MemoryStore) userByUsername(username string) *User {
+	for _, user := range m.users {
+		if user.Username == username {
+			return user
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) ensureAnotherOwner(id uint) error {
+	for _, user := range m.users {
+		if user.ID != id && user.Role == RoleOwner && !user.Disabled {
+			return nil
+		}
+	}
+	return ErrLastOwner
+}
+
+// ====== 登入 ======
+
+func (m *MemoryStore) Login(username, password, ip string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	keys := []string{userThrottleKey(username), ipThrottleKey(ip)}
+
+	if until := m.lockedUntil(now, keys...); until != nil {
+		m.recordAttempt(username, nil, ip, LoginLocked, now)
+		return nil, &LoginLockedError{Until: *until}
+	}
+
+	// 帳號不存在時不跑 dummy bcrypt，測試不需要防範時間差
+	result := LoginUnknownUser
+	user := m.userByUsername(username)
+	var userID *uint
+	if user != nil {
+		userID = &user.ID
+		switch {
+		case !CompareHashAndPassword(user.Password, password):
+			result = LoginWrongPassword
+		case user.Disabled:
+			result = LoginDisabled
+		case user.TOTPEnabled:
+			result = LoginTOTPPending
+		default:
+			result = LoginSuccess
+		}
+	}
+	m.recordAttempt(username, userID, ip, result, now)
+
+	switch result {
+	case LoginSuccess:
+		delete(m.throttles, keys[0])
+		found := *user
+		return &found, nil
+	case LoginTOTPPending:
+		found := *user
+		return &found, nil
+	case LoginDisabled:
+		return nil, ErrUserDisabled
+	default:
+		m.recordFailures(keys, now)
+		return nil, ErrInvalidCredentials
+	}
+}
+
+func (m *MemoryStore) VerifySecondFactor(userID uint, code, ip string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	user, err := m.findUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled || !user.TOTPEnabled {
+		return nil, ErrInvalidCredentials
+	}
+	keys := []string{userThrottleKey(user.Username), ipThrottleKey(ip)}
+
+	if until := m.lockedUntil(now, keys...); until != nil {
+		m.recordAttempt(user.Username, &user.ID, ip, LoginLocked, now)
+		return nil, &LoginLockedError{Until: *until}
+	}
+
+	if !m.checkSecondFactor(user, code, now) {
+		m.recordAttempt(user.Username, &user.ID, ip, LoginTOTPFailed, now)
+		m.recordFailures(keys, now)
+		return nil, ErrInvalidTOTPCode
+	}
+
+	m.recordAttempt(user.Username, &user.ID, ip, LoginSuccess, now)
+	delete(m.throttles, keys[0])
+	found := *user
+	return &found, nil
+}
+
+// 驗證 TOTP 驗證碼或備用碼，成功時驗證碼 / 備用碼都會被標記為用過
+func (m *MemoryStore) checkSecondFactor(user *User, code string, now time.Time) bool {
+	code = strings.TrimSpace(code)
+	if step := matchTOTP(user.TOTPSecret, code, now); step >= 0 {
+		if user.TOTPLastStep >= step {
+			return false
+		}
+		user.TOTPLastStep = step
+		return true
+	}
+
+	hash := hashRecoveryCode(code)
+	for i := range m.recoveryCodes {
+		rc := &m.recoveryCodes[i]
+		if rc.UserID == user.ID && rc.CodeHash == hash && rc.UsedAt == nil {
+			rc.UsedAt = &now
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) recordAttempt(username string, userID *uint, ip, result string, now time.Time) {
+	m.loginAttempts = append(m.loginAttempts, LoginAttempt{
+		ID:        m.nextID(),
+		Username:  username,
+		UserID:    userID,
+		IP:        ip,
+		Result:    result,
+		CreatedAt: now,
+	})
+}
+
+// keys 依序為帳號與 IP，各自套用不同的門檻
+func (m *MemoryStore) recordFailures(keys []string, now time.Time) {
+	for i, threshold := range []int{loginMaxUserFailures, loginMaxIPFailures} {
+		t := m.throttles[keys[i]]
+		if t == nil {
+			t = &LoginThrottle{Key: keys[i]}
+			m.throttles[keys[i]] = t
+		}
+		t.addFailure(threshold, now)
+	}
+}
+
+func (m *MemoryStore) lockedUntil(now time.Time, keys ...string) *time.Time {
+	var until *time.Time
+	for _, key := range keys {
+		t := m.throttles[key]
+		if t == nil || t.LockedUntil == nil || !t.LockedUntil.After(now) {
+			continue
+		}
+		if until == nil || t.LockedUntil.After(*until) {
+			until = t.LockedUntil
+		}
+	}
+	return until
+}
+
+func (m *MemoryStore) ListLoginAttempts(q LoginAttemptQuery) ([]LoginAttempt, error) {
+	limit := q.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var attempts []LoginAttempt
+	for _, attempt := range m.loginAttempts {
+		if (q.Username != "" && attempt.Username != q.Username) ||
+			(q.IP != "" && attempt.IP != q.IP) ||
+			(q.FailedOnly && attempt.Result == LoginSuccess) {
+			continue
+		}
+		attempts = append(attempts, attempt)
+	}
+	// 由新到舊
+	slices.SortFunc(attempts, func(a, b LoginAttempt) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return attempts[:min(limit, len(attempts))], nil
+}
+
+func (m *MemoryStore) PurgeLoginRecords(retention time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	before := len(m.loginAttempts)
+	m.loginAttempts = slices.DeleteFunc(m.loginAttempts, func(a LoginAttempt) bool {
+		return a.CreatedAt.Before(now.Add(-retention))
+	})
+	purged := int64(before - len(m.loginAttempts))
+	for key, t := range m.throttles {
+		if t.LastFailureAt.Before(now.Add(-loginFailureWindow)) && (t.LockedUntil == nil || !t.LockedUntil.After(now)) {
+			delete(m.throttles, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *MemoryStore) ListLoginLocks() ([]LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var locks []LoginThrottle
+	for _, t := range m.throttles {
+		if t.LockedUntil != nil && t.LockedUntil.After(now) {
+			locks = append(locks, *t)
+		}
+	}
+	slices.SortFunc(locks, func(a, b LoginThrottle) int {
+		return cmp.Or(b.LockedUntil.Compare(*a.LockedUntil), strings.Compare(a.Key, b.Key))
+	})
+	return locks, nil
+}
+
+func (m *MemoryStore) UnlockLogin(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.throttles[key] == nil {
+		return ErrLoginLockNotFound
+	}
+	delete(m.throttles, key)
+	return nil
+}
+
+// ====== 兩步驟驗證 ======
+
+func (m *MemoryStore) StartTOTPEnrollment(id uint) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.findUser(id)
+	if err != nil {
+		return "", err
+	}
+	if user.TOTPEnabled {
+		return "", ErrTOTPAlreadyEnabled
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	user.TOTPSecret = secret
+	return secret, nil
+}
+
+func (m *MemoryStore) EnableTOTP(id uint, code string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotPending
+	}
+	step := matchTOTP(user.TOTPSecret, strings.TrimSpace(code), m.now())
+	if step < 0 {
+		return nil, ErrInvalidTOTPCode
+	}
+	codes, err := m.replaceRecoveryCodes(id)
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	return codes, nil
+}
+
+func (m *MemoryStore) DisableTOTP(id uint, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.findUser(id)
+	if err != nil {
+		return err
+	}
+	if !CompareHashAndPassword(user.Password, password) {
+		return ErrWrongPassword
+	}
+	if !user.TOTPEnabled {
+		return ErrTOTPNotEnabled
+	}
+	if m.twoFactorRoles[user.Role] {
+		return ErrTOTPRequired
+	}
+	m.clearTOTP(user)
+	return nil
+}
+
+func (m *MemoryStore) ResetTOTP(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.findUser(id)
+	if err != nil {
+		return err
+	}
+	m.clearTOTP(user)
+	return nil
+}
+
+func (m *MemoryStore) RegenerateRecoveryCodes(id uint, password string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.findUser(id)
+	if err != nil {
+		return nil, err
+	}
+	if !CompareHashAndPassword(user.Password, password) {
+		return nil, ErrWrongPassword
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTOTPNotEnabled
+	}
+	return m.replaceRecoveryCodes(id)
+}
+
+func (m *MemoryStore) RemainingRecoveryCodes(id uint) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var count int64
+	for _, rc := range m.recoveryCodes {
+		if rc.UserID == id && rc.UsedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *MemoryStore) clearTOTP(user *User) {
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	m.deleteRecoveryCodes(user.ID)
+}
+
+func (m *MemoryStore) deleteRecoveryCodes(userID uint) {
+	m.recoveryCodes = slices.DeleteFunc(m.recoveryCodes, func(rc RecoveryCode) bool { return rc.UserID == userID })
+}
+
+func (m *MemoryStore) replaceRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	rows := make([]RecoveryCode, RecoveryCodeCount)
+	now := m.now()
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = RecoveryCode{ID: m.nextID(), UserID: userID, CodeHash: hashRecoveryCode(code), CreatedAt: now}
+	}
+	m.deleteRecoveryCodes(userID)
+	m.recoveryCodes = append(m.recoveryCodes, rows...)
+	return codes, nil
+}
+
+func (m *MemoryStore) TwoFactorRoles() ([]Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var roles []Role
+	for _, role := range Roles {
+		if m.twoFactorRoles[role] {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (m *MemoryStore) SetTwoFactorRoles(roles []Role) error {
+	for _, role := range roles {
+		if !IsValidRole(role) {
+			return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.twoFactorRoles = map[Role]bool{}
+	for _, role := range roles {
+		m.twoFactorRoles[role] = true
+	}
+	return nil
+}
+
+func (m *MemoryStore) TwoFactorRequired(role Role) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.twoFactorRoles[role], nil
+}
+
+// ====== API token ======
+
+func (m *MemoryStore) CreateAPIToken(userID uint, name string, scopes []Permission, days int) (string, *APIToken, error) {
+	if days < 1 || days > APITokenMaxDays {
+		return "", nil, ErrAPITokenExpiry
+	}
+	if len(scopes) == 0 {
+		return "", nil, ErrAPITokenNoScope
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, err := m.findUser(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	now := m.now()
+	plain, token, err := newAPIToken(user, name, scopes, now.AddDate(0, 0, days))
+	if err != nil {
+		return "", nil, err
+	}
+	token.ID = m.nextID()
+	token.CreatedAt = now
+	m.apiTokens = append(m.apiTokens, token)
+	created := *token
+	return plain, &created, nil
+}
+
+func (m *MemoryStore) AuthenticateAPIToken(plain string) (*APIToken, *User, error) {
+	if !strings.HasPrefix(plain, APITokenPrefix) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash := hashAPIToken(plain)
+	i := slices.IndexFunc(m.apiTokens, func(t *APIToken) bool { return t.TokenHash == hash })
+	if i < 0 {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	token := m.apiTokens[i]
+	now := m.now()
+	if !token.Active(now) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	user, err := m.findUser(token.UserID)
+	if err != nil {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	if user.Disabled {
+		return nil, nil, ErrUserDisabled
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+		token.LastUsedAt = &now
+	}
+	found := *token
+	found.User = *user
+	owner := *user
+	return &found, &owner, nil
+}
+
+func (m *MemoryStore) ListAPITokens(userID uint) ([]APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tokens []APIToken
+	for _, token := range m.apiTokens {
+		if userID != 0 && token.UserID != userID {
+			continue
+		}
+		found := *token
+		if user := m.users[token.UserID]; user != nil {
+			found.User = *user
+		}
+		tokens = append(tokens, found)
+	}
+	// 新的在前面
+	slices.SortFunc(tokens, func(a, b APIToken) int { return cmp.Compare(b.ID, a.ID) })
+	return tokens, nil
+}
+
+func (m *MemoryStore) RevokeAPIToken(id, ownerID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.apiTokens, func(t *APIToken) bool {
+		return t.ID == id && (ownerID == 0 || t.UserID == ownerID)
+	})
+	if i < 0 {
+		return ErrAPITokenNotFound
+	}
+	token := m.apiTokens[i]
+	if token.RevokedAt != nil {
+		return ErrAPITokenRevoked
+	}
+	now := m.now()
+	token.RevokedAt = &now
+	return nil
+}
+
+// ====== 登入裝置 ======
+// 只刪除 UserSession 紀錄，不會清掉 sessions.Store 裡的 session 資料；
+// AuthMiddleware 每個請求都會 TouchSession，找不到紀錄一樣會被登出
+
+func (m *MemoryStore) RecordSession(sessionID string, userID uint, ip, userAgent string) error {
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sessions[sessionID] = &UserSession{
+		ID:         m.nextID(),
+		SessionID:  sessionID,
+		UserID:     userID,
+		IP:         ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	return nil
+}
+
+func (m *MemoryStore) TouchSession(sessionID string, userID uint, ip string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session := m.sessions[sessionID]
+	if session == nil || session.UserID != userID {
+		return ErrSessionRevoked
+	}
+	now := m.now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval && session.IP == ip {
+		return nil
+	}
+	session.LastSeenAt = now
+	session.IP = ip
+	return nil
+}
+
+func (m *MemoryStore) ListSessions(userID uint) ([]UserSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var list []UserSession
+	for _, session := range m.sessions {
+		expiresAt := session.LastSeenAt.Add(MemorySessionTTL)
+		if (userID != 0 && session.UserID != userID) || !expiresAt.After(now) {
+			continue
+		}
+		found := *session
+		found.ExpiresAt = expiresAt
+		if user := m.users[session.UserID]; user != nil {
+			found.User = *user
+		}
+		list = append(list, found)
+	}
+	// 依帳號、最後活動時間 (新到舊) 排序
+	slices.SortFunc(list, func(a, b UserSession) int {
+		return cmp.Or(cmp.Compare(a.UserID, b.UserID), b.LastSeenAt.Compare(a.LastSeenAt), cmp.Compare(a.ID, b.ID))
+	})
+	return list, nil
+}
+
+func (m *MemoryStore) RevokeSession(id, ownerID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for sessionID, session := range m.sessions {
+		if session.ID == id && (ownerID == 0 || session.UserID == ownerID) {
+			delete(m.sessions, sessionID)
+			return nil
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (m *MemoryStore) RevokeUserSessions(userID uint, keepSessionID string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.revokeUserSessions(userID, keepSessionID), nil
+}
+
+func (m *MemoryStore) EndSession(sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, sessionID)
+	return nil
+}
+
+func (m *MemoryStore) PurgeExpiredSessions() (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var purged int64
+	for sessionID, session := range m.sessions {
+		if !session.LastSeenAt.Add(MemorySessionTTL).After(now) {
+			delete(m.sessions, sessionID)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (m *MemoryStore) revokeUserSessions(userID uint, keepSessionID string) int {
+	var revoked int
+	for sessionID, session := range m.sessions {
+		if session.UserID == userID && sessionID != keepSessionID {
+			delete(m.sessions, sessionID)
+			revoked++
+		}
+	}
+	return revoked
+}
@@ -0,0 +1,293 @@
+package models
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+資料表結構改用有版本號的 SQL migration，取代每次啟動都執行的 AutoMigrate:
+  - migration 檔案放在 migrations/<資料庫種類>/，編進執行檔，部署時不需要另外帶 SQL 檔
+  - 檔名格式 0002_add_order_note.up.sql / 0002_add_order_note.down.sql，每個版本都要有 up 與 down
+  - 已經套用的版本記錄在 schema_migrations，每個版本在自己的 transaction 裡執行並寫入紀錄
+  - 資料庫的版本比執行檔認得的還新 (例如新版跑過 migration 後又用舊版啟動) 時拒絕執行，回傳 *SchemaTooNewError
+  - SQL 檔裡每個敘述以「;」結尾並換行，以 -- 開頭的行是註解
+  - 改用 migration 前由 AutoMigrate 建立的資料庫 (有 orders 但沒有 schema_migrations) 視為舊版資料庫，
+    套用第一個版本前先用 legacyModels 跑一次 AutoMigrate 補齊欄位與索引，之後就只靠 migration 更新
+*/
+
+//go:embed migrations
+var migrationFS embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// SchemaMigration => schema_migrations 資料表，一筆代表一個已經套用的版本
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"not null" json:"name"`
+	AppliedAt time.Time `gorm:"not null" json:"appliedAt"`
+}
+
+// Migration => 一個版本的 up / down SQL
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// SchemaTooNewError => 資料庫已經套用了執行檔不認得的版本
+type SchemaTooNewError struct {
+	Current int // 資料庫目前的版本
+	Latest  int // 執行檔最新的版本
+}
+
+func (e *SchemaTooNewError) Error() string {
+	return fmt.Sprintf("資料庫的 schema 版本 (%d) 比執行檔支援的版本 (%d) 新，請使用新版的執行檔", e.Current, e.Latest)
+}
+
+var ErrInvalidMigrationTarget = errors.New("無效的 migration 目標版本")
+
+// 改用 migration 前最後一版 AutoMigrate 的 model，順序與當時相同
+// 0001 的資料表與這些 model 產生的相同，之後新增的欄位只能寫在新的 migration，不要加到這裡
+var legacyModels = []any{
+	&Order{}, &OrderItem{}, &OrderStatusEvent{}, &User{}, &LoginAttempt{}, &LoginThrottle{}, &RecoveryCode{},
+	&TwoFactorRole{}, &APIToken{}, &UserSession{}, &IdempotencyKey{}, &ArchivedOrder{}, &ArchivedOrderItem{},
+	&ArchivedOrderStatusEvent{}, &Product{}, &ProductSize{}, &ProductPrice{},
+}
+
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration // 依版本排序
+}
+
+// NewMigrator 依連線的資料庫種類 (sqlite / postgres / mysql) 載入對應目錄的 migration
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFS, path.Join("migrations", db.Dialector.Name()))
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("找不到 migration 目錄 %s: %w", dir, err)
+	}
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("migration 檔名格式錯誤: %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration 版本 %d 的 up / down 檔名不一致", version)
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Version <= 0 || m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration 版本 %d 必須大於 0，且同時有 up 與 down", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest 執行檔最新的版本，沒有任何 migration 時為 0
+func (m *Migrator) Latest() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Applied 列出資料庫已經套用的版本，schema_migrations 還不存在 (全新的資料庫) 時回傳空的
+func (m *Migrator) Applied() ([]SchemaMigration, error) {
+	if !m.DB.Migrator().HasTable(&SchemaMigration{}) {
+		return nil, nil
+	}
+	var applied []SchemaMigration
+	err := m.DB.Order("version ASC").Find(&applied).Error
+	return applied, err
+}
+
+// IsLegacy 是否為改用 migration 前由 AutoMigrate 建立的資料庫: 已經有訂單資料表，但沒有 schema_migrations
+func (m *Migrator) IsLegacy() bool {
+	return isLegacySchema(m.DB)
+}
+
+func isLegacySchema(db *gorm.DB) bool {
+	return !db.Migrator().HasTable(&SchemaMigration{}) && db.Migrator().HasTable(&Order{})
+}
+
+// Current 資料庫目前的版本 (已套用的最大版本)，全新的資料庫為 0
+func (m *Migrator) Current() (int, error) {
+	applied, err := m.Applied()
+	if err != nil || len(applied) == 0 {
+		return 0, err
+	}
+	return applied[len(applied)-1].Version, nil
+}
+
+// Check 確認資料庫沒有比執行檔新，回傳資料庫目前的版本
+func (m *Migrator) Check() (int, error) {
+	current, err := m.Current()
+	if err != nil {
+		return 0, err
+	}
+	if current > m.Latest() {
+		return current, &SchemaTooNewError{Current: current, Latest: m.Latest()}
+	}
+	return current, nil
+}
+
+// Up 套用版本 <= target 且還沒套用的 migration，target 為 0 代表最新版
+// dryRun 只回傳會執行的 migration，不修改資料庫
+func (m *Migrator) Up(target int, dryRun bool) ([]Migration, error) {
+	current, err := m.Check()
+	if err != nil {
+		return nil, err
+	}
+	if target == 0 {
+		target = m.Latest()
+	}
+	if target < current || target > m.Latest() {
+		return nil, fmt.Errorf("%w: %d (目前版本 %d，最新版本 %d)", ErrInvalidMigrationTarget, target, current, m.Latest())
+	}
+
+	var pending []Migration
+	for _, migration := range m.Migrations {
+		if migration.Version > current && migration.Version <= target {
+			pending = append(pending, migration)
+		}
+	}
+	if dryRun || len(pending) == 0 {
+		return pending, nil
+	}
+	for i, migration := range pending {
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			// schema_migrations 本身不屬於任何版本，跟第一個版本放在同一個 transaction 建立，
+			// 失敗時一起 rollback，不會留下只有 schema_migrations 的資料庫 (MySQL 的 DDL 例外，見 mysql/0001)
+			if i == 0 && current == 0 {
+				if err := prepareSchemaMigrations(tx); err != nil {
+					return err
+				}
+			}
+			if err := execStatements(tx, migration.Up); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("套用 migration %04d_%s 失敗: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// 建立 schema_migrations；舊版資料庫先用 AutoMigrate 補上 0001 之前缺少的欄位與索引，
+// 否則 0001 的 CREATE TABLE IF NOT EXISTS 會略過已經存在的資料表，接著在不存在的欄位上建索引而失敗
+func prepareSchemaMigrations(tx *gorm.DB) error {
+	if isLegacySchema(tx) {
+		if err := tx.AutoMigrate(legacyModels...); err != nil {
+			return fmt.Errorf("補齊舊版資料庫的欄位失敗: %w", err)
+		}
+	}
+	return tx.AutoMigrate(&SchemaMigration{})
+}
+
+// Down 依版本由新到舊還原到 target (不含 target)，target 為 0 代表還原全部
+// dryRun 只回傳會執行的 migration，不修改資料庫
+func (m *Migrator) Down(target int, dryRun bool) ([]Migration, error) {
+	current, err := m.Check()
+	if err != nil {
+		return nil, err
+	}
+	if target < 0 || target > current {
+		return nil, fmt.Errorf("%w: %d (目前版本 %d)", ErrInvalidMigrationTarget, target, current)
+	}
+
+	var pending []Migration
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if migration.Version > target && migration.Version <= current {
+			pending = append(pending, migration)
+		}
+	}
+	if dryRun {
+		return pending, nil
+	}
+	for i, migration := range pending {
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			if err := execStatements(tx, migration.Down); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("還原 migration %04d_%s 失敗: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// 逐一執行 SQL 敘述，不依賴 driver 是否支援一次執行多個敘述
+func execStatements(tx *gorm.DB, sql string) error {
+	for _, statement := range SplitStatements(sql) {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SplitStatements 把 migration 檔拆成單一的 SQL 敘述: 去掉 -- 註解行，以行尾的「;」分隔
+func SplitStatements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"testing"
+)
+
+// 改用 migration 前最早的資料表 (data/orders.db): 只有訂單、明細與帳號，沒有後來加上的欄位
+var baselineSchema = []string{
+	"CREATE TABLE `orders` (`id` text,`status` text NOT NULL,`customer_name` text NOT NULL,`phone` text NOT NULL,`address` text NOT NULL,`created_at` datetime, `updated_at` datetime,PRIMARY KEY (`id`))",
+	"CREATE TABLE `order_items` (`id` text,`order_id` text NOT NULL,`size` text NOT NULL,`pizza` text NOT NULL,`instructions` text,PRIMARY KEY (`id`),CONSTRAINT `fk_orders_items` FOREIGN KEY (`order_id`) REFERENCES `orders`(`id`))",
+	"CREATE INDEX `idx_order_items_order_id` ON `order_items`(`order_id`)",
+	"CREATE TABLE `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`username` text NOT NULL,`password` text NOT NULL)",
+	"CREATE UNIQUE INDEX `idx_users_username` ON `users`(`username`)",
+	"INSERT INTO `orders` VALUES ('legacy1','製作中','王小明','0912345678','台北市','2026-01-30 15:06:00','2026-01-30 15:06:00')",
+	"INSERT INTO `order_items` VALUES ('item1','legacy1','Medium','Margherita','加辣')",
+	"INSERT INTO `users` (`username`,`password`) VALUES ('admin','hash')",
+}
+
+func TestMigrateUpgradesBaselineSchema(t *testing.T) {
+	db := openTestDB(t)
+	for _, statement := range baselineSchema {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !migrator.IsLegacy() {
+		t.Fatal("沒有 schema_migrations 的舊資料庫應該被視為舊版")
+	}
+	applied, err := migrator.Up(0, false)
+	if err != nil {
+		t.Fatalf("升級舊版資料庫失敗: %v", err)
+	}
+	if len(applied) != len(migrator.Migrations) {
+		t.Fatalf("套用了 %d 個 migration，預期 %d", len(applied), len(migrator.Migrations))
+	}
+	if current, _ := migrator.Current(); current != migrator.Latest() {
+		t.Fatalf("升級後版本 %d，預期 %d", current, migrator.Latest())
+	}
+	if migrator.IsLegacy() {
+		t.Fatal("升級後不應該再被視為舊版")
+	}
+	for _, column := range []string{"deleted_at", "subtotal", "total"} {
+		if !db.Migrator().HasColumn(&Order{}, column) {
+			t.Errorf("orders 缺少欄位 %s", column)
+		}
+	}
+	if !db.Migrator().HasIndex(&Order{}, "idx_orders_deleted_at") {
+		t.Error("orders 缺少 deleted_at 的索引")
+	}
+
+	// 原本的資料還在，新的 model 可以直接使用
+	dbModel, err := NewDBModel(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order, err := dbModel.Order.GetOrder("legacy1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.CustomerName != "王小明" || len(order.Items) != 1 || order.Items[0].Quantity != 1 {
+		t.Fatalf("升級後的訂單 = %+v", order)
+	}
+	user, err := dbModel.User.GetUserByUsername("admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != RoleOwner {
+		t.Fatalf("唯一的舊帳號應該升級成店主，實際為 %s", user.Role)
+	}
+
+	// 再執行一次不會重複套用
+	if applied, err := migrator.Up(0, false); err != nil || len(applied) != 0 {
+		t.Fatalf("重複執行 Up: %d 個, %v", len(applied), err)
+	}
+}
+
+func TestMigrateFailureLeavesNoSchemaMigrations(t *testing.T) {
+	db := openTestDB(t)
+	migrator := &Migrator{DB: db, Migrations: []Migration{{
+		Version: 1,
+		Name:    "broken",
+		Up:      "CREATE TABLE `widgets` (`id` integer);\nCREATE INDEX `idx_widgets_name` ON `widgets`(`name`);",
+		Down:    "DROP TABLE `widgets`;",
+	}}}
+
+	if _, err := migrator.Up(0, false); err == nil {
+		t.Fatal("在不存在的欄位建索引應該失敗")
+	}
+	// 整個版本連同 schema_migrations 一起 rollback，修正後可以直接重跑
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		t.Error("失敗後不應該留下 schema_migrations")
+	}
+	if db.Migrator().HasTable("widgets") {
+		t.Error("失敗後不應該留下執行到一半的資料表")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := "-- 註解\nCREATE TABLE a (\n  id integer\n);\n\nCREATE INDEX b ON a(id);\nDROP TABLE c"
+	statements := SplitStatements(sql)
+	want := []string{"CREATE TABLE a (\n  id integer\n);", "CREATE INDEX b ON a(id);", "DROP TABLE c"}
+	if len(statements) != len(want) {
+		t.Fatalf("拆成 %d 個敘述: %q", len(statements), statements)
+	}
+	for i := range want {
+		if statements[i] != want[i] {
+			t.Errorf("第 %d 個敘述 = %q，預期 %q", i, statements[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,38 @@
+-- 基準版本: 與 sqlite/0001_initial.up.sql 相同的資料表，欄位型別依 GORM 的 mysql driver 產生
+-- MySQL 的 TEXT 欄位不能直接建索引，有索引的字串欄位改用 varchar(191) (utf8mb4 下索引長度的上限)
+-- MySQL 的 DDL 會自動 commit，執行到一半失敗時需要手動清理後再重跑
+-- gormstore 的 sessions 資料表由套件自己建立，不在這裡
+
+CREATE TABLE IF NOT EXISTS `orders` (`id` varchar(14),`status` varchar(191) NOT NULL,`customer_name` varchar(191) NOT NULL,`phone` longtext NOT NULL,`address` longtext NOT NULL,`subtotal` bigint NOT NULL DEFAULT 0,`tax` bigint NOT NULL DEFAULT 0,`total` bigint NOT NULL DEFAULT 0,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`deleted_by` bigint unsigned,`delete_reason` varchar(200),PRIMARY KEY (`id`),INDEX `idx_orders_status_created` (`status`,`created_at`),INDEX `idx_orders_customer_name` (`customer_name`),INDEX `idx_orders_total` (`total`),INDEX `idx_orders_created_at` (`created_at`),INDEX `idx_orders_updated_at` (`updated_at`),INDEX `idx_orders_deleted_at` (`deleted_at`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `order_items` (`id` varchar(14),`order_id` varchar(14) NOT NULL,`size` longtext NOT NULL,`pizza` longtext NOT NULL,`instructions` longtext,`quantity` bigint NOT NULL DEFAULT 1,`unit_price` bigint NOT NULL DEFAULT 0,`line_total` bigint NOT NULL DEFAULT 0,PRIMARY KEY (`id`),INDEX `idx_order_items_order_id` (`order_id`),CONSTRAINT `fk_orders_items` FOREIGN KEY (`order_id`) REFERENCES `orders`(`id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `order_status_events` (`id` bigint unsigned AUTO_INCREMENT,`order_id` varchar(14) NOT NULL,`from_status` longtext,`to_status` longtext NOT NULL,`user_id` bigint unsigned,`note` varchar(200),`created_at` datetime(3) NULL,PRIMARY KEY (`id`),INDEX `idx_order_status_events_order_id` (`order_id`),INDEX `idx_order_status_events_created_at` (`created_at`),CONSTRAINT `fk_orders_status_events` FOREIGN KEY (`order_id`) REFERENCES `orders`(`id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `users` (`id` bigint unsigned AUTO_INCREMENT,`username` varchar(191) NOT NULL,`password` longtext NOT NULL,`role` varchar(20) NOT NULL DEFAULT 'viewer',`disabled` boolean NOT NULL DEFAULT false,`disabled_at` datetime(3) NULL,`totp_secret` varchar(64),`totp_enabled` boolean NOT NULL DEFAULT false,`totp_last_step` bigint NOT NULL DEFAULT 0,PRIMARY KEY (`id`),UNIQUE INDEX `idx_users_username` (`username`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `login_attempts` (`id` bigint unsigned AUTO_INCREMENT,`username` varchar(50) NOT NULL,`user_id` bigint unsigned,`ip` varchar(45) NOT NULL,`result` varchar(20) NOT NULL,`created_at` datetime(3) NULL,PRIMARY KEY (`id`),INDEX `idx_login_attempts_username` (`username`),INDEX `idx_login_attempts_ip` (`ip`),INDEX `idx_login_attempts_created_at` (`created_at`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `login_throttles` (`throttle_key` varchar(80),`failures` bigint NOT NULL,`last_failure_at` datetime(3) NULL,`locked_until` datetime(3) NULL,PRIMARY KEY (`throttle_key`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (`id` bigint unsigned AUTO_INCREMENT,`user_id` bigint unsigned NOT NULL,`code_hash` varchar(64) NOT NULL,`used_at` datetime(3) NULL,`created_at` datetime(3) NULL,PRIMARY KEY (`id`),INDEX `idx_recovery_codes_user_id` (`user_id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `two_factor_roles` (`role` varchar(20),`created_at` datetime(3) NULL,PRIMARY KEY (`role`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `api_tokens` (`id` bigint unsigned AUTO_INCREMENT,`user_id` bigint unsigned NOT NULL,`name` varchar(100) NOT NULL,`hint` varchar(20) NOT NULL,`token_hash` varchar(64) NOT NULL,`scopes` varchar(500) NOT NULL,`expires_at` datetime(3) NOT NULL,`last_used_at` datetime(3) NULL,`revoked_at` datetime(3) NULL,`created_at` datetime(3) NULL,PRIMARY KEY (`id`),INDEX `idx_api_tokens_user_id` (`user_id`),UNIQUE INDEX `idx_api_tokens_token_hash` (`token_hash`),CONSTRAINT `fk_api_tokens_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `user_sessions` (`id` bigint unsigned AUTO_INCREMENT,`session_id` varchar(64) NOT NULL,`user_id` bigint unsigned NOT NULL,`ip` varchar(64),`user_agent` varchar(255),`created_at` datetime(3) NULL,`last_seen_at` datetime(3) NULL,PRIMARY KEY (`id`),UNIQUE INDEX `idx_user_sessions_session_id` (`session_id`),INDEX `idx_user_sessions_user_id` (`user_id`),CONSTRAINT `fk_user_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `idempotency_keys` (`idempotency_key` varchar(300),`request_hash` varchar(64) NOT NULL,`order_id` longtext NOT NULL,`created_at` datetime(3) NULL,`expires_at` datetime(3) NOT NULL,PRIMARY KEY (`idempotency_key`),INDEX `idx_idempotency_keys_expires_at` (`expires_at`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `archived_orders` (`id` varchar(14),`status` longtext NOT NULL,`customer_name` varchar(191) NOT NULL,`phone` varchar(191) NOT NULL,`address` longtext NOT NULL,`subtotal` bigint NOT NULL DEFAULT 0,`tax` bigint NOT NULL DEFAULT 0,`total` bigint NOT NULL DEFAULT 0,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`archived_at` datetime(3) NOT NULL,PRIMARY KEY (`id`),INDEX `idx_archived_orders_customer_name` (`customer_name`),INDEX `idx_archived_orders_phone` (`phone`),INDEX `idx_archived_orders_created_at` (`created_at`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `archived_order_items` (`id` varchar(14),`order_id` varchar(14) NOT NULL,`size` longtext NOT NULL,`pizza` longtext NOT NULL,`instructions` longtext,`quantity` bigint NOT NULL DEFAULT 1,`unit_price` bigint NOT NULL DEFAULT 0,`line_total` bigint NOT NULL DEFAULT 0,PRIMARY KEY (`id`),INDEX `idx_archived_order_items_order_id` (`order_id`),CONSTRAINT `fk_archived_orders_items` FOREIGN KEY (`order_id`) REFERENCES `archived_orders`(`id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `archived_order_status_events` (`id` bigint unsigned AUTO_INCREMENT,`order_id` varchar(14) NOT NULL,`from_status` longtext,`to_status` longtext NOT NULL,`user_id` bigint unsigned,`note` varchar(200),`created_at` datetime(3) NULL,PRIMARY KEY (`id`),INDEX `idx_archived_order_status_events_order_id` (`order_id`),CONSTRAINT `fk_archived_orders_status_events` FOREIGN KEY (`order_id`) REFERENCES `archived_orders`(`id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `products` (`id` bigint unsigned AUTO_INCREMENT,`name` varchar(100) NOT NULL,`description` varchar(500),`active` boolean NOT NULL,`sort_order` bigint NOT NULL,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,PRIMARY KEY (`id`),UNIQUE INDEX `idx_products_name` (`name`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `product_sizes` (`id` bigint unsigned AUTO_INCREMENT,`name` varchar(100) NOT NULL,`description` varchar(500),`active` boolean NOT NULL,`sort_order` bigint NOT NULL,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,PRIMARY KEY (`id`),UNIQUE INDEX `idx_product_sizes_name` (`name`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `product_prices` (`id` bigint unsigned AUTO_INCREMENT,`product_id` bigint unsigned NOT NULL,`product_size_id` bigint unsigned NOT NULL,`price` bigint NOT NULL,`updated_at` datetime(3) NULL,PRIMARY KEY (`id`),UNIQUE INDEX `idx_product_prices_product_size` (`product_id`,`product_size_id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,18 @@
+-- 刪除所有資料表 (資料會一起刪除)，依相依順序反向刪除
+DROP TABLE IF EXISTS "product_prices";
+DROP TABLE IF EXISTS "product_sizes";
+DROP TABLE IF EXISTS "products";
+DROP TABLE IF EXISTS "archived_order_status_events";
+DROP TABLE IF EXISTS "archived_order_items";
+DROP TABLE IF EXISTS "archived_orders";
+DROP TABLE IF EXISTS "idempotency_keys";
+DROP TABLE IF EXISTS "user_sessions";
+DROP TABLE IF EXISTS "api_tokens";
+DROP TABLE IF EXISTS "two_factor_roles";
+DROP TABLE IF EXISTS "recovery_codes";
+DROP TABLE IF EXISTS "login_throttles";
+DROP TABLE IF EXISTS "login_attempts";
+DROP TABLE IF EXISTS "users";
+DROP TABLE IF EXISTS "order_status_events";
+DROP TABLE IF EXISTS "order_items";
+DROP TABLE IF EXISTS "orders";
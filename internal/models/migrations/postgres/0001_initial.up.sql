@@ -0,0 +1,63 @@
+-- 基準版本: 與 sqlite/0001_initial.up.sql 相同的資料表，欄位型別依 GORM 的 postgres driver 產生
+-- gormstore 的 sessions 資料表由套件自己建立，不在這裡
+
+CREATE TABLE IF NOT EXISTS "orders" ("id" varchar(14),"status" text NOT NULL,"customer_name" text NOT NULL,"phone" text NOT NULL,"address" text NOT NULL,"subtotal" bigint NOT NULL DEFAULT 0,"tax" bigint NOT NULL DEFAULT 0,"total" bigint NOT NULL DEFAULT 0,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"deleted_by" bigint,"delete_reason" varchar(200),PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_orders_deleted_at" ON "orders" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_orders_updated_at" ON "orders" ("updated_at");
+CREATE INDEX IF NOT EXISTS "idx_orders_created_at" ON "orders" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_orders_total" ON "orders" ("total");
+CREATE INDEX IF NOT EXISTS "idx_orders_customer_name" ON "orders" ("customer_name");
+CREATE INDEX IF NOT EXISTS "idx_orders_status_created" ON "orders" ("status","created_at");
+
+CREATE TABLE IF NOT EXISTS "order_items" ("id" varchar(14),"order_id" varchar(14) NOT NULL,"size" text NOT NULL,"pizza" text NOT NULL,"instructions" text,"quantity" bigint NOT NULL DEFAULT 1,"unit_price" bigint NOT NULL DEFAULT 0,"line_total" bigint NOT NULL DEFAULT 0,PRIMARY KEY ("id"),CONSTRAINT "fk_orders_items" FOREIGN KEY ("order_id") REFERENCES "orders"("id"));
+CREATE INDEX IF NOT EXISTS "idx_order_items_order_id" ON "order_items" ("order_id");
+
+CREATE TABLE IF NOT EXISTS "order_status_events" ("id" bigserial,"order_id" varchar(14) NOT NULL,"from_status" text,"to_status" text NOT NULL,"user_id" bigint,"note" varchar(200),"created_at" timestamptz,PRIMARY KEY ("id"),CONSTRAINT "fk_orders_status_events" FOREIGN KEY ("order_id") REFERENCES "orders"("id"));
+CREATE INDEX IF NOT EXISTS "idx_order_status_events_created_at" ON "order_status_events" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_order_status_events_order_id" ON "order_status_events" ("order_id");
+
+CREATE TABLE IF NOT EXISTS "users" ("id" bigserial,"username" text NOT NULL,"password" text NOT NULL,"role" varchar(20) NOT NULL DEFAULT 'viewer',"disabled" boolean NOT NULL DEFAULT false,"disabled_at" timestamptz,"totp_secret" varchar(64),"totp_enabled" boolean NOT NULL DEFAULT false,"totp_last_step" bigint NOT NULL DEFAULT 0,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_username" ON "users" ("username");
+
+CREATE TABLE IF NOT EXISTS "login_attempts" ("id" bigserial,"username" varchar(50) NOT NULL,"user_id" bigint,"ip" varchar(45) NOT NULL,"result" varchar(20) NOT NULL,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_login_attempts_created_at" ON "login_attempts" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_login_attempts_ip" ON "login_attempts" ("ip");
+CREATE INDEX IF NOT EXISTS "idx_login_attempts_username" ON "login_attempts" ("username");
+
+CREATE TABLE IF NOT EXISTS "login_throttles" ("throttle_key" varchar(80),"failures" bigint NOT NULL,"last_failure_at" timestamptz,"locked_until" timestamptz,PRIMARY KEY ("throttle_key"));
+
+CREATE TABLE IF NOT EXISTS "recovery_codes" ("id" bigserial,"user_id" bigint NOT NULL,"code_hash" varchar(64) NOT NULL,"used_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "two_factor_roles" ("role" varchar(20),"created_at" timestamptz,PRIMARY KEY ("role"));
+
+CREATE TABLE IF NOT EXISTS "api_tokens" ("id" bigserial,"user_id" bigint NOT NULL,"name" varchar(100) NOT NULL,"hint" varchar(20) NOT NULL,"token_hash" varchar(64) NOT NULL,"scopes" varchar(500) NOT NULL,"expires_at" timestamptz NOT NULL,"last_used_at" timestamptz,"revoked_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"),CONSTRAINT "fk_api_tokens_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_tokens_token_hash" ON "api_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_api_tokens_user_id" ON "api_tokens" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "user_sessions" ("id" bigserial,"session_id" varchar(64) NOT NULL,"user_id" bigint NOT NULL,"ip" varchar(64),"user_agent" varchar(255),"created_at" timestamptz,"last_seen_at" timestamptz,PRIMARY KEY ("id"),CONSTRAINT "fk_user_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"));
+CREATE INDEX IF NOT EXISTS "idx_user_sessions_user_id" ON "user_sessions" ("user_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_sessions_session_id" ON "user_sessions" ("session_id");
+
+CREATE TABLE IF NOT EXISTS "idempotency_keys" ("idempotency_key" varchar(300),"request_hash" varchar(64) NOT NULL,"order_id" text NOT NULL,"created_at" timestamptz,"expires_at" timestamptz NOT NULL,PRIMARY KEY ("idempotency_key"));
+CREATE INDEX IF NOT EXISTS "idx_idempotency_keys_expires_at" ON "idempotency_keys" ("expires_at");
+
+CREATE TABLE IF NOT EXISTS "archived_orders" ("id" varchar(14),"status" text NOT NULL,"customer_name" text NOT NULL,"phone" text NOT NULL,"address" text NOT NULL,"subtotal" bigint NOT NULL DEFAULT 0,"tax" bigint NOT NULL DEFAULT 0,"total" bigint NOT NULL DEFAULT 0,"created_at" timestamptz,"updated_at" timestamptz,"archived_at" timestamptz NOT NULL,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_archived_orders_created_at" ON "archived_orders" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_archived_orders_phone" ON "archived_orders" ("phone");
+CREATE INDEX IF NOT EXISTS "idx_archived_orders_customer_name" ON "archived_orders" ("customer_name");
+
+CREATE TABLE IF NOT EXISTS "archived_order_items" ("id" varchar(14),"order_id" varchar(14) NOT NULL,"size" text NOT NULL,"pizza" text NOT NULL,"instructions" text,"quantity" bigint NOT NULL DEFAULT 1,"unit_price" bigint NOT NULL DEFAULT 0,"line_total" bigint NOT NULL DEFAULT 0,PRIMARY KEY ("id"),CONSTRAINT "fk_archived_orders_items" FOREIGN KEY ("order_id") REFERENCES "archived_orders"("id"));
+CREATE INDEX IF NOT EXISTS "idx_archived_order_items_order_id" ON "archived_order_items" ("order_id");
+
+CREATE TABLE IF NOT EXISTS "archived_order_status_events" ("id" bigserial,"order_id" varchar(14) NOT NULL,"from_status" text,"to_status" text NOT NULL,"user_id" bigint,"note" varchar(200),"created_at" timestamptz,PRIMARY KEY ("id"),CONSTRAINT "fk_archived_orders_status_events" FOREIGN KEY ("order_id") REFERENCES "archived_orders"("id"));
+CREATE INDEX IF NOT EXISTS "idx_archived_order_status_events_order_id" ON "archived_order_status_events" ("order_id");
+
+CREATE TABLE IF NOT EXISTS "products" ("id" bigserial,"name" varchar(100) NOT NULL,"description" varchar(500),"active" boolean NOT NULL,"sort_order" bigint NOT NULL,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_products_name" ON "products" ("name");
+
+CREATE TABLE IF NOT EXISTS "product_sizes" ("id" bigserial,"name" varchar(100) NOT NULL,"description" varchar(500),"active" boolean NOT NULL,"sort_order" bigint NOT NULL,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_product_sizes_name" ON "product_sizes" ("name");
+
+CREATE TABLE IF NOT EXISTS "product_prices" ("id" bigserial,"product_id" bigint NOT NULL,"product_size_id" bigint NOT NULL,"price" bigint NOT NULL,"updated_at" timestamptz,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_product_prices_product_size" ON "product_prices" ("product_id","product_size_id");
@@ -0,0 +1,64 @@
+-- 基準版本: 與改用 migration 前最後一版 AutoMigrate 建立的資料表相同
+-- 全部使用 IF NOT EXISTS，舊的資料庫 (沒有 schema_migrations) 執行後只會補上缺少的資料表，不會出錯
+-- gormstore 的 sessions 資料表由套件自己建立，不在這裡
+
+CREATE TABLE IF NOT EXISTS `orders` (`id` text,`status` text NOT NULL,`customer_name` text NOT NULL,`phone` text NOT NULL,`address` text NOT NULL,`subtotal` integer NOT NULL DEFAULT 0,`tax` integer NOT NULL DEFAULT 0,`total` integer NOT NULL DEFAULT 0,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`deleted_by` integer,`delete_reason` text,PRIMARY KEY (`id`));
+CREATE INDEX IF NOT EXISTS `idx_orders_deleted_at` ON `orders`(`deleted_at`);
+CREATE INDEX IF NOT EXISTS `idx_orders_updated_at` ON `orders`(`updated_at`);
+CREATE INDEX IF NOT EXISTS `idx_orders_created_at` ON `orders`(`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_orders_total` ON `orders`(`total`);
+CREATE INDEX IF NOT EXISTS `idx_orders_customer_name` ON `orders`(`customer_name`);
+CREATE INDEX IF NOT EXISTS `idx_orders_status_created` ON `orders`(`status`,`created_at`);
+
+CREATE TABLE IF NOT EXISTS `order_items` (`id` text,`order_id` text NOT NULL,`size` text NOT NULL,`pizza` text NOT NULL,`instructions` text,`quantity` integer NOT NULL DEFAULT 1,`unit_price` integer NOT NULL DEFAULT 0,`line_total` integer NOT NULL DEFAULT 0,PRIMARY KEY (`id`),CONSTRAINT `fk_orders_items` FOREIGN KEY (`order_id`) REFERENCES `orders`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_order_items_order_id` ON `order_items`(`order_id`);
+
+CREATE TABLE IF NOT EXISTS `order_status_events` (`id` integer PRIMARY KEY AUTOINCREMENT,`order_id` text NOT NULL,`from_status` text,`to_status` text NOT NULL,`user_id` integer,`note` text,`created_at` datetime,CONSTRAINT `fk_orders_status_events` FOREIGN KEY (`order_id`) REFERENCES `orders`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_order_status_events_created_at` ON `order_status_events`(`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_order_status_events_order_id` ON `order_status_events`(`order_id`);
+
+CREATE TABLE IF NOT EXISTS `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`username` text NOT NULL,`password` text NOT NULL,`role` text NOT NULL DEFAULT "viewer",`disabled` numeric NOT NULL DEFAULT false,`disabled_at` datetime,`totp_secret` text,`totp_enabled` numeric NOT NULL DEFAULT false,`totp_last_step` integer NOT NULL DEFAULT 0);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_username` ON `users`(`username`);
+
+CREATE TABLE IF NOT EXISTS `login_attempts` (`id` integer PRIMARY KEY AUTOINCREMENT,`username` text NOT NULL,`user_id` integer,`ip` text NOT NULL,`result` text NOT NULL,`created_at` datetime);
+CREATE INDEX IF NOT EXISTS `idx_login_attempts_created_at` ON `login_attempts`(`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_login_attempts_ip` ON `login_attempts`(`ip`);
+CREATE INDEX IF NOT EXISTS `idx_login_attempts_username` ON `login_attempts`(`username`);
+
+CREATE TABLE IF NOT EXISTS `login_throttles` (`throttle_key` text,`failures` integer NOT NULL,`last_failure_at` datetime,`locked_until` datetime,PRIMARY KEY (`throttle_key`));
+
+CREATE TABLE IF NOT EXISTS `recovery_codes` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer NOT NULL,`code_hash` text NOT NULL,`used_at` datetime,`created_at` datetime);
+CREATE INDEX IF NOT EXISTS `idx_recovery_codes_user_id` ON `recovery_codes`(`user_id`);
+
+CREATE TABLE IF NOT EXISTS `two_factor_roles` (`role` text,`created_at` datetime,PRIMARY KEY (`role`));
+
+CREATE TABLE IF NOT EXISTS `api_tokens` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer NOT NULL,`name` text NOT NULL,`hint` text NOT NULL,`token_hash` text NOT NULL,`scopes` text NOT NULL,`expires_at` datetime NOT NULL,`last_used_at` datetime,`revoked_at` datetime,`created_at` datetime,CONSTRAINT `fk_api_tokens_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_api_tokens_token_hash` ON `api_tokens`(`token_hash`);
+CREATE INDEX IF NOT EXISTS `idx_api_tokens_user_id` ON `api_tokens`(`user_id`);
+
+CREATE TABLE IF NOT EXISTS `user_sessions` (`id` integer PRIMARY KEY AUTOINCREMENT,`session_id` text NOT NULL,`user_id` integer NOT NULL,`ip` text,`user_agent` text,`created_at` datetime,`last_seen_at` datetime,CONSTRAINT `fk_user_sessions_user` FOREIGN KEY (`user_id`) REFERENCES `users`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_user_sessions_user_id` ON `user_sessions`(`user_id`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_user_sessions_session_id` ON `user_sessions`(`session_id`);
+
+CREATE TABLE IF NOT EXISTS `idempotency_keys` (`idempotency_key` text,`request_hash` text NOT NULL,`order_id` text NOT NULL,`created_at` datetime,`expires_at` datetime NOT NULL,PRIMARY KEY (`idempotency_key`));
+CREATE INDEX IF NOT EXISTS `idx_idempotency_keys_expires_at` ON `idempotency_keys`(`expires_at`);
+
+CREATE TABLE IF NOT EXISTS `archived_orders` (`id` text,`status` text NOT NULL,`customer_name` text NOT NULL,`phone` text NOT NULL,`address` text NOT NULL,`subtotal` integer NOT NULL DEFAULT 0,`tax` integer NOT NULL DEFAULT 0,`total` integer NOT NULL DEFAULT 0,`created_at` datetime,`updated_at` datetime,`archived_at` datetime NOT NULL,PRIMARY KEY (`id`));
+CREATE INDEX IF NOT EXISTS `idx_archived_orders_created_at` ON `archived_orders`(`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_archived_orders_phone` ON `archived_orders`(`phone`);
+CREATE INDEX IF NOT EXISTS `idx_archived_orders_customer_name` ON `archived_orders`(`customer_name`);
+
+CREATE TABLE IF NOT EXISTS `archived_order_items` (`id` text,`order_id` text NOT NULL,`size` text NOT NULL,`pizza` text NOT NULL,`instructions` text,`quantity` integer NOT NULL DEFAULT 1,`unit_price` integer NOT NULL DEFAULT 0,`line_total` integer NOT NULL DEFAULT 0,PRIMARY KEY (`id`),CONSTRAINT `fk_archived_orders_items` FOREIGN KEY (`order_id`) REFERENCES `archived_orders`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_archived_order_items_order_id` ON `archived_order_items`(`order_id`);
+
+CREATE TABLE IF NOT EXISTS `archived_order_status_events` (`id` integer PRIMARY KEY AUTOINCREMENT,`order_id` text NOT NULL,`from_status` text,`to_status` text NOT NULL,`user_id` integer,`note` text,`created_at` datetime,CONSTRAINT `fk_archived_orders_status_events` FOREIGN KEY (`order_id`) REFERENCES `archived_orders`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_archived_order_status_events_order_id` ON `archived_order_status_events`(`order_id`);
+
+CREATE TABLE IF NOT EXISTS `products` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text NOT NULL,`description` text,`active` numeric NOT NULL,`sort_order` integer NOT NULL,`created_at` datetime,`updated_at` datetime);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_products_name` ON `products`(`name`);
+
+CREATE TABLE IF NOT EXISTS `product_sizes` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text NOT NULL,`description` text,`active` numeric NOT NULL,`sort_order` integer NOT NULL,`created_at` datetime,`updated_at` datetime);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_product_sizes_name` ON `product_sizes`(`name`);
+
+CREATE TABLE IF NOT EXISTS `product_prices` (`id` integer PRIMARY KEY AUTOINCREMENT,`product_id` integer NOT NULL,`product_size_id` integer NOT NULL,`price` integer NOT NULL,`updated_at` datetime);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_product_prices_product_size` ON `product_prices`(`product_id`,`product_size_id`);
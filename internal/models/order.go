@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/teris-io/shortid" // https://bbs.itying.com/topic/687b507f4715aa008848880f ex: iNove6iQ9J / NVDve6-9Q
@@ -28,13 +29,14 @@ import (
 
 // 修改後
 var (
-	OrderStatues = []string{"已成功下單", "製作中", "已完成（待交付)", "交付失敗／逾期", "已交付（完成交貨)"}
+	OrderStatues = []string{StatusPlaced, StatusPreparing, StatusReady, StatusFailed, StatusDelivered}
 
+	// PizzaTypes / PizzaSizes => 只在資料庫菜單是空的時候，當作預設菜單寫入 (CatalogModel.SeedDefaults)
+	// 實際可下單的品項以資料庫的 products / product_sizes 為準
 	PizzaTypes = []string{
 		"黃色纖細藥水",
 		"白色纖細藥水",
 	}
-	// PizzaSizes 可以在 order.tmpl 的時候使用 透過 {{ range .PizzaSizes }}
 	PizzaSizes = []string{
 		"半倉",
 		"一倉",
@@ -80,17 +82,29 @@ type OrderModel struct {
 */
 
 // 這裡大寫的ID / Items 其實是欄位名稱
+// 索引對應後台列表 (SearchOrders) 的篩選與排序: 狀態 + 建立時間、更新時間、金額、顧客姓名
+// 關鍵字是前後模糊比對 (LIKE '%x%')，用不到索引，所以電話、地址沒有加
 type Order struct {
 	ID           string `gorm:"primaryKey;size:14" json:"id"`
-	Status       string `gorm:"not null" json:"status"`
-	CustomerName string `gorm:"not null" json:"customerName"`
+	Status       string `gorm:"not null;index:idx_orders_status_created,priority:1" json:"status"`
+	CustomerName string `gorm:"not null;index" json:"customerName"`
 	Phone        string `gorm:"not null" json:"phone"`
 	Address      string `gorm:"not null" json:"address"`
 	// 一對多關聯，在 OrderItem 裡有訂單ID (OrderID)，指向的是 Order 裡的 ID (Order.ID)
-	Items     []OrderItem `gorm:"foreignKey:OrderID" json:"items"`
-	CreatedAt time.Time   `json:"createdAt"`
+	Items []OrderItem `gorm:"foreignKey:OrderID" json:"items"`
+	// 金額皆為最小貨幣單位的整數，建立訂單時計算後寫入，之後不會因為菜單改價而變動
+	Subtotal int64 `gorm:"not null;default:0" json:"subtotal"`
+	Tax      int64 `gorm:"not null;default:0" json:"tax"`
+	Total    int64 `gorm:"not null;default:0;index" json:"total"`
+	// 狀態歷程，依時間排序，第一筆是下單時的「已成功下單」
+	StatusEvents []OrderStatusEvent `gorm:"foreignKey:OrderID" json:"statusEvents,omitempty"`
+	CreatedAt    time.Time          `gorm:"index;index:idx_orders_status_created,priority:2" json:"createdAt"`
 	// 更新狀態時間
-	UpdatedAt time.Time `json:"updatedAt"`
+	UpdatedAt time.Time `gorm:"index" json:"updatedAt"`
+	// 軟刪除: 有值代表在垃圾桶裡，GORM 的查詢預設會排除，見 order_trash.go
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deletedAt,omitzero"`
+	DeletedBy    *uint          `json:"deletedBy,omitempty"` // 刪除者的 User.ID
+	DeleteReason string         `gorm:"size:200" json:"deleteReason,omitempty"`
 }
 
 type OrderItem struct {
@@ -103,6 +117,43 @@ type OrderItem struct {
 	Size         string `gorm:"not null" json:"size"`
 	Pizza        string `gorm:"not null" json:"pizza"`
 	Instructions string `json:"instructions"`
+	Quantity     int    `gorm:"not null;default:1" json:"quantity"`
+	// 下單當下的單價快照，LineTotal = UnitPrice * Quantity
+	UnitPrice int64 `gorm:"not null;default:0" json:"unitPrice"`
+	LineTotal int64 `gorm:"not null;default:0" json:"lineTotal"`
+}
+
+// ComputeTotals 依明細的 LineTotal 計算小計、稅金與總額
+// taxRateBps => 稅率，以萬分之一為單位 (500 = 5%)，稅金四捨五入到最小貨幣單位
+func (o *Order) ComputeTotals(taxRateBps int64) {
+	var subtotal int64
+	for _, item := range o.Items {
+		subtotal += item.LineTotal
+	}
+	o.Subtotal = subtotal
+	o.Tax = (subtotal*taxRateBps + 5000) / 10000
+	o.Total = o.Subtotal + o.Tax
+}
+
+// 每次訂單狀態變更都寫一筆，用來回答「我的訂單什麼時候開始製作」這類問題
+// From 為空字串代表訂單剛建立；UserID 為 nil 代表不是後台人員觸發 (例如顧客下單、系統排程)
+type OrderStatusEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	OrderID    string    `gorm:"size:14;index;not null" json:"orderId"`
+	FromStatus string    `json:"from"`
+	ToStatus   string    `gorm:"not null" json:"to"`
+	UserID     *uint     `json:"userId,omitempty"`
+	Note       string    `gorm:"size:200" json:"note,omitempty"`
+	CreatedAt  time.Time `gorm:"index" json:"createdAt"`
+}
+
+// StatusChange => UpdateOrderStatus 需要的資訊，除了新狀態，也記錄是誰、為什麼改
+type StatusChange struct {
+	To     string
+	Actor  Actor
+	Role   Role // Actor 為 ActorStaff 時，登入者的角色
+	UserID *uint
+	Note   string
 }
 
 // 在 db.Create() 操作之前，這些 hook 都會自動被呼叫 (hook ex: BeforeCreate / AfterCreate / CreateOrder 等等)
@@ -121,7 +172,11 @@ func (oi *OrderItem) BeforeCreate(tx *gorm.DB) error {
 }
 
 // 執行實際的 SQL INSERT 語句到資料庫（這才是真正的「CreateOrder」完成的部分），所以會在 BeforeCreate 之後發生
+// 同時寫入第一筆狀態歷程 (空 → 初始狀態)，GORM 會連同 Items / StatusEvents 一起建立
 func (o *OrderModel) CreateOrder(order *Order) error {
+	if len(order.StatusEvents) == 0 {
+		order.StatusEvents = []OrderStatusEvent{{ToStatus: order.Status}}
+	}
 	return o.DB.Create(order).Error
 }
 
@@ -129,36 +184,90 @@ func (o *OrderModel) GetOrder(id string) (*Order, error) {
 	var order Order
 	// 每一筆 OrderItem 的顧客訂單，都可以透過 id 去查詢
 	// 所以如果前端提供了id給後端查詢，但id不存在，就會回傳錯誤
-	err := o.DB.Preload("Items").First(&order, "id = ?", id).Error
-	return &order, err
-}
-
-func (o *OrderModel) GetAllOrders() ([]Order, error) {
-	var orders []Order
 	err := o.DB.
 		Preload("Items").
-		Order("created_at DESC"). // 依建立時間由新到舊，CreatedAt 是 GORM 內建追蹤時間欄位名稱
-		Find(&orders).Error
-	return orders, err
+		Preload("StatusEvents", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC, id ASC")
+		}).
+		First(&order, "id = ?", id).Error
+	return &order, err
 }
 
-func (o *OrderModel) UpdateOrderStatus(orderID string, newStatus string) error {
-	err := o.DB.Model(&Order{}).
-		Where("id = ?", orderID).
-		// 一次需要更新多個欄位的時候
-		Updates(map[string]any{
-			"status": newStatus,
-			// "updatedAt": newUpdatedAt, 等status更新完成後才實驗更新updatedAt
-		}).Error
+// 狀態變更必須符合 status.go 的轉換表，不合法時回傳 ErrInvalidStatus / *StatusTransitionError
+// 先查出目前狀態再更新，並寫入一筆 OrderStatusEvent，全部放在同一個 transaction
+// 避免同時有兩個 admin 更新時互相覆蓋，或是狀態改了卻沒有歷程
+// 成功時回傳寫入的 OrderStatusEvent (含舊狀態與時間)，給呼叫端發送通知使用
+func (o *OrderModel) UpdateOrderStatus(orderID string, change StatusChange) (*OrderStatusEvent, error) {
+	var event *OrderStatusEvent
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		var order Order
+		if err := tx.Select("id", "status").First(&order, "id = ?", orderID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrderNotFound
+			}
+			return err
+		}
+
+		if err := CheckTransition(order.Status, change.To, change.Actor, change.Role); err != nil {
+			return err
+		}
 
+		now := time.Now()
+		// 條件加上舊狀態，若在查詢後被別人改過，RowsAffected 會是 0
+		result := tx.Model(&Order{}).
+			Where("id = ? AND status = ?", orderID, order.Status).
+			// 一次需要更新多個欄位的時候
+			Updates(map[string]any{
+				"status":     change.To,
+				"updated_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &StatusTransitionError{From: order.Status, To: change.To, Reason: "訂單狀態已被其他人更新，請重新整理"}
+		}
+
+		event = &OrderStatusEvent{
+			OrderID:    orderID,
+			FromStatus: order.Status,
+			ToStatus:   change.To,
+			UserID:     change.UserID,
+			Note:       change.Note,
+			CreatedAt:  now,
+		}
+		return tx.Create(event).Error
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return event, nil
+}
 
-	return nil
+// 查詢某筆訂單的狀態歷程
+func (o *OrderModel) GetStatusEvents(orderID string) ([]OrderStatusEvent, error) {
+	var events []OrderStatusEvent
+	err := o.DB.
+		Where("order_id = ?", orderID).
+		Order("created_at ASC, id ASC").
+		Find(&events).Error
+	return events, err
 }
 
-// delete order
-func (o *OrderModel) DeleteOrder(id string) error {
-	return o.DB.Where("id = ?", id).Delete(&Order{}).Error
+// delete order => 軟刪除，訂單移到垃圾桶，保留期間內可以還原 (RestoreOrder)
+// userID / reason 記錄是誰、為什麼刪除；找不到訂單 (或已經在垃圾桶) 時回傳 ErrOrderNotFound
+// 用 UpdateColumns 不更新 updated_at，還原後訂單的最後更新時間維持原本的值
+func (o *OrderModel) DeleteOrder(id string, userID *uint, reason string) error {
+	result := o.DB.Model(&Order{}).Where("id = ?", id).UpdateColumns(map[string]any{
+		"deleted_at":    time.Now(),
+		"deleted_by":    userID,
+		"delete_reason": reason,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
 }
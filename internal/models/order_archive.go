@@ -0,0 +1,197 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+訂單封存:
+  - 已結案 (ArchivableStatuses: 送達 / 失敗) 且超過 N 天沒有更新的訂單，由背景工作搬到 archived_* 資料表
+  - 搬移與刪除原本的資料在同一個 transaction，不會出現兩邊都有、或兩邊都沒有的情況
+  - 封存的訂單不會出現在後台訂單列表，但可以用 SearchArchivedOrders (/admin/archive) 依編號、姓名、電話查詢
+  - 封存後不能再修改狀態，也不能還原
+*/
+
+type ArchivedOrder struct {
+	ID           string                     `gorm:"primaryKey;size:14" json:"id"`
+	Status       string                     `gorm:"not null" json:"status"`
+	CustomerName string                     `gorm:"not null;index" json:"customerName"`
+	Phone        string                     `gorm:"not null;index" json:"phone"`
+	Address      string                     `gorm:"not null" json:"address"`
+	Items        []ArchivedOrderItem        `gorm:"foreignKey:OrderID" json:"items"`
+	Subtotal     int64                      `gorm:"not null;default:0" json:"subtotal"`
+	Tax          int64                      `gorm:"not null;default:0" json:"tax"`
+	Total        int64                      `gorm:"not null;default:0" json:"total"`
+	StatusEvents []ArchivedOrderStatusEvent `gorm:"foreignKey:OrderID" json:"statusEvents,omitempty"`
+	CreatedAt    time.Time                  `gorm:"index" json:"createdAt"`
+	UpdatedAt    time.Time                  `json:"updatedAt"`
+	ArchivedAt   time.Time                  `gorm:"not null" json:"archivedAt"`
+}
+
+// 欄位與 OrderItem 相同，ID 沿用原本的值
+type ArchivedOrderItem struct {
+	ID           string `gorm:"primaryKey;size:14" json:"id"`
+	OrderID      string `gorm:"size:14;index;not null" json:"order_id"`
+	Size         string `gorm:"not null" json:"size"`
+	Pizza        string `gorm:"not null" json:"pizza"`
+	Instructions string `json:"instructions"`
+	Quantity     int    `gorm:"not null;default:1" json:"quantity"`
+	UnitPrice    int64  `gorm:"not null;default:0" json:"unitPrice"`
+	LineTotal    int64  `gorm:"not null;default:0" json:"lineTotal"`
+}
+
+// 欄位與 OrderStatusEvent 相同，ID 沿用原本的值
+type ArchivedOrderStatusEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	OrderID    string    `gorm:"size:14;index;not null" json:"orderId"`
+	FromStatus string    `json:"from"`
+	ToStatus   string    `gorm:"not null" json:"to"`
+	UserID     *uint     `json:"userId,omitempty"`
+	Note       string    `gorm:"size:200" json:"note,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func newArchivedOrder(order Order, archivedAt time.Time) ArchivedOrder {
+	archived := ArchivedOrder{
+		ID:           order.ID,
+		Status:       order.Status,
+		CustomerName: order.CustomerName,
+		Phone:        order.Phone,
+		Address:      order.Address,
+		Subtotal:     order.Subtotal,
+		Tax:          order.Tax,
+		Total:        order.Total,
+		CreatedAt:    order.CreatedAt,
+		UpdatedAt:    order.UpdatedAt,
+		ArchivedAt:   archivedAt,
+	}
+	for _, item := range order.Items {
+		archived.Items = append(archived.Items, ArchivedOrderItem(item))
+	}
+	for _, event := range order.StatusEvents {
+		archived.StatusEvents = append(archived.StatusEvents, ArchivedOrderStatusEvent(event))
+	}
+	return archived
+}
+
+// ArchiveOrders 把已結案且超過 olderThan 沒有更新的訂單搬到封存資料表，回傳封存的數量
+// 垃圾桶裡的訂單不封存，交給 PurgeDeletedOrders 處理
+func (o *OrderModel) ArchiveOrders(olderThan time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var archived int64
+	for {
+		var count int
+		err := o.DB.Transaction(func(tx *gorm.DB) error {
+			var orders []Order
+			err := tx.
+				Preload("Items").
+				Preload("StatusEvents").
+				Where("status IN ? AND updated_at < ?", ArchivableStatuses, cutoff).
+				Order("updated_at ASC, id ASC").
+				Limit(orderBatchSize).
+				Find(&orders).Error
+			if err != nil || len(orders) == 0 {
+				return err
+			}
+
+			now := time.Now()
+			ids := make([]string, len(orders))
+			for i, order := range orders {
+				ids[i] = order.ID
+				archivedOrder := newArchivedOrder(order, now)
+				if err := tx.Create(&archivedOrder).Error; err != nil {
+					return fmt.Errorf("封存訂單 %s 失敗: %w", order.ID, err)
+				}
+			}
+			count = len(orders)
+			return purgeOrders(tx, ids)
+		})
+		if err != nil {
+			return archived, err
+		}
+		archived += int64(count)
+		if count < orderBatchSize {
+			return archived, nil
+		}
+	}
+}
+
+// ArchiveQuery => 查詢封存訂單的條件，零值代表不過濾
+type ArchiveQuery struct {
+	Search string     // 訂單編號完全比對，或姓名、電話部分比對
+	From   *time.Time // 建立時間 >= From
+	To     *time.Time // 建立時間 < To
+	Cursor string     // 上一頁回傳的 NextCursor
+	Limit  int
+}
+
+// ArchivePage => 一頁的封存訂單，NextCursor 為空代表沒有下一頁
+type ArchivePage struct {
+	Orders     []ArchivedOrder `json:"orders"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+// SearchArchivedOrders 查詢封存訂單，依建立時間由新到舊，跟 ListOrders 一樣使用 keyset (cursor) 分頁
+func (o *OrderModel) SearchArchivedOrders(q ArchiveQuery) (*ArchivePage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultOrderPageSize
+	}
+	if limit > MaxOrderPageSize {
+		limit = MaxOrderPageSize
+	}
+
+	db := o.DB.Model(&ArchivedOrder{}).Preload("Items")
+	if q.Search != "" {
+		like, pattern := "LIKE ? "+likeEscape(db), containsPattern(q.Search)
+		db = db.Where("id = ? OR customer_name "+like+" OR phone "+like, q.Search, pattern, pattern)
+	}
+	if q.From != nil {
+		db = db.Where("created_at >= ?", q.From.In(time.Local))
+	}
+	if q.To != nil {
+		db = db.Where("created_at < ?", q.To.In(time.Local))
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeOrderCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("(created_at < ?) OR (created_at = ? AND id < ?)", cursor.Time, cursor.Time, cursor.ID)
+	}
+
+	var orders []ArchivedOrder
+	// 多拿一筆，用來判斷是否還有下一頁
+	if err := db.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	page := &ArchivePage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = encodeOrderCursor(orderCursor{Time: last.CreatedAt, ID: last.ID})
+	}
+	return page, nil
+}
+
+// GetArchivedOrder 查詢單筆封存訂單 (含明細與狀態歷程)，找不到回傳 ErrOrderNotFound
+func (o *OrderModel) GetArchivedOrder(id string) (*ArchivedOrder, error) {
+	var order ArchivedOrder
+	err := o.DB.
+		Preload("Items").
+		Preload("StatusEvents", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC, id ASC")
+		}).
+		First(&order, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestOrder(customer, status string) *Order {
+	return &Order{
+		Status:       status,
+		CustomerName: customer,
+		Phone:        "0912345678",
+		Address:      "台北市信義區",
+		Items:        []OrderItem{{Size: "Medium", Pizza: "Margherita", Quantity: 1, UnitPrice: 30000}},
+		Subtotal:     30000,
+		Total:        30000,
+	}
+}
+
+func TestArchiveOrdersIncludesFailedOrders(t *testing.T) {
+	forEachDB(t, func(t *testing.T, db *DBModel) {
+		orders := &db.Order
+		old := time.Now().AddDate(0, 0, -100)
+
+		byStatus := map[string]*Order{}
+		for _, status := range []string{StatusDelivered, StatusFailed, StatusPreparing} {
+			order := newTestOrder(status, status)
+			if err := orders.CreateOrder(order); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.DB.Model(order).UpdateColumn("updated_at", old).Error; err != nil {
+				t.Fatal(err)
+			}
+			byStatus[status] = order
+		}
+		// 最近才交付的不封存
+		recent := newTestOrder("recent", StatusDelivered)
+		if err := orders.CreateOrder(recent); err != nil {
+			t.Fatal(err)
+		}
+
+		archived, err := orders.ArchiveOrders(90 * 24 * time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if archived != 2 {
+			t.Fatalf("封存 %d 筆，預期 2 筆 (送達、失敗)", archived)
+		}
+		for _, status := range []string{StatusDelivered, StatusFailed} {
+			if _, err := orders.GetArchivedOrder(byStatus[status].ID); err != nil {
+				t.Errorf("%s 的訂單沒有被封存: %v", status, err)
+			}
+		}
+		for _, order := range []*Order{byStatus[StatusPreparing], recent} {
+			if _, err := orders.GetArchivedOrder(order.ID); err != ErrOrderNotFound {
+				t.Errorf("%s 的訂單不應該被封存: %v", order.CustomerName, err)
+			}
+		}
+	})
+}
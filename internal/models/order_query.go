@@ -0,0 +1,279 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultOrderPageSize = 20
+	MaxOrderPageSize     = 100
+)
+
+// 可以排序的欄位 => API 參數名稱對應資料庫欄位，避免直接把前端字串拼進 SQL
+var orderSortColumns = map[string]string{
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+}
+
+var (
+	ErrInvalidCursor = errors.New("無效的分頁 cursor")
+	ErrInvalidSort   = errors.New("不支援的排序欄位")
+)
+
+// OrderQuery => 後台查詢訂單的條件，零值代表不過濾
+type OrderQuery struct {
+	Status string
+	From   *time.Time // 建立時間 >= From
+	To     *time.Time // 建立時間 < To
+	Phone  string     // 部分比對
+	Search string     // 關鍵字，規則見 applyOrderSearch
+	SortBy string     // createdAt / updatedAt，預設 createdAt
+	Desc   bool
+	Cursor string // 上一頁回傳的 NextCursor
+	Limit  int
+}
+
+// OrderPage => 一頁的訂單，NextCursor 為空代表沒有下一頁
+type OrderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// cursor 內容: 最後一筆的排序欄位值 + ID，ID 用來處理同一時間建立的多筆訂單
+type orderCursor struct {
+	Time time.Time `json:"t"`
+	ID   string    `json:"id"`
+}
+
+func encodeOrderCursor(c orderCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeOrderCursor(s string) (orderCursor, error) {
+	var c orderCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// ListOrders 依條件查詢訂單，使用 keyset (cursor) 分頁
+// 與 OFFSET 分頁相比，新訂單進來時不會讓下一頁出現重複或漏掉的資料
+func (o *OrderModel) ListOrders(q OrderQuery) (*OrderPage, error) {
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = "createdAt"
+	}
+	column, ok := orderSortColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSort, sortBy)
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultOrderPageSize
+	}
+	if limit > MaxOrderPageSize {
+		limit = MaxOrderPageSize
+	}
+
+	db := o.DB.Model(&Order{}).Preload("Items")
+	if q.Status != "" {
+		db = db.Where("status = ?", q.Status)
+	}
+	// 資料庫裡的時間以伺服器時區寫入，比較前先轉成同一時區
+	if q.From != nil {
+		db = db.Where("created_at >= ?", q.From.In(time.Local))
+	}
+	if q.To != nil {
+		db = db.Where("created_at < ?", q.To.In(time.Local))
+	}
+	if q.Phone != "" {
+		db = db.Where("phone LIKE ? "+likeEscape(db), containsPattern(q.Phone))
+	}
+	db = applyOrderSearch(db, q.Search)
+
+	direction, cmp := "ASC", ">"
+	if q.Desc {
+		direction, cmp = "DESC", "<"
+	}
+	if q.Cursor != "" {
+		cursor, err := decodeOrderCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(
+			fmt.Sprintf("(%[1]s %[2]s ?) OR (%[1]s = ? AND id %[2]s ?)", column, cmp),
+			cursor.Time, cursor.Time, cursor.ID,
+		)
+	}
+
+	var orders []Order
+	// 多拿一筆，用來判斷是否還有下一頁
+	err := db.
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Limit(limit + 1).
+		Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		sortValue := last.CreatedAt
+		if column == "updated_at" {
+			sortValue = last.UpdatedAt
+		}
+		page.NextCursor = encodeOrderCursor(orderCursor{Time: sortValue, ID: last.ID})
+	}
+	return page, nil
+}
+
+// 確認訂單存在，查不到時回傳 ErrOrderNotFound，讓 handler 可以回 404
+func (o *OrderModel) FindOrder(id string) (*Order, error) {
+	order, err := o.GetOrder(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// 後台訂單列表 (admin.tmpl) 可以排序的欄位，除了時間也可以依金額、顧客姓名排序
+var orderSearchSortColumns = map[string]string{
+	"createdAt":    "created_at",
+	"updatedAt":    "updated_at",
+	"total":        "total",
+	"customerName": "customer_name",
+}
+
+// OrderSearch => 後台訂單列表的查詢條件，零值代表不過濾
+// 與 ListOrders 不同，使用頁碼分頁並回傳總筆數，畫面上可以顯示「第 2 / 15 頁」
+type OrderSearch struct {
+	Search   string // 關鍵字，規則見 applyOrderSearch
+	Status   string
+	From     *time.Time // 建立時間 >= From
+	To       *time.Time // 建立時間 < To
+	SortBy   string     // createdAt / updatedAt / total / customerName，預設 createdAt
+	Desc     bool
+	Page     int // 從 1 開始
+	PageSize int
+}
+
+// OrderSearchResult => 一頁的訂單與符合條件的總筆數
+type OrderSearchResult struct {
+	Orders   []Order `json:"orders"`
+	Total    int64   `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"pageSize"`
+}
+
+// TotalPages 總頁數，沒有資料時為 0
+func (r *OrderSearchResult) TotalPages() int {
+	return int((r.Total + int64(r.PageSize) - 1) / int64(r.PageSize))
+}
+
+// SearchOrders 依條件查詢訂單，使用頁碼 (OFFSET) 分頁
+// 只有目前這一頁的訂單會 Preload 明細，不會一次載入所有訂單的明細
+func (o *OrderModel) SearchOrders(q OrderSearch) (*OrderSearchResult, error) {
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = "createdAt"
+	}
+	column, ok := orderSearchSortColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSort, sortBy)
+	}
+
+	pageSize := q.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultOrderPageSize
+	}
+	if pageSize > MaxOrderPageSize {
+		pageSize = MaxOrderPageSize
+	}
+	page := q.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	db := o.DB.Model(&Order{})
+	if q.Status != "" {
+		db = db.Where("status = ?", q.Status)
+	}
+	if q.From != nil {
+		db = db.Where("created_at >= ?", q.From.In(time.Local))
+	}
+	if q.To != nil {
+		db = db.Where("created_at < ?", q.To.In(time.Local))
+	}
+	db = applyOrderSearch(db, q.Search)
+
+	result := &OrderSearchResult{Page: page, PageSize: pageSize}
+	if err := db.Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	direction := "ASC"
+	if q.Desc {
+		direction = "DESC"
+	}
+	// 加上 id 讓排序值相同的訂單 (例如同金額) 在每一頁的順序固定
+	err := db.Preload("Items").
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&result.Orders).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 關鍵字以空白分隔，每個關鍵字都要出現在訂單編號、顧客姓名、電話、地址或任一明細的備註中 (部分比對)
+// 例如「王 加辣」=> 姓名有「王」而且某個品項備註「加辣」的訂單
+func applyOrderSearch(db *gorm.DB, search string) *gorm.DB {
+	like := "LIKE ? " + likeEscape(db)
+	for _, term := range strings.Fields(search) {
+		pattern := containsPattern(term)
+		db = db.Where(
+			"orders.id = ? OR orders.customer_name "+like+" OR orders.phone "+like+" OR orders.address "+like+" OR "+
+				"EXISTS (SELECT 1 FROM order_items WHERE order_items.order_id = orders.id AND order_items.instructions "+like+")",
+			term, pattern, pattern, pattern, pattern,
+		)
+	}
+	return db
+}
+
+// 使用者輸入的 % 與 _ 只代表字面上的字元，不能當成 LIKE 的萬用字元 (輸入 % 會符合所有訂單)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// 部分比對的 LIKE 條件值，搭配 likeEscape 使用
+func containsPattern(term string) string {
+	return "%" + likeEscaper.Replace(term) + "%"
+}
+
+// 以 \ 作為 LIKE 的跳脫字元；SQLite 沒有預設的跳脫字元，所以一律寫明 ESCAPE
+// MySQL 的字串常值本身也會處理反斜線，所以要寫成 '\\'
+func likeEscape(db *gorm.DB) string {
+	if db.Dialector.Name() == "mysql" {
+		return `ESCAPE '\\'`
+	}
+	return `ESCAPE '\'`
+}
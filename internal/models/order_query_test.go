@@ -0,0 +1,75 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// 關鍵字裡的 % _ \ 只代表字面上的字元，GORM 與 MemoryStore 的結果要相同
+func TestOrderSearchEscapesLikeWildcards(t *testing.T) {
+	forEachOrderStore(t, func(t *testing.T, orders OrderStore) {
+		names := []string{"100%純", "a_b", "axb", `back\slash`, "一般"}
+		for _, customer := range names {
+			order := newTestOrder(customer, StatusPlaced)
+			order.Phone = "09" + customer
+			if err := orders.CreateOrder(order); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for term, want := range map[string][]string{
+			"%": {"100%純"},
+			"_": {"a_b"},
+			`\`: {`back\slash`},
+			"般": {"一般"},
+		} {
+			result, err := orders.SearchOrders(OrderSearch{Search: term, SortBy: "customerName"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := customerNames(result.Orders); !slices.Equal(got, want) {
+				t.Errorf("SearchOrders(%q) = %v，預期 %v", term, got, want)
+			}
+			page, err := orders.ListOrders(OrderQuery{Phone: term})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := customerNames(page.Orders); !slices.Equal(got, want) {
+				t.Errorf("ListOrders(Phone: %q) = %v，預期 %v", term, got, want)
+			}
+		}
+	})
+}
+
+func TestArchiveSearchEscapesLikeWildcards(t *testing.T) {
+	forEachOrderStore(t, func(t *testing.T, orders OrderStore) {
+		for _, customer := range []string{"100%純", "a_b", "axb"} {
+			if err := orders.CreateOrder(newTestOrder(customer, StatusDelivered)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if archived, err := orders.ArchiveOrders(time.Millisecond); err != nil || archived != 3 {
+			t.Fatalf("封存 %d 筆: %v", archived, err)
+		}
+		for term, want := range map[string]int{"%": 1, "_": 1, "b": 2} {
+			page, err := orders.SearchArchivedOrders(ArchiveQuery{Search: term})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Orders) != want {
+				t.Errorf("SearchArchivedOrders(%q) 找到 %d 筆，預期 %d", term, len(page.Orders), want)
+			}
+		}
+	})
+}
+
+func customerNames(orders []Order) []string {
+	names := make([]string, len(orders))
+	for i, order := range orders {
+		names[i] = order.CustomerName
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 狀態轉換規則在 GORM 與 MemoryStore 上要回傳相同的錯誤
+func TestOrderStatusTransitions(t *testing.T) {
+	forEachOrderStore(t, func(t *testing.T, orders OrderStore) {
+		order := newTestOrder("Alice", StatusPlaced)
+		if err := orders.CreateOrder(order); err != nil {
+			t.Fatal(err)
+		}
+		if order.ID == "" {
+			t.Fatal("建立後應該產生訂單編號")
+		}
+		if _, err := orders.GetOrder("missing"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("GetOrder 不存在的訂單: %v", err)
+		}
+		if _, err := orders.FindOrder("missing"); !errors.Is(err, ErrOrderNotFound) {
+			t.Fatalf("FindOrder 不存在的訂單: %v", err)
+		}
+
+		// 外送員不能開始製作
+		var transitionErr *StatusTransitionError
+		if _, err := orders.UpdateOrderStatus(order.ID, StatusChange{To: StatusPreparing, Actor: ActorStaff, Role: RoleDriver}); !errors.As(err, &transitionErr) {
+			t.Fatalf("角色不允許的狀態轉換: %v", err)
+		}
+		if _, err := orders.UpdateOrderStatus(order.ID, StatusChange{To: StatusPreparing, Actor: ActorStaff, Role: RoleKitchen}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := orders.UpdateOrderStatus(order.ID, StatusChange{To: "bogus", Actor: ActorSystem}); !errors.Is(err, ErrInvalidStatus) {
+			t.Fatalf("無效的狀態: %v", err)
+		}
+		if _, err := orders.UpdateOrderStatus(order.ID, StatusChange{To: StatusPlaced, Actor: ActorSystem}); !errors.As(err, &transitionErr) {
+			t.Fatalf("不允許的狀態轉換: %v", err)
+		}
+		if _, err := orders.UpdateOrderStatus("missing", StatusChange{To: StatusPreparing, Actor: ActorSystem}); !errors.Is(err, ErrOrderNotFound) {
+			t.Fatalf("更新不存在的訂單: %v", err)
+		}
+
+		got, err := orders.FindOrder(order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != StatusPreparing || len(got.Items) != 1 {
+			t.Fatalf("訂單 = status %s, %d 筆明細", got.Status, len(got.Items))
+		}
+	})
+}
+
+// 每次狀態變更都寫入一筆歷程，建立訂單時也有一筆 (from 為空)
+func TestOrderStatusHistory(t *testing.T) {
+	forEachOrderStore(t, func(t *testing.T, orders OrderStore) {
+		order := newTestOrder("Alice", StatusPlaced)
+		if err := orders.CreateOrder(order); err != nil {
+			t.Fatal(err)
+		}
+		userID := uint(7)
+		event, err := orders.UpdateOrderStatus(order.ID, StatusChange{To: StatusPreparing, Actor: ActorStaff, Role: RoleKitchen, UserID: &userID, Note: "開始做"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.FromStatus != StatusPlaced || event.ToStatus != StatusPreparing || event.OrderID != order.ID {
+			t.Fatalf("狀態歷程 = %+v", event)
+		}
+		// 失敗的更新不寫入歷程
+		if _, err := orders.UpdateOrderStatus(order.ID, StatusChange{To: StatusPlaced, Actor: ActorSystem}); err == nil {
+			t.Fatal("不允許的狀態轉換應該失敗")
+		}
+
+		got, err := orders.FindOrder(order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.StatusEvents) != 2 {
+			t.Fatalf("歷程 %d 筆，預期 2 筆", len(got.StatusEvents))
+		}
+		if first := got.StatusEvents[0]; first.FromStatus != "" || first.ToStatus != StatusPlaced {
+			t.Fatalf("第一筆歷程 = %+v", first)
+		}
+		if last := got.StatusEvents[1]; last.Note != "開始做" || last.UserID == nil || *last.UserID != userID {
+			t.Fatalf("最後一筆歷程 = %+v", last)
+		}
+	})
+}
+
+// 同一個 key 重送拿到同一筆訂單，內容不同或訂單已刪除時回傳錯誤
+func TestCreateOrderIdempotent(t *testing.T) {
+	forEachOrderStore(t, func(t *testing.T, orders OrderStore) {
+		first, replayed, err := orders.CreateOrderIdempotent("key-1", "hash-a", newTestOrder("Alice", StatusPlaced), time.Hour)
+		if err != nil || replayed {
+			t.Fatalf("第一次: replayed = %v, err = %v", replayed, err)
+		}
+		again, replayed, err := orders.CreateOrderIdempotent("key-1", "hash-a", newTestOrder("Alice", StatusPlaced), time.Hour)
+		if err != nil || !replayed || again.ID != first.ID {
+			t.Fatalf("重送: replayed = %v, err = %v", replayed, err)
+		}
+		if _, _, err := orders.CreateOrderIdempotent("key-1", "hash-b", newTestOrder("Alice", StatusPlaced), time.Hour); !errors.Is(err, ErrIdempotencyKeyReused) {
+			t.Fatalf("同一個 key 不同內容: %v", err)
+		}
+
+		if err := orders.DeleteOrder(first.ID, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := orders.CreateOrderIdempotent("key-1", "hash-a", newTestOrder("Alice", StatusPlaced), time.Hour); !errors.Is(err, ErrIdempotentOrderGone) {
+			t.Fatalf("訂單刪除後重送: %v", err)
+		}
+
+		page, err := orders.ListOrders(OrderQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Orders) != 0 {
+			t.Fatalf("重送不應該建立新訂單，目前有 %d 筆", len(page.Orders))
+		}
+	})
+}
+
+// 刪除、還原與永久刪除在 GORM 與 MemoryStore 上要回傳相同的錯誤
+func TestOrderTrash(t *testing.T) {
+	forEachOrderStore(t, func(t *testing.T, orders OrderStore) {
+		kept := newTestOrder("Kept", StatusPlaced)
+		deleted := newTestOrder("Deleted", StatusPlaced)
+		for _, order := range []*Order{kept, deleted} {
+			if err := orders.CreateOrder(order); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := orders.RestoreOrder(kept.ID, time.Hour); !errors.Is(err, ErrOrderNotDeleted) {
+			t.Fatalf("還原不在垃圾桶的訂單: %v", err)
+		}
+		if err := orders.PurgeOrder(kept.ID); !errors.Is(err, ErrOrderNotDeleted) {
+			t.Fatalf("永久刪除不在垃圾桶的訂單: %v", err)
+		}
+		if err := orders.DeleteOrder("missing", nil, ""); !errors.Is(err, ErrOrderNotFound) {
+			t.Fatalf("刪除不存在的訂單: %v", err)
+		}
+
+		if err := orders.DeleteOrder(deleted.ID, nil, "重複下單"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := orders.FindOrder(deleted.ID); !errors.Is(err, ErrOrderNotFound) {
+			t.Fatalf("垃圾桶的訂單不應該查得到: %v", err)
+		}
+		trash, err := orders.ListDeletedOrders(time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(trash) != 1 || trash[0].ID != deleted.ID || trash[0].DeleteReason != "重複下單" {
+			t.Fatalf("垃圾桶 = %+v", trash)
+		}
+		page, err := orders.ListOrders(OrderQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := customerNames(page.Orders); len(got) != 1 || got[0] != "Kept" {
+			t.Fatalf("訂單列表 = %v", got)
+		}
+
+		restored, err := orders.RestoreOrder(deleted.ID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.DeleteReason != "" || restored.DeletedBy != nil {
+			t.Fatalf("還原後應該清除刪除資訊: %+v", restored)
+		}
+
+		if err := orders.DeleteOrder(deleted.ID, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := orders.PurgeOrder(deleted.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := orders.RestoreOrder(deleted.ID, time.Hour); !errors.Is(err, ErrOrderNotFound) {
+			t.Fatalf("永久刪除後還原: %v", err)
+		}
+		if purged, err := orders.PurgeDeletedOrders(0); err != nil || purged != 0 {
+			t.Fatalf("PurgeDeletedOrders = %d, %v", purged, err)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+訂單的垃圾桶 (軟刪除):
+  - DeleteOrder 只填上 DeletedAt / DeletedBy / DeleteReason，GORM 的查詢預設會排除這些訂單
+  - 保留期間內可以從 /admin/trash 還原，超過保留期間由背景工作永久刪除 (PurgeDeletedOrders)
+  - 永久刪除時一併刪掉明細、狀態歷程與 Idempotency-Key，不會留下孤兒資料
+*/
+
+// 永久刪除 / 封存時每個 transaction 處理的訂單數量，避免一次鎖住太多資料
+const orderBatchSize = 200
+
+var (
+	ErrOrderNotDeleted     = errors.New("訂單不在垃圾桶中")
+	ErrOrderRestoreExpired = errors.New("訂單已超過可還原的保留期間")
+)
+
+// DeletedOrder => 垃圾桶列表的一筆，附上刪除者名稱與可以還原的期限
+type DeletedOrder struct {
+	Order
+	DeletedByName string    `json:"deletedByName"`
+	RestoreUntil  time.Time `json:"restoreUntil"`
+}
+
+// ListDeletedOrders 列出垃圾桶裡的訂單，最近刪除的在前面
+func (o *OrderModel) ListDeletedOrders(retention time.Duration) ([]DeletedOrder, error) {
+	var orders []Order
+	err := o.DB.Unscoped().
+		Preload("Items").
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC, id DESC").
+		Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 刪除者名稱另外查，帳號被刪掉 (或停用) 時仍然顯示得出來
+	var userIDs []uint
+	for _, order := range orders {
+		if order.DeletedBy != nil {
+			userIDs = append(userIDs, *order.DeletedBy)
+		}
+	}
+	names := map[uint]string{}
+	if len(userIDs) > 0 {
+		var users []User
+		if err := o.DB.Select("id", "username").Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			names[user.ID] = user.Username
+		}
+	}
+
+	list := make([]DeletedOrder, len(orders))
+	for i, order := range orders {
+		list[i] = DeletedOrder{Order: order, RestoreUntil: order.DeletedAt.Time.Add(retention)}
+		if order.DeletedBy != nil {
+			list[i].DeletedByName = names[*order.DeletedBy]
+		}
+	}
+	return list, nil
+}
+
+// RestoreOrder 把垃圾桶裡的訂單還原，超過 retention 的不能還原 (等待背景工作永久刪除)
+func (o *OrderModel) RestoreOrder(id string, retention time.Duration) (*Order, error) {
+	order, err := o.findDeletedOrder(id)
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(order.DeletedAt.Time) > retention {
+		return nil, ErrOrderRestoreExpired
+	}
+	result := o.DB.Unscoped().Model(&Order{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		UpdateColumns(map[string]any{
+			"deleted_at":    nil,
+			"deleted_by":    nil,
+			"delete_reason": "",
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	// 查詢後被別人還原或永久刪除
+	if result.RowsAffected == 0 {
+		return nil, ErrOrderNotDeleted
+	}
+	return o.FindOrder(id)
+}
+
+// PurgeOrder 立即永久刪除垃圾桶裡的一筆訂單，不在垃圾桶的訂單要先 DeleteOrder
+func (o *OrderModel) PurgeOrder(id string) error {
+	if _, err := o.findDeletedOrder(id); err != nil {
+		return err
+	}
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		return purgeOrders(tx, []string{id})
+	})
+}
+
+// PurgeDeletedOrders 永久刪除在垃圾桶超過 retention 的訂單，由背景工作定期呼叫，回傳刪除的訂單數量
+// 同時清掉舊版 DeleteOrder (直接刪除 orders) 留下的孤兒明細與狀態歷程
+func (o *OrderModel) PurgeDeletedOrders(retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+	var purged int64
+	for {
+		var ids []string
+		err := o.DB.Unscoped().Model(&Order{}).
+			Where("deleted_at IS NOT NULL AND deleted_at <= ?", cutoff).
+			Limit(orderBatchSize).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return purged, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+		if err := o.DB.Transaction(func(tx *gorm.DB) error { return purgeOrders(tx, ids) }); err != nil {
+			return purged, err
+		}
+		purged += int64(len(ids))
+		if len(ids) < orderBatchSize {
+			break
+		}
+	}
+
+	// 子查詢要用 Unscoped，垃圾桶裡的訂單的明細不算孤兒
+	orderIDs := o.DB.Unscoped().Model(&Order{}).Select("id")
+	if err := o.DB.Where("order_id NOT IN (?)", orderIDs).Delete(&OrderItem{}).Error; err != nil {
+		return purged, err
+	}
+	if err := o.DB.Where("order_id NOT IN (?)", orderIDs).Delete(&OrderStatusEvent{}).Error; err != nil {
+		return purged, err
+	}
+	return purged, nil
+}
+
+// 查詢垃圾桶裡的訂單，不存在回傳 ErrOrderNotFound，存在但沒有被刪除回傳 ErrOrderNotDeleted
+func (o *OrderModel) findDeletedOrder(id string) (*Order, error) {
+	var order Order
+	err := o.DB.Unscoped().Select("id", "deleted_at").First(&order, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !order.DeletedAt.Valid {
+		return nil, ErrOrderNotDeleted
+	}
+	return &order, nil
+}
+
+// 永久刪除訂單與所有關聯資料 (沒有設定 foreign key cascade，要自己刪)
+// 呼叫端負責開 transaction
+func purgeOrders(tx *gorm.DB, ids []string) error {
+	if err := tx.Where("order_id IN ?", ids).Delete(&OrderItem{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("order_id IN ?", ids).Delete(&OrderStatusEvent{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("order_id IN ?", ids).Delete(&IdempotencyKey{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&Order{}).Error
+}
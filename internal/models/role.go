@@ -0,0 +1,58 @@
+package models
+
+import (
+	"errors"
+	"slices"
+)
+
+// Role => 後台使用者的角色，決定可以使用哪些功能
+type Role string
+
+const (
+	RoleOwner   Role = "owner"   // 店主，所有權限，包含管理帳號
+	RoleManager Role = "manager" // 店長，除了管理帳號以外的所有權限
+	RoleKitchen Role = "kitchen" // 廚房，只能把訂單推進到製作中 / 已完成
+	RoleDriver  Role = "driver"  // 外送，只能標記交付結果
+	RoleViewer  Role = "viewer"  // 只能查看訂單，新建立的帳號預設為此角色
+)
+
+// 依權限大小排列，後台的角色下拉選單照這個順序顯示
+var Roles = []Role{RoleOwner, RoleManager, RoleKitchen, RoleDriver, RoleViewer}
+
+// Permission => 一項可以被授權的操作，路由用 RequirePermission 檢查
+type Permission string
+
+const (
+	PermOrderView    Permission = "order:view"    // 查看訂單、接收後台通知
+	PermOrderUpdate  Permission = "order:update"  // 變更訂單狀態 (實際能改成哪些狀態再依 StatusTransitions 判斷)
+	PermOrderDelete  Permission = "order:delete"  // 刪除訂單
+	PermCatalogEdit  Permission = "catalog:edit"  // 菜單與價格管理
+	PermUserManage   Permission = "user:manage"   // 建立 / 停用帳號、重設密碼、調整角色
+	PermSystemStatus Permission = "system:status" // 查看通知連線數等系統狀態
+	PermAuditView    Permission = "audit:view"    // 查看登入紀錄、解除登入鎖定
+)
+
+// 每個角色擁有的權限
+var RolePermissions = map[Role][]Permission{
+	RoleOwner:   {PermOrderView, PermOrderUpdate, PermOrderDelete, PermCatalogEdit, PermUserManage, PermSystemStatus, PermAuditView},
+	RoleManager: {PermOrderView, PermOrderUpdate, PermOrderDelete, PermCatalogEdit, PermSystemStatus},
+	RoleKitchen: {PermOrderView, PermOrderUpdate},
+	RoleDriver:  {PermOrderView, PermOrderUpdate},
+	RoleViewer:  {PermOrderView},
+}
+
+var ErrInvalidRole = errors.New("無效的角色")
+
+func IsValidRole(role Role) bool {
+	return slices.Contains(Roles, role)
+}
+
+// Can 判斷角色是否擁有某項權限，未知的角色一律沒有權限
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(RolePermissions[r], p)
+}
+
+// 角色擁有的所有權限，給 React 前端決定要顯示哪些按鈕
+func (r Role) Permissions() []Permission {
+	return slices.Clone(RolePermissions[r])
+}
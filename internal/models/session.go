@@ -0,0 +1,167 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+後台登入的 session 紀錄:
+  - session 本身存在 gin-contrib/sessions (gormstore) 的 sessions 資料表，內容是加密過的，無法依使用者查詢
+  - 登入成功時另外寫一筆 UserSession，用 SessionID 對應到 sessions.id，記錄登入者、IP、User-Agent
+  - AuthMiddleware 每個請求都確認 UserSession 還在，刪掉這筆就等於遠端登出
+  - 到期時間以 sessions.expires_at 為準 (gormstore 每次 Save 都會往後延)
+*/
+
+// gormstore 預設的資料表名稱，見 createSessionStore
+const gormSessionTable = "sessions"
+
+// LastSeenAt / IP 最多每分鐘更新一次，避免每個請求都寫入資料庫
+const sessionTouchInterval = time.Minute
+
+type UserSession struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	SessionID  string    `gorm:"size:64;uniqueIndex;not null" json:"-"` // 不對外顯示，知道 ID 就能拿去比對 cookie
+	UserID     uint      `gorm:"index;not null" json:"userId"`
+	User       User      `json:"-"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	UserAgent  string    `gorm:"size:255" json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	// 從 sessions 資料表 JOIN 進來，不是這張表的欄位
+	ExpiresAt time.Time `gorm:"->;-:migration" json:"expiresAt"`
+}
+
+var (
+	ErrSessionNotFound = errors.New("登入階段不存在或已經登出")
+	ErrSessionRevoked  = errors.New("登入階段已被登出，請重新登入")
+)
+
+// RecordSession 登入成功後呼叫，同一個 session 重新登入 (換帳號) 時覆蓋原本的紀錄
+func (u *UserModel) RecordSession(sessionID string, userID uint, ip, userAgent string) error {
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	now := u.now()
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", sessionID).Delete(&UserSession{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&UserSession{
+			SessionID:  sessionID,
+			UserID:     userID,
+			IP:         ip,
+			UserAgent:  userAgent,
+			CreatedAt:  now,
+			LastSeenAt: now,
+		}).Error
+	})
+}
+
+// TouchSession 確認 session 還沒被登出，並更新最後活動時間與 IP
+// 找不到紀錄 (被撤銷、或是這個功能上線前就登入的 session) 回傳 ErrSessionRevoked
+func (u *UserModel) TouchSession(sessionID string, userID uint, ip string) error {
+	var session UserSession
+	err := u.DB.Where("session_id = ? AND user_id = ?", sessionID, userID).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+	now := u.now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval && session.IP == ip {
+		return nil
+	}
+	return u.DB.Model(&session).Updates(map[string]any{"last_seen_at": now, "ip": ip}).Error
+}
+
+// ListSessions 列出還沒到期的 session，userID 為 0 時列出所有人的，依帳號、最後活動時間排序
+func (u *UserModel) ListSessions(userID uint) ([]UserSession, error) {
+	query := u.DB.Model(&UserSession{}).Preload("User").
+		Select("user_sessions.*, "+gormSessionTable+".expires_at AS expires_at").
+		Joins("JOIN "+gormSessionTable+" ON "+gormSessionTable+".id = user_sessions.session_id").
+		Where(gormSessionTable+".expires_at > ?", u.now()).
+		Order("user_sessions.user_id ASC, user_sessions.last_seen_at DESC")
+	if userID != 0 {
+		query = query.Where("user_sessions.user_id = ?", userID)
+	}
+	var list []UserSession
+	err := query.Find(&list).Error
+	return list, err
+}
+
+// RevokeSession 登出單一 session，ownerID 不為 0 時只能登出該使用者自己的
+func (u *UserModel) RevokeSession(id, ownerID uint) error {
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("id = ?", id)
+		if ownerID != 0 {
+			query = query.Where("user_id = ?", ownerID)
+		}
+		var session UserSession
+		if err := query.First(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSessionNotFound
+			}
+			return err
+		}
+		return deleteSessions(tx, []string{session.SessionID})
+	})
+}
+
+// RevokeUserSessions 登出使用者所有的 session，keepSessionID 不為空時保留那一個 (例如自己修改密碼時目前的 session)
+// 回傳登出的數量
+func (u *UserModel) RevokeUserSessions(userID uint, keepSessionID string) (int, error) {
+	var ids []string
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		ids, err = revokeUserSessions(tx, userID, keepSessionID)
+		return err
+	})
+	return len(ids), err
+}
+
+// EndSession 登出時刪除目前 session 的紀錄
+func (u *UserModel) EndSession(sessionID string) error {
+	return u.DB.Where("session_id = ?", sessionID).Delete(&UserSession{}).Error
+}
+
+// PurgeExpiredSessions 刪除已經到期 (或 gormstore 已經清掉) 的 session 紀錄，由背景工作定期呼叫
+// gormstore 自己的 sessions 資料表也在這裡一起清，不依賴 gormstore 的清理時間
+func (u *UserModel) PurgeExpiredSessions() (int64, error) {
+	var purged int64
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM "+gormSessionTable+" WHERE expires_at <= ?", u.now()).Error; err != nil {
+			return err
+		}
+		result := tx.Where("session_id NOT IN (?)", tx.Table(gormSessionTable).Select("id")).Delete(&UserSession{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+func revokeUserSessions(tx *gorm.DB, userID uint, keepSessionID string) ([]string, error) {
+	var ids []string
+	query := tx.Model(&UserSession{}).Where("user_id = ?", userID)
+	if keepSessionID != "" {
+		query = query.Where("session_id <> ?", keepSessionID)
+	}
+	if err := query.Pluck("session_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, deleteSessions(tx, ids)
+}
+
+// 同時刪除 UserSession 與 gormstore 的 session 資料，被登出的 cookie 就算再送來也找不到資料
+func deleteSessions(tx *gorm.DB, sessionIDs []string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	if err := tx.Where("session_id IN ?", sessionIDs).Delete(&UserSession{}).Error; err != nil {
+		return err
+	}
+	return tx.Exec("DELETE FROM "+gormSessionTable+" WHERE id IN ?", sessionIDs).Error
+}
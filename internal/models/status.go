@@ -0,0 +1,144 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// 訂單狀態常數，順序與 OrderStatues 一致（customer.tmpl 的進度條依照 index 顯示）
+const (
+	StatusPlaced    = "已成功下單"
+	StatusPreparing = "製作中"
+	StatusReady     = "已完成（待交付)"
+	StatusFailed    = "交付失敗／逾期"
+	StatusDelivered = "已交付（完成交貨)"
+)
+
+// Actor => 是誰觸發了狀態變更，用來判斷該轉換是否允許被執行
+type Actor string
+
+const (
+	ActorStaff  Actor = "staff"  // 後台登入的管理人員
+	ActorSystem Actor = "system" // 系統排程或維運指令
+)
+
+// StatusTransition 描述一條合法的狀態轉換: From → To，以及哪些 Actor 可以執行
+// Actor 為 ActorStaff 時，還要再看登入者的角色是否在 Roles 裡面
+type StatusTransition struct {
+	From   string
+	To     string
+	Actors []Actor
+	Roles  []Role
+}
+
+// 店主與店長可以執行所有轉換，其他角色只負責自己的環節
+var (
+	supervisorRoles = []Role{RoleOwner, RoleManager}
+	kitchenRoles    = []Role{RoleOwner, RoleManager, RoleKitchen}
+	driverRoles     = []Role{RoleOwner, RoleManager, RoleDriver}
+)
+
+// 宣告式的狀態轉換表，沒有列在這裡的 from→to 一律視為不合法
+// 交付失敗／逾期 => 賣家與玩家聯繫後，可以重新製作、重新交付，或是直接視為已交付
+var StatusTransitions = []StatusTransition{
+	{From: StatusPlaced, To: StatusPreparing, Actors: []Actor{ActorStaff, ActorSystem}, Roles: kitchenRoles},
+	{From: StatusPlaced, To: StatusFailed, Actors: []Actor{ActorStaff, ActorSystem}, Roles: supervisorRoles},
+	{From: StatusPreparing, To: StatusReady, Actors: []Actor{ActorStaff, ActorSystem}, Roles: kitchenRoles},
+	{From: StatusPreparing, To: StatusFailed, Actors: []Actor{ActorStaff, ActorSystem}, Roles: kitchenRoles},
+	{From: StatusReady, To: StatusDelivered, Actors: []Actor{ActorStaff, ActorSystem}, Roles: driverRoles},
+	{From: StatusReady, To: StatusFailed, Actors: []Actor{ActorStaff, ActorSystem}, Roles: driverRoles},
+	{From: StatusFailed, To: StatusPreparing, Actors: []Actor{ActorStaff}, Roles: supervisorRoles},
+	{From: StatusFailed, To: StatusReady, Actors: []Actor{ActorStaff}, Roles: supervisorRoles},
+	{From: StatusFailed, To: StatusDelivered, Actors: []Actor{ActorStaff}, Roles: supervisorRoles},
+}
+
+// 終止狀態 => 進入後不能再轉換到其他狀態
+var TerminalStatuses = []string{StatusDelivered}
+
+// 已結案 => 可以封存的狀態 (order_archive.go)
+// 交付失敗／逾期雖然還能重新處理，但長時間沒有更新代表已經不會再處理，一樣視為結案
+var ArchivableStatuses = []string{StatusDelivered, StatusFailed}
+
+var (
+	// 狀態不在 OrderStatues 裡面 (前端亂傳值)
+	ErrInvalidStatus = errors.New("無效的訂單狀態")
+	// 資料庫裡查不到該筆訂單
+	ErrOrderNotFound = errors.New("訂單不存在")
+)
+
+// StatusTransitionError => 狀態本身合法，但是從目前狀態不能轉換過去
+type StatusTransitionError struct {
+	From   string
+	To     string
+	Reason string
+}
+
+func (e *StatusTransitionError) Error() string {
+	return fmt.Sprintf("訂單狀態無法從「%s」變更為「%s」: %s", e.From, e.To, e.Reason)
+}
+
+func IsValidStatus(status string) bool {
+	return slices.Contains(OrderStatues, status)
+}
+
+func IsTerminalStatus(status string) bool {
+	return slices.Contains(TerminalStatuses, status)
+}
+
+func IsArchivableStatus(status string) bool {
+	return slices.Contains(ArchivableStatuses, status)
+}
+
+// StatusIndex 回傳狀態在 OrderStatues 中的位置，找不到回傳 -1
+func StatusIndex(status string) int {
+	return slices.Index(OrderStatues, status)
+}
+
+// CheckTransition 檢查 actor 是否可以把訂單從 from 變更成 to
+// role => actor 為 ActorStaff 時登入者的角色；ActorSystem 不看角色
+func CheckTransition(from, to string, actor Actor, role Role) error {
+	if !IsValidStatus(to) {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, to)
+	}
+	if from == to {
+		return &StatusTransitionError{From: from, To: to, Reason: "狀態沒有變更"}
+	}
+	if IsTerminalStatus(from) {
+		return &StatusTransitionError{From: from, To: to, Reason: "訂單已是終止狀態"}
+	}
+	for _, t := range StatusTransitions {
+		if t.From != from || t.To != to {
+			continue
+		}
+		if !slices.Contains(t.Actors, actor) {
+			return &StatusTransitionError{From: from, To: to, Reason: "沒有權限執行此轉換"}
+		}
+		if actor == ActorStaff && !slices.Contains(t.Roles, role) {
+			return &StatusTransitionError{From: from, To: to, Reason: "目前的角色不能執行此轉換"}
+		}
+		return nil
+	}
+	return &StatusTransitionError{From: from, To: to, Reason: "不允許的狀態轉換"}
+}
+
+// NextStatuses 回傳從 from 出發、actor 可以執行的下一個狀態，依 OrderStatues 順序排列
+// admin.tmpl 的下拉選單只顯示這些選項
+func NextStatuses(from string, actor Actor, role Role) []string {
+	next := []string{}
+	for _, status := range OrderStatues {
+		if CheckTransition(from, status, actor, role) == nil {
+			next = append(next, status)
+		}
+	}
+	return next
+}
+
+// TransitionMap 回傳每個狀態可以轉換過去的下一個狀態，給 React 前端建立下拉選單
+func TransitionMap(actor Actor, role Role) map[string][]string {
+	transitions := make(map[string][]string, len(OrderStatues))
+	for _, status := range OrderStatues {
+		transitions[status] = NextStatuses(status, actor, role)
+	}
+	return transitions
+}
@@ -0,0 +1,104 @@
+package models
+
+import "time"
+
+/*
+Handler 透過介面存取訂單、帳號與菜單，不直接依賴 GORM:
+  - OrderModel / UserModel / CatalogModel (GORM) 是正式環境使用的實作
+  - MemoryStore (memory.go) 把資料放在記憶體，給不想準備資料庫的單元測試使用
+  - 新增給 handler 用的方法時，兩邊的實作都要補上，下方的 var _ 會在編譯時檢查
+*/
+
+// OrderStore => 訂單、垃圾桶、封存與 Idempotency-Key
+type OrderStore interface {
+	CreateOrder(order *Order) error
+	CreateOrderIdempotent(key, requestHash string, order *Order, ttl time.Duration) (*Order, bool, error)
+	GetOrder(id string) (*Order, error) // 找不到時回傳 gorm.ErrRecordNotFound
+	FindOrder(id string) (*Order, error)
+	ListOrders(q OrderQuery) (*OrderPage, error)
+	SearchOrders(q OrderSearch) (*OrderSearchResult, error)
+	UpdateOrderStatus(orderID string, change StatusChange) (*OrderStatusEvent, error)
+	DeleteOrder(id string, userID *uint, reason string) error
+
+	ListDeletedOrders(retention time.Duration) ([]DeletedOrder, error)
+	RestoreOrder(id string, retention time.Duration) (*Order, error)
+	PurgeOrder(id string) error
+	PurgeDeletedOrders(retention time.Duration) (int64, error)
+
+	ArchiveOrders(olderThan time.Duration) (int64, error)
+	SearchArchivedOrders(q ArchiveQuery) (*ArchivePage, error)
+	GetArchivedOrder(id string) (*ArchivedOrder, error)
+
+	PurgeExpiredIdempotencyKeys() (int64, error)
+}
+
+// UserStore => 後台帳號、登入、兩步驟驗證、API token 與登入裝置
+type UserStore interface {
+	GetUserByID(id string) (*User, error) // 找不到時回傳 nil, nil
+	ListUsers() ([]User, error)
+	CreateUser(username, password string, role Role) (*User, error)
+	SetDisabled(id uint, disabled bool) error
+	SetRole(id uint, role Role) error
+	ResetPassword(id uint, password string) error
+	ChangePassword(id uint, current, password, keepSessionID string) error
+
+	Login(username, password, ip string) (*User, error)
+	VerifySecondFactor(userID uint, code, ip string) (*User, error)
+	ListLoginAttempts(q LoginAttemptQuery) ([]LoginAttempt, error)
+	ListLoginLocks() ([]LoginThrottle, error)
+	PurgeLoginRecords(retention time.Duration) (int64, error)
+	UnlockLogin(key string) error
+
+	StartTOTPEnrollment(id uint) (string, error)
+	EnableTOTP(id uint, code string) ([]string, error)
+	DisableTOTP(id uint, password string) error
+	ResetTOTP(id uint) error
+	RegenerateRecoveryCodes(id uint, password string) ([]string, error)
+	RemainingRecoveryCodes(id uint) (int64, error)
+	TwoFactorRoles() ([]Role, error)
+	SetTwoFactorRoles(roles []Role) error
+	TwoFactorRequired(role Role) (bool, error)
+
+	CreateAPIToken(userID uint, name string, scopes []Permission, days int) (string, *APIToken, error)
+	AuthenticateAPIToken(plain string) (*APIToken, *User, error)
+	ListAPITokens(userID uint) ([]APIToken, error)
+	RevokeAPIToken(id, ownerID uint) error
+
+	RecordSession(sessionID string, userID uint, ip, userAgent string) error
+	TouchSession(sessionID string, userID uint, ip string) error
+	ListSessions(userID uint) ([]UserSession, error)
+	RevokeSession(id, ownerID uint) error
+	RevokeUserSessions(userID uint, keepSessionID string) (int, error)
+	EndSession(sessionID string) error
+	PurgeExpiredSessions() (int64, error)
+}
+
+// CatalogStore => 菜單 (商品、尺寸與價格)，下單頁面、驗證器與後台菜單管理使用
+type CatalogStore interface {
+	ActiveProducts() ([]Product, error)
+	ActiveSizes() ([]ProductSize, error)
+	ActivePrices() (map[PriceKey]int64, error)
+	PriceOrder(order *Order, taxRateBps int64) error
+	IsActiveProduct(name string) (bool, error)
+	IsActiveSize(name string) (bool, error)
+
+	ListProducts() ([]Product, error)
+	ListSizes() ([]ProductSize, error)
+	ListPrices() ([]ProductPrice, error)
+	CreateProduct(entry CatalogEntry) (*Product, error)
+	UpdateProduct(id uint, entry CatalogEntry) error
+	DeleteProduct(id uint) error
+	CreateSize(entry CatalogEntry) (*ProductSize, error)
+	UpdateSize(id uint, entry CatalogEntry) error
+	DeleteSize(id uint) error
+	SetPrices(updates []PriceUpdate) error
+}
+
+var (
+	_ OrderStore   = (*OrderModel)(nil)
+	_ UserStore    = (*UserModel)(nil)
+	_ CatalogStore = (*CatalogModel)(nil)
+	_ OrderStore   = (*MemoryStore)(nil)
+	_ UserStore    = (*MemoryStore)(nil)
+	_ CatalogStore = (*MemoryStore)(nil)
+)
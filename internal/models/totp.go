@@ -0,0 +1,347 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 兩步驟驗證 (TOTP, RFC 6238)，與 Google Authenticator 等 App 相容: HMAC-SHA1、30 秒、6 位數
+// 驗證時允許前後各一個時間區間的誤差，避免手機時間稍微不準就無法登入
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1
+	RecoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("已經啟用兩步驟驗證")
+	ErrTOTPNotPending     = errors.New("請先產生新的驗證金鑰")
+	ErrTOTPNotEnabled     = errors.New("尚未啟用兩步驟驗證")
+	ErrInvalidTOTPCode    = errors.New("驗證碼錯誤")
+	// 角色被要求必須使用兩步驟驗證時，不能自行關閉 (店主仍可以在帳號管理重設)
+	ErrTOTPRequired = errors.New("目前的角色必須使用兩步驟驗證，無法關閉")
+)
+
+// RecoveryCode => 手機遺失時用來登入的一次性備用碼，只儲存 SHA-256 雜湊
+// 備用碼本身是隨機產生的高熵字串，不需要 bcrypt 這類慢速雜湊
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index;not null"`
+	CodeHash  string     `gorm:"size:64;not null"`
+	UsedAt    *time.Time // 使用過就不能再用
+	CreatedAt time.Time
+}
+
+// TwoFactorRole => 被店主要求必須啟用兩步驟驗證的角色，有資料代表必須啟用
+type TwoFactorRole struct {
+	Role      Role `gorm:"primaryKey;size:20"`
+	CreatedAt time.Time
+}
+
+// 產生新的 TOTP 金鑰 (160 bits，RFC 4226 建議的長度)，以 base32 表示
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// 計算 t 這個時間點的驗證碼
+func TOTPCode(secret string, t time.Time) (string, error) {
+	return hotp(secret, uint64(t.Unix()/totpPeriod))
+}
+
+// RFC 4226 的 HOTP，counter 為 TOTP 的時間區間編號
+func hotp(secret string, counter uint64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("無效的 TOTP 金鑰: %w", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation: 取最後一個 byte 的低 4 bits 當作位移，往後讀 4 bytes
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// 回傳驗證碼所屬的時間區間編號，不符合時回傳 -1
+// 呼叫端記錄用過的區間編號，同一個驗證碼就不能在 30 秒內被重複使用
+func matchTOTP(secret, code string, t time.Time) int64 {
+	step := t.Unix() / totpPeriod
+	for d := int64(-totpSkew); d <= totpSkew; d++ {
+		expected, err := hotp(secret, uint64(step+d))
+		if err != nil {
+			return -1
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step + d
+		}
+	}
+	return -1
+}
+
+// otpauth:// URI，驗證 App 掃描 QR code 後會讀到這個網址
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + params.Encode()
+}
+
+// 備用碼格式 xxxx-xxxx-xxxx-xxxx，使用者輸入時忽略大小寫、空白與 -
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(totpEncoding.EncodeToString(b))
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16], nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// 目前的時間，UserModel.Clock 沒有設定時使用系統時間 (測試時可以換成固定的時間)
+func (u *UserModel) now() time.Time {
+	if u.Clock != nil {
+		return u.Clock()
+	}
+	return time.Now()
+}
+
+// 產生新的金鑰，在使用者輸入第一個驗證碼 (EnableTOTP) 之前不會生效
+func (u *UserModel) StartTOTPEnrollment(id uint) (string, error) {
+	user, err := findUser(u.DB, id)
+	if err != nil {
+		return "", err
+	}
+	if user.TOTPEnabled {
+		return "", ErrTOTPAlreadyEnabled
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	if err := u.DB.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// 確認使用者的 App 產生的驗證碼正確後才啟用，回傳新的備用碼 (只會顯示這一次)
+func (u *UserModel) EnableTOTP(id uint, code string) ([]string, error) {
+	var codes []string
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabled {
+			return ErrTOTPAlreadyEnabled
+		}
+		if user.TOTPSecret == "" {
+			return ErrTOTPNotPending
+		}
+		step := matchTOTP(user.TOTPSecret, strings.TrimSpace(code), u.now())
+		if step < 0 {
+			return ErrInvalidTOTPCode
+		}
+		if err := tx.Model(user).Updates(map[string]any{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, id)
+		return err
+	})
+	return codes, err
+}
+
+// 使用者自行關閉，需要再次輸入密碼
+func (u *UserModel) DisableTOTP(id uint, password string) error {
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if !CompareHashAndPassword(user.Password, password) {
+			return ErrWrongPassword
+		}
+		if !user.TOTPEnabled {
+			return ErrTOTPNotEnabled
+		}
+		required, err := twoFactorRequired(tx, user.Role)
+		if err != nil {
+			return err
+		}
+		if required {
+			return ErrTOTPRequired
+		}
+		return clearTOTP(tx, id)
+	})
+}
+
+// 店主重設其他人的兩步驟驗證 (例如手機遺失又沒有備用碼)
+// 如果該角色必須啟用，對方下次登入後會被要求重新設定
+func (u *UserModel) ResetTOTP(id uint) error {
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := findUser(tx, id); err != nil {
+			return err
+		}
+		return clearTOTP(tx, id)
+	})
+}
+
+// 重新產生備用碼，舊的全部失效，需要再次輸入密碼
+func (u *UserModel) RegenerateRecoveryCodes(id uint, password string) ([]string, error) {
+	var codes []string
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if !CompareHashAndPassword(user.Password, password) {
+			return ErrWrongPassword
+		}
+		if !user.TOTPEnabled {
+			return ErrTOTPNotEnabled
+		}
+		codes, err = replaceRecoveryCodes(tx, id)
+		return err
+	})
+	return codes, err
+}
+
+// 還沒使用過的備用碼數量
+func (u *UserModel) RemainingRecoveryCodes(id uint) (int64, error) {
+	var count int64
+	err := u.DB.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", id).Count(&count).Error
+	return count, err
+}
+
+// 驗證 TOTP 驗證碼或備用碼，成功時驗證碼 / 備用碼都會被標記為用過
+func (u *UserModel) checkSecondFactor(user *User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step := matchTOTP(user.TOTPSecret, code, u.now()); step >= 0 {
+		// 條件加上 totp_last_step < step，同一個驗證碼被同時送出兩次時只有一次會成功
+		result := u.DB.Model(&User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return result.RowsAffected == 1, result.Error
+	}
+
+	result := u.DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", u.now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func clearTOTP(tx *gorm.DB, id uint) error {
+	err := tx.Model(&User{}).Where("id = ?", id).Updates(map[string]any{
+		"totp_secret":    "",
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, id uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", id).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, RecoveryCodeCount)
+	rows := make([]RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = RecoveryCode{UserID: id, CodeHash: hashRecoveryCode(code)}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// 被要求必須啟用兩步驟驗證的角色，依 Roles 的順序排列
+func (u *UserModel) TwoFactorRoles() ([]Role, error) {
+	var rows []TwoFactorRole
+	if err := u.DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	required := make(map[Role]bool, len(rows))
+	for _, row := range rows {
+		required[row.Role] = true
+	}
+	var roles []Role
+	for _, role := range Roles {
+		if required[role] {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// 整批設定哪些角色必須啟用兩步驟驗證
+func (u *UserModel) SetTwoFactorRoles(roles []Role) error {
+	for _, role := range roles {
+		if !IsValidRole(role) {
+			return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+		}
+	}
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&TwoFactorRole{}).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if err := tx.Create(&TwoFactorRole{Role: role}).Error; err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					continue
+				}
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (u *UserModel) TwoFactorRequired(role Role) (bool, error) {
+	return twoFactorRequired(u.DB, role)
+}
+
+func twoFactorRequired(db *gorm.DB, role Role) (bool, error) {
+	var count int64
+	err := db.Model(&TwoFactorRole{}).Where("role = ?", role).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,252 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附錄 B 的 SHA1 測試向量，金鑰為 ASCII "12345678901234567890"
+// RFC 的驗證碼是 8 位數，6 位數的驗證碼就是最後 6 位
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, v := range vectors {
+		got, err := TOTPCode(secret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := v.code[len(v.code)-totpDigits:]; got != want {
+			t.Errorf("T=%d 驗證碼 = %s，預期 %s", v.unix, got, want)
+		}
+	}
+	// 金鑰不分大小寫
+	if got, _ := TOTPCode(strings.ToLower(secret), time.Unix(59, 0)); got != "287082" {
+		t.Errorf("小寫金鑰的驗證碼 = %s", got)
+	}
+}
+
+func TestMatchTOTPSkewWindow(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_015, 0) // 時間區間的正中間
+	step := now.Unix() / totpPeriod
+	for _, c := range []struct {
+		offset time.Duration
+		match  bool
+	}{
+		{0, true},
+		{-totpPeriod * time.Second, true},
+		{totpPeriod * time.Second, true},
+		{-2 * totpPeriod * time.Second, false},
+		{2 * totpPeriod * time.Second, false},
+	} {
+		code, _ := TOTPCode(secret, now.Add(c.offset))
+		got := matchTOTP(secret, code, now)
+		want := int64(-1)
+		if c.match {
+			want = step + int64(c.offset/time.Second)/totpPeriod
+		}
+		if got != want {
+			t.Errorf("誤差 %v: matchTOTP = %d，預期 %d", c.offset, got, want)
+		}
+	}
+}
+
+// 建立帳號並完成兩步驟驗證設定，回傳金鑰與備用碼；now 為 store 目前的時間
+func enrollTOTP(t *testing.T, users UserStore, now time.Time, username string, role Role) (*User, string, []string) {
+	t.Helper()
+	user, err := users.CreateUser(username, "secret123", role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := users.StartTOTPEnrollment(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := TOTPCode(secret, now)
+	codes, err := users.EnableTOTP(user.ID, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, secret, codes
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	forEachUserStore(t, &now, func(t *testing.T, users UserStore) {
+		user, err := users.CreateUser("alice", "secret123", RoleManager)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := users.EnableTOTP(user.ID, "123456"); !errors.Is(err, ErrTOTPNotPending) {
+			t.Fatalf("還沒產生金鑰就啟用: %v", err)
+		}
+		secret, err := users.StartTOTPEnrollment(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 輸入第一個驗證碼之前還沒啟用，登入不需要驗證碼
+		if got := getTestUser(t, users, user.ID); got.TOTPEnabled {
+			t.Fatal("輸入驗證碼之前不應該啟用")
+		}
+		wrong, _ := TOTPCode(secret, now.Add(-10*totpPeriod*time.Second))
+		if _, err := users.EnableTOTP(user.ID, wrong); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("錯誤的驗證碼: %v", err)
+		}
+
+		code, _ := TOTPCode(secret, now)
+		codes, err := users.EnableTOTP(user.ID, " "+code+" ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(codes) != RecoveryCodeCount {
+			t.Fatalf("產生 %d 組備用碼，預期 %d", len(codes), RecoveryCodeCount)
+		}
+		if remaining, _ := users.RemainingRecoveryCodes(user.ID); remaining != RecoveryCodeCount {
+			t.Fatalf("剩下 %d 組備用碼", remaining)
+		}
+		got := getTestUser(t, users, user.ID)
+		if !got.TOTPEnabled || got.TOTPLastStep != now.Unix()/totpPeriod {
+			t.Fatalf("啟用後 enabled = %v, lastStep = %d", got.TOTPEnabled, got.TOTPLastStep)
+		}
+		if _, err := users.StartTOTPEnrollment(user.ID); !errors.Is(err, ErrTOTPAlreadyEnabled) {
+			t.Fatalf("已經啟用還能產生新金鑰: %v", err)
+		}
+
+		// 登入時密碼正確只會進到等待驗證碼的狀態
+		if _, err := users.Login("alice", "secret123", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+		attempts, _ := users.ListLoginAttempts(LoginAttemptQuery{Username: "alice"})
+		if len(attempts) != 1 || attempts[0].Result != LoginTOTPPending {
+			t.Fatalf("登入紀錄 = %+v", attempts)
+		}
+	})
+}
+
+func TestVerifySecondFactorRejectsReusedCode(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	forEachUserStore(t, &now, func(t *testing.T, users UserStore) {
+		user, secret, _ := enrollTOTP(t, users, now, "alice", RoleManager)
+
+		// 設定時用過的驗證碼仍在誤差範圍內，但不能再用來登入
+		enrolled, _ := TOTPCode(secret, now)
+		if _, err := users.VerifySecondFactor(user.ID, enrolled, "10.0.0.1"); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("設定時的驗證碼被重複使用: %v", err)
+		}
+
+		now = now.Add(totpPeriod * time.Second)
+		code, _ := TOTPCode(secret, now)
+		if _, err := users.VerifySecondFactor(user.ID, code, "10.0.0.1"); err != nil {
+			t.Fatalf("新的驗證碼應該可以登入: %v", err)
+		}
+		if _, err := users.VerifySecondFactor(user.ID, code, "10.0.0.1"); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("同一個驗證碼第二次: %v", err)
+		}
+		// 比已經用過的區間更早的驗證碼也不接受
+		previous, _ := TOTPCode(secret, now.Add(-totpPeriod*time.Second))
+		if _, err := users.VerifySecondFactor(user.ID, previous, "10.0.0.1"); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("較早的驗證碼: %v", err)
+		}
+
+		// 手機時間慢了一個區間，下一個區間的驗證碼仍然接受
+		now = now.Add(3 * totpPeriod * time.Second)
+		late, _ := TOTPCode(secret, now.Add(-totpPeriod*time.Second))
+		if _, err := users.VerifySecondFactor(user.ID, late, "10.0.0.1"); err != nil {
+			t.Fatalf("誤差一個區間的驗證碼: %v", err)
+		}
+	})
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	forEachUserStore(t, &now, func(t *testing.T, users UserStore) {
+		user, _, codes := enrollTOTP(t, users, now, "alice", RoleManager)
+
+		// 輸入時忽略大小寫、空白與 -
+		typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))
+		if _, err := users.VerifySecondFactor(user.ID, typed, "10.0.0.1"); err != nil {
+			t.Fatalf("備用碼應該可以登入: %v", err)
+		}
+		if _, err := users.VerifySecondFactor(user.ID, codes[0], "10.0.0.1"); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("同一組備用碼第二次: %v", err)
+		}
+		if remaining, _ := users.RemainingRecoveryCodes(user.ID); remaining != RecoveryCodeCount-1 {
+			t.Fatalf("剩下 %d 組備用碼，預期 %d", remaining, RecoveryCodeCount-1)
+		}
+
+		// 重新產生後舊的全部失效
+		if _, err := users.RegenerateRecoveryCodes(user.ID, "wrong-password"); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("密碼錯誤: %v", err)
+		}
+		fresh, err := users.RegenerateRecoveryCodes(user.ID, "secret123")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.VerifySecondFactor(user.ID, codes[1], "10.0.0.1"); !errors.Is(err, ErrInvalidTOTPCode) {
+			t.Fatalf("重新產生前的備用碼: %v", err)
+		}
+		if _, err := users.VerifySecondFactor(user.ID, fresh[1], "10.0.0.1"); err != nil {
+			t.Fatalf("新的備用碼: %v", err)
+		}
+	})
+}
+
+func TestTwoFactorRequiredRoles(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	forEachUserStore(t, &now, func(t *testing.T, users UserStore) {
+
+		if err := users.SetTwoFactorRoles([]Role{"chef"}); !errors.Is(err, ErrInvalidRole) {
+			t.Fatalf("不存在的角色: %v", err)
+		}
+		if err := users.SetTwoFactorRoles([]Role{RoleKitchen, RoleManager, RoleKitchen}); err != nil {
+			t.Fatal(err)
+		}
+		roles, _ := users.TwoFactorRoles()
+		if len(roles) != 2 || roles[0] != RoleManager || roles[1] != RoleKitchen {
+			t.Fatalf("必須啟用的角色 = %v", roles)
+		}
+		if required, _ := users.TwoFactorRequired(RoleDriver); required {
+			t.Fatal("沒有被要求的角色")
+		}
+
+		// 被要求的角色不能自行關閉，店主重設則可以
+		kitchen, _, _ := enrollTOTP(t, users, now, "cook", RoleKitchen)
+		if err := users.DisableTOTP(kitchen.ID, "secret123"); !errors.Is(err, ErrTOTPRequired) {
+			t.Fatalf("被要求的角色自行關閉: %v", err)
+		}
+		if err := users.ResetTOTP(kitchen.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := getTestUser(t, users, kitchen.ID); got.TOTPEnabled || got.TOTPSecret != "" {
+			t.Fatal("重設後應該關閉並清除金鑰")
+		}
+		if remaining, _ := users.RemainingRecoveryCodes(kitchen.ID); remaining != 0 {
+			t.Fatalf("重設後還有 %d 組備用碼", remaining)
+		}
+
+		// 取消要求後可以自行關閉
+		driver, _, _ := enrollTOTP(t, users, now, "rider", RoleDriver)
+		if err := users.DisableTOTP(driver.ID, "wrong-password"); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("密碼錯誤: %v", err)
+		}
+		if err := users.DisableTOTP(driver.ID, "secret123"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -3,19 +3,40 @@ package models
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type User struct { // 定義一個 User struct，對應到資料庫中的 users table。
-	ID       uint   `gorm:"primaryKey"`
-	Username string `gorm:"uniqueIndex;not null"`
-	Password string `gorm:"not null"`
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Username string `gorm:"uniqueIndex;not null" json:"username"`
+	Password string `gorm:"not null" json:"-"`                           // bcrypt hash，不會出現在 JSON API
+	Role     Role   `gorm:"size:20;not null;default:viewer" json:"role"` // 既有帳號升級後預設為 viewer，見 EnsureOwner
+	// 停用 (軟刪除) => 保留帳號讓訂單歷程還能對應到是誰操作的，但不能再登入
+	Disabled   bool       `gorm:"not null;default:false" json:"disabled"`
+	DisabledAt *time.Time `json:"disabledAt,omitempty"`
+	// 兩步驟驗證，見 totp.go
+	// TOTPSecret 在 TOTPEnabled 之前是設定中的金鑰；TOTPLastStep 記錄最後一次用過的時間區間，防止驗證碼被重複使用
+	TOTPSecret   string `gorm:"size:64" json:"-"`
+	TOTPEnabled  bool   `gorm:"not null;default:false" json:"totpEnabled"`
+	TOTPLastStep int64  `gorm:"not null;default:0" json:"-"`
 }
 
+var (
+	ErrUserNotFound  = errors.New("使用者不存在")
+	ErrUserDuplicate = errors.New("帳號名稱已存在")
+	ErrUserDisabled  = errors.New("帳號已停用")
+	ErrWrongPassword = errors.New("目前的密碼不正確")
+	// 停用或降級最後一個啟用中的 owner 之後，就沒有人能管理帳號了
+	ErrLastOwner = errors.New("至少需要保留一個啟用中的店主帳號")
+)
+
 type UserModel struct {
 	DB *gorm.DB // 持有 *gorm.DB，用來執行資料庫操作。
+	// 驗證 TOTP 與計算登入鎖定時使用的時鐘，nil 代表 time.Now
+	Clock func() time.Time
 }
 
 func GenerateHashPassword(password string) (string, error) {
@@ -31,28 +52,37 @@ func CompareHashAndPassword(hashPassword string, password string) bool {
 	return err == nil
 }
 
-// 這方法綁定在 UserModel 上
-// user, password => 參數
-// *User：如果驗證成功，回傳該使用者資料。 error：如果失敗，回傳錯誤。
-func (u *UserModel) AuthenticateUser(username, password string) (*User, error) {
-	var user User
+// 加上角色欄位之前建立的帳號都會是 viewer，沒有任何 owner 時把最早建立的帳號升級成 owner，
+// 避免升級後沒有人能管理訂單與帳號
+func (u *UserModel) EnsureOwner() error {
+	var count int64
+	if err := u.DB.Model(&User{}).Where("role = ?", RoleOwner).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
 
-	// 查詢符合 username 的第一筆資料
-	if err := u.DB.Where("username = ?", username).First(&user).Error; err != nil {
+	var first User
+	if err := u.DB.Order("id ASC").First(&first).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("使用者不存在")
+			return nil // 還沒有任何帳號
 		}
-
-		return nil, fmt.Errorf("系統錯誤，請稍後再試")
+		return err
 	}
-	fmt.Printf("====>從資料庫取得hash後的密碼:%s\n", user.Password)
-	if CompareHashAndPassword(user.Password, password) {
-		fmt.Println("===>匹配")
-		return &user, nil
-	} else {
-		fmt.Println("===>密碼匹配錯誤")
-		return nil, fmt.Errorf("密碼匹配錯誤")
+	return u.DB.Model(&first).Update("role", RoleOwner).Error
+}
+
+// 依帳號名稱查詢，找不到回傳 ErrUserNotFound (CLI 使用)
+func (u *UserModel) GetUserByUsername(username string) (*User, error) {
+	var user User
+	if err := u.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
 	}
+	return &user, nil
 }
 
 func (u *UserModel) GetUserByID(id string) (*User, error) {
@@ -65,3 +95,136 @@ func (u *UserModel) GetUserByID(id string) (*User, error) {
 	}
 	return &user, nil
 }
+
+// 後台帳號列表，依建立順序排列
+func (u *UserModel) ListUsers() ([]User, error) {
+	var users []User
+	err := u.DB.Order("id ASC").Find(&users).Error
+	return users, err
+}
+
+func (u *UserModel) CreateUser(username, password string, role Role) (*User, error) {
+	if !IsValidRole(role) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	hash, err := GenerateHashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := User{Username: username, Password: hash, Role: role}
+	if err := u.DB.Create(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrUserDuplicate
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// 停用 / 重新啟用帳號，停用後 AuthMiddleware 會在下一個請求把該帳號登出
+func (u *UserModel) SetDisabled(id uint, disabled bool) error {
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if disabled && user.Role == RoleOwner && !user.Disabled {
+			if err := ensureAnotherOwner(tx, id); err != nil {
+				return err
+			}
+		}
+
+		var disabledAt *time.Time
+		if disabled {
+			now := time.Now()
+			disabledAt = &now
+			// 停用時一併登出所有裝置
+			if _, err := revokeUserSessions(tx, id, ""); err != nil {
+				return err
+			}
+		}
+		return tx.Model(user).Updates(map[string]any{"disabled": disabled, "disabled_at": disabledAt}).Error
+	})
+}
+
+func (u *UserModel) SetRole(id uint, role Role) error {
+	if !IsValidRole(role) {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if user.Role == RoleOwner && role != RoleOwner && !user.Disabled {
+			if err := ensureAnotherOwner(tx, id); err != nil {
+				return err
+			}
+		}
+		return tx.Model(user).Update("role", role).Error
+	})
+}
+
+// 管理者直接重設密碼，不需要舊密碼
+// 重設密碼後登出該帳號所有的 session
+func (u *UserModel) ResetPassword(id uint, password string) error {
+	return u.setPassword(id, password, "")
+}
+
+// 使用者自行修改密碼，必須先驗證目前的密碼
+// 除了 keepSessionID (正在修改密碼的這個 session) 以外，其他裝置都會被登出
+func (u *UserModel) ChangePassword(id uint, current, password, keepSessionID string) error {
+	user, err := findUser(u.DB, id)
+	if err != nil {
+		return err
+	}
+	if !CompareHashAndPassword(user.Password, current) {
+		return ErrWrongPassword
+	}
+	return u.setPassword(id, password, keepSessionID)
+}
+
+func (u *UserModel) setPassword(id uint, password, keepSessionID string) error {
+	hash, err := GenerateHashPassword(password)
+	if err != nil {
+		return err
+	}
+	return u.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", id).Update("password", hash)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		_, err := revokeUserSessions(tx, id, keepSessionID)
+		return err
+	})
+}
+
+func findUser(db *gorm.DB, id uint) (*User, error) {
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// 除了 id 以外，還有其他啟用中的 owner 才回傳 nil
+func ensureAnotherOwner(tx *gorm.DB, id uint) error {
+	var count int64
+	err := tx.Model(&User{}).
+		Where("role = ? AND disabled = ? AND id <> ?", RoleOwner, false, id).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// 帳號管理在 GORM 與 MemoryStore 上要回傳相同的錯誤
+func TestUserManagement(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	forEachUserStore(t, &now, func(t *testing.T, users UserStore) {
+		owner, err := users.CreateUser("owner", "secret123", RoleOwner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.CreateUser("owner", "secret123", RoleKitchen); !errors.Is(err, ErrUserDuplicate) {
+			t.Fatalf("帳號名稱重複: %v", err)
+		}
+		if _, err := users.CreateUser("chef", "secret123", "chef"); !errors.Is(err, ErrInvalidRole) {
+			t.Fatalf("不存在的角色: %v", err)
+		}
+
+		// 唯一啟用中的店主不能停用或降級
+		if err := users.SetDisabled(owner.ID, true); !errors.Is(err, ErrLastOwner) {
+			t.Fatalf("停用最後一個店主: %v", err)
+		}
+		if err := users.SetRole(owner.ID, RoleManager); !errors.Is(err, ErrLastOwner) {
+			t.Fatalf("降級最後一個店主: %v", err)
+		}
+		if err := users.SetRole(9999, RoleManager); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("不存在的帳號: %v", err)
+		}
+		second, err := users.CreateUser("owner2", "secret123", RoleOwner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := users.SetRole(owner.ID, RoleManager); err != nil {
+			t.Fatalf("還有其他店主時可以降級: %v", err)
+		}
+		if err := users.SetDisabled(second.ID, true); !errors.Is(err, ErrLastOwner) {
+			t.Fatalf("降級後 owner2 成為最後一個店主: %v", err)
+		}
+
+		// 停用後密碼正確也不能登入
+		cook, err := users.CreateUser("cook", "secret123", RoleKitchen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := users.SetDisabled(cook.ID, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.Login("cook", "secret123", "10.0.0.1"); !errors.Is(err, ErrUserDisabled) {
+			t.Fatalf("停用的帳號登入: %v", err)
+		}
+		if got := getTestUser(t, users, cook.ID); !got.Disabled {
+			t.Fatal("應該是停用狀態")
+		}
+
+		if err := users.ChangePassword(owner.ID, "wrong-password", "new-secret", ""); !errors.Is(err, ErrWrongPassword) {
+			t.Fatalf("目前的密碼錯誤: %v", err)
+		}
+		if err := users.ChangePassword(owner.ID, "secret123", "new-secret", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.Login("owner", "new-secret", "10.0.0.1"); err != nil {
+			t.Fatalf("用新密碼登入: %v", err)
+		}
+
+		list, err := users.ListUsers()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 3 {
+			t.Fatalf("帳號數量 = %d，預期 3", len(list))
+		}
+	})
+}
+
+func TestAPITokens(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	forEachUserStore(t, &now, func(t *testing.T, users UserStore) {
+		cook, err := users.CreateUser("cook", "secret123", RoleKitchen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := users.CreateAPIToken(cook.ID, "ci", nil, 30); !errors.Is(err, ErrAPITokenNoScope) {
+			t.Fatalf("沒有權限: %v", err)
+		}
+		if _, _, err := users.CreateAPIToken(cook.ID, "ci", []Permission{PermUserManage}, 30); !errors.Is(err, ErrAPITokenScope) {
+			t.Fatalf("角色沒有的權限: %v", err)
+		}
+		plain, token, err := users.CreateAPIToken(cook.ID, "ci", []Permission{PermOrderView}, 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, owner, err := users.AuthenticateAPIToken(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != token.ID || owner.ID != cook.ID {
+			t.Fatalf("token %d 屬於 %d", got.ID, owner.ID)
+		}
+		if _, _, err := users.AuthenticateAPIToken(plain + "x"); !errors.Is(err, ErrAPITokenInvalid) {
+			t.Fatalf("錯誤的 token: %v", err)
+		}
+
+		// 過期後不能使用
+		now = now.AddDate(0, 0, 31)
+		if _, _, err := users.AuthenticateAPIToken(plain); !errors.Is(err, ErrAPITokenInvalid) {
+			t.Fatalf("過期的 token: %v", err)
+		}
+
+		if err := users.RevokeAPIToken(token.ID, cook.ID+1); !errors.Is(err, ErrAPITokenNotFound) {
+			t.Fatalf("撤銷別人的 token: %v", err)
+		}
+		if err := users.RevokeAPIToken(token.ID, cook.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.RevokeAPIToken(token.ID, cook.ID); !errors.Is(err, ErrAPITokenRevoked) {
+			t.Fatalf("撤銷兩次: %v", err)
+		}
+		tokens, err := users.ListAPITokens(cook.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tokens) != 1 || tokens[0].RevokedAt == nil {
+			t.Fatalf("token 列表 = %+v", tokens)
+		}
+	})
+}
+
+func TestUserSessions(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	forEachUserStore(t, &now, func(t *testing.T, users UserStore) {
+		user, err := users.CreateUser("alice", "secret123", RoleManager)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []string{"session-a", "session-b", "session-c"} {
+			if err := users.RecordSession(id, user.ID, "10.0.0.1", "test"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := users.TouchSession("session-a", user.ID, "10.0.0.2"); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.TouchSession("session-a", user.ID+1, "10.0.0.2"); !errors.Is(err, ErrSessionRevoked) {
+			t.Fatalf("別人的 session: %v", err)
+		}
+
+		if err := users.EndSession("session-c"); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.TouchSession("session-c", user.ID, "10.0.0.1"); !errors.Is(err, ErrSessionRevoked) {
+			t.Fatalf("登出後的 session: %v", err)
+		}
+
+		// 修改密碼時保留目前的 session，其他裝置登出
+		if err := users.ChangePassword(user.ID, "secret123", "new-secret", "session-a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.TouchSession("session-a", user.ID, "10.0.0.1"); err != nil {
+			t.Fatalf("目前的 session 應該保留: %v", err)
+		}
+		if err := users.TouchSession("session-b", user.ID, "10.0.0.1"); !errors.Is(err, ErrSessionRevoked) {
+			t.Fatalf("其他 session 應該被登出: %v", err)
+		}
+		if revoked, err := users.RevokeUserSessions(user.ID, ""); err != nil || revoked != 1 {
+			t.Fatalf("RevokeUserSessions = %d, %v", revoked, err)
+		}
+		if err := users.RevokeSession(9999, user.ID); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("不存在的 session: %v", err)
+		}
+	})
+}